@@ -3,6 +3,7 @@ module github.com/cauelz/full-cycle-golang-expert/6-banco-de-dados/2
 go 1.22.5
 
 require (
+	github.com/cauelz/full-cycle-golang-expert/pkg v0.0.0
 	gorm.io/driver/mysql v1.6.0
 	gorm.io/gorm v1.30.1
 )
@@ -14,3 +15,5 @@ require (
 	github.com/jinzhu/now v1.1.5 // indirect
 	golang.org/x/text v0.20.0 // indirect
 )
+
+replace github.com/cauelz/full-cycle-golang-expert/pkg => ../../pkg
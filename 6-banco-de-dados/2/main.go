@@ -1,6 +1,12 @@
 package main
 
 import (
+	"context"
+	"embed"
+	"log"
+	"os"
+
+	"github.com/cauelz/full-cycle-golang-expert/pkg/migrate"
 	"gorm.io/driver/mysql"
 	"gorm.io/gorm"
 )
@@ -11,6 +17,11 @@ type Product struct {
 	Price float64
 }
 
+// O schema é versionado em migrations/ em vez de usar AutoMigrate
+//
+//go:embed migrations/*.sql
+var migrationsFS embed.FS
+
 func main() {
 
 	dsn := "user:user_password@tcp(localhost:3306)/my_database"
@@ -21,5 +32,24 @@ func main() {
 		panic(err)
 	}
 
-	db.AutoMigrate(&Product{})
-}
\ No newline at end of file
+	sqlDB, err := db.DB()
+	if err != nil {
+		panic(err)
+	}
+
+	// O driver do MySQL só aceita um comando por Exec sem multiStatements=true
+	m, err := migrate.New(sqlDB, migrationsFS, "migrations", migrate.Config{SplitStatements: true})
+	if err != nil {
+		panic(err)
+	}
+
+	// go run . migrate up|down|status|goto N
+	args := []string{"up"}
+	if len(os.Args) > 2 && os.Args[1] == "migrate" {
+		args = os.Args[2:]
+	}
+
+	if err := migrate.Run(context.Background(), m, args, os.Stdout); err != nil {
+		log.Fatal(err)
+	}
+}
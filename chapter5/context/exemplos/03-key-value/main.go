@@ -5,15 +5,34 @@ import (
 	"fmt"
 )
 
+// tokenKey é a chave do token no contexto. Como o tipo não é exportado,
+// nenhum outro pacote consegue criar uma chave igual e sobrescrever o valor.
+type tokenKey struct{}
+
+// withToken retorna uma cópia do contexto com o token
+func withToken(ctx context.Context, token string) context.Context {
+	return context.WithValue(ctx, tokenKey{}, token)
+}
+
+// tokenFrom retorna o token do contexto e se ele existe
+func tokenFrom(ctx context.Context) (string, bool) {
+	token, ok := ctx.Value(tokenKey{}).(string)
+	return token, ok
+}
+
 func main() {
 	ctx := context.Background()
-	ctx = context.WithValue(ctx, "token", "senha")
+	ctx = withToken(ctx, "senha")
 
 	bookHotel(ctx, "Caue")
 }
 
 func bookHotel(ctx context.Context, name string) {
-	token := ctx.Value("token")
+	token, ok := tokenFrom(ctx)
+	if !ok {
+		fmt.Println("token não encontrado")
+		return
+	}
 
 	fmt.Println(token)
-}
\ No newline at end of file
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/cauelz/full-cycle-golang-expert/pkg/auth"
+)
+
+// anonymousActor é registrado na auditoria quando a requisição não informa
+// quem a executou
+const anonymousActor = "anonymous"
+
+// withActor guarda no contexto quem está executando a operação, como o
+// Subject do Principal compartilhado com os outros exemplos
+func withActor(ctx context.Context, actor string) context.Context {
+	return auth.WithPrincipal(ctx, auth.Principal{Subject: actor})
+}
+
+// actorFrom retorna o ator do contexto ou anonymousActor
+func actorFrom(ctx context.Context) string {
+	if p, ok := auth.PrincipalFrom(ctx); ok && p.Subject != "" {
+		return p.Subject
+	}
+	return anonymousActor
+}
+
+// actorMiddleware lê o ator do header X-Actor. Sem autenticação neste
+// exemplo, o header é confiável apenas para fins de auditoria.
+func actorMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if actor := r.Header.Get("X-Actor"); actor != "" {
+			r = r.WithContext(withActor(r.Context(), actor))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Config define qual backend de armazenamento usar
+type Config struct {
+	Backend      string        // memory, sqlite ou postgres
+	DSN          string        // string de conexão do banco (ignorada pelo memory)
+	QueryTimeout time.Duration // deadline por consulta nos backends SQL
+	AutoMigrate  bool          // aplica as migrações pendentes ao abrir o banco
+}
+
+// LoadConfig lê a configuração das variáveis de ambiente
+// USERS_BACKEND, USERS_DSN, USERS_QUERY_TIMEOUT e USERS_AUTO_MIGRATE
+func LoadConfig() (Config, error) {
+	cfg := Config{
+		Backend:      getenv("USERS_BACKEND", "sqlite"),
+		DSN:          getenv("USERS_DSN", "users.db"),
+		QueryTimeout: 3 * time.Second,
+		AutoMigrate:  true,
+	}
+	if v := os.Getenv("USERS_QUERY_TIMEOUT"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return cfg, fmt.Errorf("USERS_QUERY_TIMEOUT inválido: %w", err)
+		}
+		cfg.QueryTimeout = d
+	}
+	if v := os.Getenv("USERS_AUTO_MIGRATE"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return cfg, fmt.Errorf("USERS_AUTO_MIGRATE inválido: %w", err)
+		}
+		cfg.AutoMigrate = b
+	}
+	return cfg, nil
+}
+
+func getenv(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
+
+// BackendFactory cria um UserService a partir da configuração. Se o serviço
+// implementar io.Closer, ele será fechado no encerramento do servidor.
+type BackendFactory func(cfg Config) (UserService, error)
+
+var (
+	backendsMu sync.RWMutex
+	backends   = make(map[string]BackendFactory)
+)
+
+// RegisterBackend registra um backend pelo nome
+func RegisterBackend(name string, factory BackendFactory) {
+	backendsMu.Lock()
+	defer backendsMu.Unlock()
+	if _, dup := backends[name]; dup {
+		panic("backend registrado duas vezes: " + name)
+	}
+	backends[name] = factory
+}
+
+// Backends retorna os nomes dos backends registrados
+func Backends() []string {
+	backendsMu.RLock()
+	defer backendsMu.RUnlock()
+	names := make([]string, 0, len(backends))
+	for name := range backends {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// OpenBackend cria o UserService do backend escolhido na configuração
+func OpenBackend(cfg Config) (UserService, error) {
+	backendsMu.RLock()
+	factory, ok := backends[cfg.Backend]
+	backendsMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("backend desconhecido %q (disponíveis: %v)", cfg.Backend, Backends())
+	}
+	return factory(cfg)
+}
+
+// closeService fecha o serviço se ele mantiver recursos abertos
+func closeService(service UserService) error {
+	if c, ok := service.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// sqlBackend descreve um backend baseado em database/sql
+type sqlBackend struct {
+	driver  string
+	dialect Dialect
+}
+
+var sqlBackends = map[string]sqlBackend{
+	"sqlite":   {driver: "sqlite3", dialect: SQLiteDialect{}},
+	"postgres": {driver: "postgres", dialect: PostgresDialect{}},
+}
+
+func init() {
+	RegisterBackend("memory", func(cfg Config) (UserService, error) {
+		return NewMemoryUserService(), nil
+	})
+	for name, backend := range sqlBackends {
+		backend := backend
+		RegisterBackend(name, func(cfg Config) (UserService, error) {
+			return openSQLBackend(backend, cfg)
+		})
+	}
+}
+
+// openSQLDB abre a conexão com o banco do backend
+func openSQLDB(backend sqlBackend, cfg Config) (*sql.DB, error) {
+	db, err := sql.Open(backend.driver, cfg.DSN)
+	if err != nil {
+		return nil, err
+	}
+	if backend.driver == "sqlite3" {
+		// O SQLite aceita um único escritor por vez; uma conexão evita
+		// "database is locked" e permite usar ":memory:"
+		db.SetMaxOpenConns(1)
+	}
+	return db, nil
+}
+
+// openSQLBackend abre o banco e, se configurado, aplica as migrações pendentes
+func openSQLBackend(backend sqlBackend, cfg Config) (UserService, error) {
+	db, err := openSQLDB(backend, cfg)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.AutoMigrate {
+		m, err := newMigrator(db, backend.dialect)
+		if err == nil {
+			err = m.Up(context.Background())
+		}
+		if err != nil {
+			db.Close()
+			return nil, err
+		}
+	}
+	return NewSQLUserService(db, backend.dialect, cfg.QueryTimeout), nil
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestLoadConfig(t *testing.T) {
+	tests := []struct {
+		timeout     string
+		autoMigrate string
+		want        Config
+		wantErr     bool
+	}{
+		{"", "", Config{Backend: "sqlite", DSN: "users.db", QueryTimeout: 3 * time.Second, AutoMigrate: true}, false},
+		{"500ms", "false", Config{Backend: "sqlite", DSN: "users.db", QueryTimeout: 500 * time.Millisecond}, false},
+		{"0", "", Config{Backend: "sqlite", DSN: "users.db", AutoMigrate: true}, false},
+		{"3", "", Config{}, true},
+		{"", "talvez", Config{}, true},
+	}
+	for _, tt := range tests {
+		t.Setenv("USERS_BACKEND", "")
+		t.Setenv("USERS_DSN", "")
+		t.Setenv("USERS_QUERY_TIMEOUT", tt.timeout)
+		t.Setenv("USERS_AUTO_MIGRATE", tt.autoMigrate)
+
+		got, err := LoadConfig()
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("timeout=%q auto_migrate=%q: esperado erro", tt.timeout, tt.autoMigrate)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("timeout=%q auto_migrate=%q: esperado %+v, obtido %+v (%v)", tt.timeout, tt.autoMigrate, tt.want, got, err)
+		}
+	}
+}
+
+func TestSQLUserServiceQueryTimeout(t *testing.T) {
+	tests := []struct {
+		timeout time.Duration
+		wantErr error
+	}{
+		{0, nil},
+		{time.Minute, nil},
+		// O deadline por consulta vence antes de a consulta começar
+		{time.Nanosecond, context.DeadlineExceeded},
+	}
+	for _, tt := range tests {
+		s := openTestBackend(t, Config{Backend: "sqlite", DSN: ":memory:", QueryTimeout: tt.timeout, AutoMigrate: true})
+		ctx := context.Background()
+
+		_, err := s.List(ctx, ListParams{Limit: 10, SortField: "id"})
+		if !errors.Is(err, tt.wantErr) {
+			t.Errorf("List com timeout %v: esperado %v, obtido %v", tt.timeout, tt.wantErr, err)
+		}
+		_, err = s.Create(ctx, User{Name: "Ana", Email: "ana@exemplo.com"})
+		if !errors.Is(err, tt.wantErr) {
+			t.Errorf("Create com timeout %v: esperado %v, obtido %v", tt.timeout, tt.wantErr, err)
+		}
+	}
+}
@@ -0,0 +1,299 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// importBatchSize é a quantidade de linhas gravadas por transação
+	importBatchSize = 500
+	// exportPageSize é a quantidade de linhas lidas do banco por consulta
+	exportPageSize = 500
+	// maxNDJSONLine limita o tamanho de uma linha NDJSON
+	maxNDJSONLine = 1 << 20
+	// exportPageTimeout é o prazo para escrever cada página da exportação
+	exportPageTimeout = 15 * time.Second
+)
+
+// ImportRowError descreve uma linha rejeitada na importação
+type ImportRowError struct {
+	Line    int          `json:"line"`
+	Email   string       `json:"email,omitempty"`
+	Message string       `json:"message"`
+	Errors  []FieldError `json:"errors,omitempty"`
+}
+
+// ImportReport é o resultado de POST /users:bulk
+type ImportReport struct {
+	Created int              `json:"created"`
+	Failed  int              `json:"failed"`
+	Errors  []ImportRowError `json:"errors"`
+}
+
+// errBatchFailed é reportado nas linhas de um lote que não foi gravado
+var errBatchFailed = errors.New("not imported: batch failed, retry this row")
+
+// importRow é uma linha lida do corpo, já com o número da linha de origem
+type importRow struct {
+	line int
+	user User
+	err  error
+}
+
+// rowReader lê a próxima linha do corpo; retorna io.EOF ao final
+type rowReader func() (importRow, error)
+
+// newNDJSONReader lê um objeto User por linha, ignorando linhas vazias
+func newNDJSONReader(r io.Reader) rowReader {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxNDJSONLine)
+	line := 0
+	return func() (importRow, error) {
+		for scanner.Scan() {
+			line++
+			text := strings.TrimSpace(scanner.Text())
+			if text == "" {
+				continue
+			}
+			var u User
+			if err := json.Unmarshal([]byte(text), &u); err != nil {
+				return importRow{line: line, err: NewValidationError("line", "invalid JSON")}, nil
+			}
+			return importRow{line: line, user: u}, nil
+		}
+		if err := scanner.Err(); err != nil {
+			return importRow{}, err
+		}
+		return importRow{}, io.EOF
+	}
+}
+
+// newCSVReader lê linhas CSV com cabeçalho contendo as colunas name e email
+func newCSVReader(r io.Reader) (rowReader, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+
+	header, err := cr.Read()
+	if err != nil {
+		return nil, NewValidationError("body", "missing CSV header")
+	}
+	cols := make(map[string]int)
+	for i, name := range header {
+		cols[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	nameCol, okName := cols["name"]
+	emailCol, okEmail := cols["email"]
+	if !okName || !okEmail {
+		return nil, NewValidationError("body", "CSV header must contain name and email")
+	}
+
+	return func() (importRow, error) {
+		record, err := cr.Read()
+		if err == io.EOF {
+			return importRow{}, io.EOF
+		}
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			return importRow{line: parseErr.Line, err: NewValidationError("line", parseErr.Err.Error())}, nil
+		}
+		if err != nil {
+			return importRow{}, err
+		}
+		line, _ := cr.FieldPos(0)
+		if nameCol >= len(record) || emailCol >= len(record) {
+			return importRow{line: line, err: NewValidationError("line", "missing columns")}, nil
+		}
+		return importRow{line: line, user: User{Name: record[nameCol], Email: record[emailCol]}}, nil
+	}, nil
+}
+
+// Import recebe usuários em NDJSON (application/x-ndjson) ou CSV (text/csv)
+// e os grava em lotes. Linhas inválidas, com email duplicado ou de um lote
+// que falhou ao gravar são reportadas sem interromper a importação.
+func (h *UserHandler) Import(w http.ResponseWriter, r *http.Request) {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+
+	var next rowReader
+	switch mediaType {
+	case "application/x-ndjson", "application/ndjson":
+		next = newNDJSONReader(r.Body)
+	case "text/csv":
+		var err error
+		if next, err = newCSVReader(r.Body); err != nil {
+			h.handleError(w, r, err)
+			return
+		}
+	default:
+		h.handleError(w, r, NewValidationError("Content-Type", "must be application/x-ndjson or text/csv"))
+		return
+	}
+
+	report := ImportReport{Errors: []ImportRowError{}}
+	rowFailed := func(row importRow, err error) {
+		report.Failed++
+		rowErr := ImportRowError{Line: row.line, Email: row.user.Email, Message: err.Error()}
+		var vErr *ValidationError
+		if errors.As(err, &vErr) {
+			rowErr.Message = "validation failed"
+			rowErr.Errors = vErr.Errors
+		}
+		report.Errors = append(report.Errors, rowErr)
+	}
+
+	batch := make([]importRow, 0, importBatchSize)
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		users := make([]User, len(batch))
+		for i, row := range batch {
+			users[i] = row.user
+		}
+		errs, err := h.service.ImportBatch(r.Context(), users)
+		if errors.Is(err, context.Canceled) {
+			return err
+		}
+		if err != nil {
+			// Os lotes anteriores já foram gravados; as linhas deste lote
+			// são reportadas como falhas e a importação segue com o próximo,
+			// para que o relatório diga exatamente o que foi gravado
+			log.Printf("import batch failed: %v", err)
+			errs = make([]error, len(batch))
+			for i := range errs {
+				errs[i] = errBatchFailed
+			}
+		}
+		for i, rowErr := range errs {
+			if rowErr != nil {
+				rowFailed(batch[i], rowErr)
+			} else {
+				report.Created++
+			}
+		}
+		batch = batch[:0]
+		return nil
+	}
+
+	for {
+		row, err := next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			h.handleError(w, r, fmt.Errorf("reading import body: %w", err))
+			return
+		}
+		if row.err == nil {
+			if vErr := validateInput(row.user); vErr != nil {
+				row.err = vErr
+			}
+		}
+		if row.err != nil {
+			rowFailed(row, row.err)
+			continue
+		}
+
+		batch = append(batch, row)
+		if len(batch) == importBatchSize {
+			if err := flush(); err != nil {
+				h.handleError(w, r, err)
+				return
+			}
+		}
+	}
+	if err := flush(); err != nil {
+		h.handleError(w, r, err)
+		return
+	}
+
+	h.respondJSON(w, http.StatusOK, report)
+}
+
+// Export envia todos os usuários ativos em CSV ou NDJSON. Os registros são
+// lidos em páginas e escritos conforme chegam, sem carregar a tabela inteira
+// em memória.
+func (h *UserHandler) Export(w http.ResponseWriter, r *http.Request) {
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "ndjson"
+	}
+
+	// write grava um usuário; flush esvazia os buffers ao final de cada página
+	var write func(User) error
+	var flush func() error
+	switch format {
+	case "ndjson":
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		enc := json.NewEncoder(w)
+		write = func(u User) error { return enc.Encode(u) }
+		flush = func() error { return nil }
+	case "csv":
+		w.Header().Set("Content-Type", "text/csv")
+		cw := csv.NewWriter(w)
+		cw.Write([]string{"id", "name", "email", "created_at", "version"})
+		write = func(u User) error {
+			return cw.Write([]string{
+				strconv.Itoa(u.ID), u.Name, u.Email,
+				u.CreatedAt.Format(time.RFC3339Nano), strconv.Itoa(u.Version),
+			})
+		}
+		flush = func() error {
+			cw.Flush()
+			return cw.Error()
+		}
+	default:
+		h.handleError(w, r, NewValidationError("format", "must be csv or ndjson"))
+		return
+	}
+
+	// A primeira página é lida antes de escrever qualquer coisa, para que
+	// um erro ainda possa virar uma resposta problem+json
+	params := ListParams{Limit: exportPageSize, SortField: "id"}
+	page, err := h.service.List(r.Context(), params)
+	if err != nil {
+		h.handleError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Disposition", `attachment; filename="users.`+format+`"`)
+	w.WriteHeader(http.StatusOK)
+
+	// O WriteTimeout do servidor vale para a resposta inteira e cortaria
+	// exportações grandes no meio. O prazo é renovado a cada página, então
+	// só um cliente que pare de ler é desconectado.
+	rc := http.NewResponseController(w)
+	for {
+		rc.SetWriteDeadline(time.Now().Add(exportPageTimeout))
+		for _, u := range page.Users {
+			if err := write(u); err != nil {
+				return
+			}
+		}
+		if err := flush(); err != nil {
+			return
+		}
+		rc.Flush()
+		if !page.HasMore {
+			return
+		}
+
+		// Depois que o corpo começou, um erro só pode interromper o stream
+		params.Cursor = newCursor(params, page.Users[len(page.Users)-1])
+		if page, err = h.service.List(r.Context(), params); err != nil {
+			log.Printf("export interrupted: %v", err)
+			return
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"errors"
+
+	"github.com/cauelz/full-cycle-golang-expert/pkg/migrate"
+	"github.com/lib/pq"
+	"github.com/mattn/go-sqlite3"
+)
+
+// Dialect isola as diferenças entre bancos compatíveis com database/sql
+type Dialect interface {
+	// Rebind converte os placeholders "?" para o estilo do banco
+	Rebind(query string) string
+	// IsUniqueViolation verifica se o erro é de restrição UNIQUE
+	IsUniqueViolation(err error) bool
+	// MigrationsDir é o diretório das migrações deste banco em migrationsFS
+	MigrationsDir() string
+	// Placeholder é o estilo de parâmetros usado pelo runner de migrações
+	Placeholder() migrate.Placeholder
+}
+
+// SQLiteDialect usa placeholders "?"
+type SQLiteDialect struct{}
+
+func (SQLiteDialect) Rebind(query string) string {
+	return query
+}
+
+func (SQLiteDialect) IsUniqueViolation(err error) bool {
+	var sqliteErr sqlite3.Error
+	return errors.As(err, &sqliteErr) && sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique
+}
+
+func (SQLiteDialect) MigrationsDir() string {
+	return "migrations/sqlite"
+}
+
+func (SQLiteDialect) Placeholder() migrate.Placeholder {
+	return migrate.Question
+}
+
+// PostgresDialect usa placeholders numerados ($1, $2, ...)
+type PostgresDialect struct{}
+
+func (PostgresDialect) Rebind(query string) string {
+	return migrate.Dollar.Rebind(query)
+}
+
+func (PostgresDialect) IsUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
+}
+
+func (PostgresDialect) MigrationsDir() string {
+	return "migrations/postgres"
+}
+
+func (PostgresDialect) Placeholder() migrate.Placeholder {
+	return migrate.Dollar
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"errors"
+	"strings"
+)
+
+// Erros do serviço de usuários. O handler traduz cada um para o status HTTP
+// correspondente, então as implementações de UserService devem retorná-los
+// (diretamente ou com %w) em vez de erros específicos do banco.
+var (
+	// ErrNotFound indica que o usuário não existe
+	ErrNotFound = errors.New("user not found")
+	// ErrConflict indica violação de unicidade (email já cadastrado)
+	ErrConflict = errors.New("email already in use")
+	// ErrPreconditionFailed indica que o registro mudou desde a versão
+	// informada pelo cliente
+	ErrPreconditionFailed = errors.New("user was modified by another request")
+)
+
+// FieldError descreve o problema de validação de um campo
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ValidationError agrupa todos os erros de validação de uma requisição
+type ValidationError struct {
+	Errors []FieldError `json:"errors"`
+}
+
+// NewValidationError cria um ValidationError com um único campo
+func NewValidationError(field, message string) *ValidationError {
+	return &ValidationError{Errors: []FieldError{{Field: field, Message: message}}}
+}
+
+// Add acrescenta um erro de campo
+func (e *ValidationError) Add(field, message string) {
+	e.Errors = append(e.Errors, FieldError{Field: field, Message: message})
+}
+
+// HasErrors informa se algum erro foi registrado
+func (e *ValidationError) HasErrors() bool {
+	return len(e.Errors) > 0
+}
+
+func (e *ValidationError) Error() string {
+	msgs := make([]string, len(e.Errors))
+	for i, fe := range e.Errors {
+		msgs[i] = fe.Field + ": " + fe.Message
+	}
+	return "validation failed: " + strings.Join(msgs, "; ")
+}
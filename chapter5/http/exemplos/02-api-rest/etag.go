@@ -0,0 +1,81 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// etagFor gera o ETag do usuário a partir da sua versão
+func etagFor(u User) string {
+	return `"` + strconv.Itoa(u.Version) + `"`
+}
+
+// parseETags separa os valores de If-Match/If-None-Match. Tags fracas
+// (W/"...") são retornadas com o prefixo.
+func parseETags(header string) []string {
+	var tags []string
+	for _, tag := range strings.Split(header, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// versionFromETag extrai a versão de um ETag forte gerado por etagFor
+func versionFromETag(tag string) (int, bool) {
+	if len(tag) < 2 || tag[0] != '"' || tag[len(tag)-1] != '"' {
+		return 0, false
+	}
+	v, err := strconv.Atoi(tag[1 : len(tag)-1])
+	if err != nil || v < 1 {
+		return 0, false
+	}
+	return v, true
+}
+
+// expectedVersion traduz o If-Match da requisição para a versão esperada
+// pelo serviço. Sem o header (ou com "*"), a escrita é incondicional.
+// Com várias tags, a versão atual é usada se estiver entre elas; a escrita
+// condicional no serviço garante que ela não mudou nesse intervalo.
+func (h *UserHandler) expectedVersion(r *http.Request, id string) (int, error) {
+	header := r.Header.Get("If-Match")
+	if header == "" || strings.TrimSpace(header) == "*" {
+		return AnyVersion, nil
+	}
+
+	tags := parseETags(header)
+	if len(tags) == 1 {
+		// If-Match usa comparação forte: tags fracas ou inválidas nunca casam
+		if v, ok := versionFromETag(tags[0]); ok {
+			return v, nil
+		}
+		return 0, ErrPreconditionFailed
+	}
+
+	current, err := h.service.Get(r.Context(), id, GetOptions{})
+	if err != nil {
+		return 0, err
+	}
+	for _, tag := range tags {
+		if tag == etagFor(current) {
+			return current.Version, nil
+		}
+	}
+	return 0, ErrPreconditionFailed
+}
+
+// noneMatch verifica o If-None-Match (comparação fraca) contra o ETag atual
+func noneMatch(r *http.Request, etag string) bool {
+	header := r.Header.Get("If-None-Match")
+	if header == "" {
+		return true
+	}
+	for _, tag := range parseETags(header) {
+		if tag == "*" || strings.TrimPrefix(tag, "W/") == etag {
+			return false
+		}
+	}
+	return true
+}
@@ -2,4 +2,10 @@ module api-rest
 
 go 1.22
 
-require github.com/mattn/go-sqlite3 v1.14.28
+require (
+	github.com/cauelz/full-cycle-golang-expert/pkg v0.0.0
+	github.com/lib/pq v1.10.9
+	github.com/mattn/go-sqlite3 v1.14.28
+)
+
+replace github.com/cauelz/full-cycle-golang-expert/pkg => ../../../../pkg
@@ -0,0 +1,307 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"sync"
+
+	"github.com/cauelz/full-cycle-golang-expert/pkg/validate"
+)
+
+// Handler
+type UserHandler struct {
+	service UserService
+
+	// Documento OpenAPI, gerado na primeira requisição a /openapi.json
+	openAPIOnce sync.Once
+	openAPI     *openAPIDoc
+}
+
+func NewUserHandler(service UserService) *UserHandler {
+	return &UserHandler{service: service}
+}
+
+func (h *UserHandler) respondJSON(w http.ResponseWriter, status int, data interface{}) {
+	// Respostas sem corpo, como o 204, não declaram Content-Type
+	if data == nil {
+		w.WriteHeader(status)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(data)
+}
+
+// validateInput aplica as regras das tags `validate` e converte as falhas
+// em um ValidationError com todos os campos inválidos
+func validateInput(v interface{}) *ValidationError {
+	var errs validate.ValidationErrors
+	if !errors.As(validate.Struct(v), &errs) {
+		return nil
+	}
+	vErr := &ValidationError{}
+	for _, fe := range errs {
+		vErr.Add(fe.Field, fe.Message)
+	}
+	return vErr
+}
+
+func (h *UserHandler) List(w http.ResponseWriter, r *http.Request) {
+	params, err := parseListParams(r.URL.Query())
+	if err != nil {
+		h.handleError(w, r, err)
+		return
+	}
+
+	page, err := h.service.List(r.Context(), params)
+	if err != nil {
+		h.handleError(w, r, err)
+		return
+	}
+	h.respondJSON(w, http.StatusOK, page)
+}
+
+func (h *UserHandler) Get(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	var opts GetOptions
+	if v := r.URL.Query().Get("include_deleted"); v != "" {
+		include, err := strconv.ParseBool(v)
+		if err != nil {
+			h.handleError(w, r, NewValidationError("include_deleted", "must be a boolean"))
+			return
+		}
+		opts.IncludeDeleted = include
+	}
+
+	user, err := h.service.Get(r.Context(), id, opts)
+	if err != nil {
+		h.handleError(w, r, err)
+		return
+	}
+
+	etag := etagFor(user)
+	w.Header().Set("ETag", etag)
+	if !noneMatch(r, etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	h.respondJSON(w, http.StatusOK, user)
+}
+
+func (h *UserHandler) Create(w http.ResponseWriter, r *http.Request) {
+	var user User
+	if err := json.NewDecoder(r.Body).Decode(&user); err != nil {
+		h.handleError(w, r, NewValidationError("body", "invalid JSON"))
+		return
+	}
+
+	if vErr := validateInput(user); vErr != nil {
+		h.handleError(w, r, vErr)
+		return
+	}
+
+	created, err := h.service.Create(r.Context(), user)
+	if err != nil {
+		h.handleError(w, r, err)
+		return
+	}
+	w.Header().Set("ETag", etagFor(created))
+	h.respondJSON(w, http.StatusCreated, created)
+}
+
+func (h *UserHandler) Update(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	var user User
+	if err := json.NewDecoder(r.Body).Decode(&user); err != nil {
+		h.handleError(w, r, NewValidationError("body", "invalid JSON"))
+		return
+	}
+	if vErr := validateInput(user); vErr != nil {
+		h.handleError(w, r, vErr)
+		return
+	}
+
+	version, err := h.expectedVersion(r, id)
+	if err != nil {
+		h.handleError(w, r, err)
+		return
+	}
+
+	updated, err := h.service.Update(r.Context(), id, user, version)
+	if err != nil {
+		h.handleError(w, r, err)
+		return
+	}
+	w.Header().Set("ETag", etagFor(updated))
+	h.respondJSON(w, http.StatusOK, updated)
+}
+
+func (h *UserHandler) Patch(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	var patch UserPatch
+	if err := json.NewDecoder(r.Body).Decode(&patch); err != nil {
+		h.handleError(w, r, NewValidationError("body", "invalid JSON"))
+		return
+	}
+	if vErr := validateInput(patch); vErr != nil {
+		h.handleError(w, r, vErr)
+		return
+	}
+
+	version, err := h.expectedVersion(r, id)
+	if err != nil {
+		h.handleError(w, r, err)
+		return
+	}
+
+	updated, err := h.service.Patch(r.Context(), id, patch, version)
+	if err != nil {
+		h.handleError(w, r, err)
+		return
+	}
+	w.Header().Set("ETag", etagFor(updated))
+	h.respondJSON(w, http.StatusOK, updated)
+}
+
+func (h *UserHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	version, err := h.expectedVersion(r, id)
+	if err != nil {
+		h.handleError(w, r, err)
+		return
+	}
+
+	if err := h.service.Delete(r.Context(), id, version); err != nil {
+		h.handleError(w, r, err)
+		return
+	}
+	h.respondJSON(w, http.StatusNoContent, nil)
+}
+
+func (h *UserHandler) Restore(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	restored, err := h.service.Restore(r.Context(), id)
+	if err != nil {
+		h.handleError(w, r, err)
+		return
+	}
+	w.Header().Set("ETag", etagFor(restored))
+	h.respondJSON(w, http.StatusOK, restored)
+}
+
+func (h *UserHandler) History(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	entries, err := h.service.History(r.Context(), id)
+	if err != nil {
+		h.handleError(w, r, err)
+		return
+	}
+	h.respondJSON(w, http.StatusOK, entries)
+}
+
+// routes descreve todas as rotas do handler. Toda rota nova deve ser
+// declarada aqui para aparecer no documento OpenAPI.
+func (h *UserHandler) routes() []Route {
+	ifMatch := Param{Name: "If-Match", In: "header", Type: "string", Description: "ETag esperado; 412 se o usuário mudou"}
+	return []Route{
+		{
+			Method: "GET", Path: "/users", Summary: "Lista usuários com paginação por cursor",
+			Handler: h.List,
+			Params: []Param{
+				{Name: "limit", In: "query", Type: "integer", Description: "Itens por página (1-100, padrão 20)"},
+				{Name: "cursor", In: "query", Type: "string", Description: "next_cursor da página anterior"},
+				{Name: "sort", In: "query", Type: "string", Description: "Campo de ordenação; prefixo - para decrescente"},
+				{Name: "email_contains", In: "query", Type: "string", Description: "Filtra por parte do email"},
+				{Name: "include_deleted", In: "query", Type: "boolean", Description: "Inclui usuários removidos"},
+			},
+			Status: http.StatusOK, Response: UserPage{},
+			Errors: []int{http.StatusBadRequest},
+		},
+		{
+			Method: "POST", Path: "/users", Summary: "Cria um usuário",
+			Handler: h.Create,
+			Request: User{},
+			Status:  http.StatusCreated, Response: User{},
+			Errors: []int{http.StatusBadRequest, http.StatusConflict},
+		},
+		{
+			Method: "POST", Path: "/users:bulk", Summary: "Importa usuários em NDJSON ou CSV",
+			Handler:      h.Import,
+			Request:      User{},
+			RequestTypes: []string{"application/x-ndjson", "text/csv"},
+			Status:       http.StatusOK, Response: ImportReport{},
+			Errors: []int{http.StatusBadRequest},
+		},
+		{
+			Method: "GET", Path: "/users:export", Summary: "Exporta usuários em NDJSON ou CSV",
+			Handler: h.Export,
+			Params: []Param{
+				{Name: "format", In: "query", Type: "string", Description: "ndjson (padrão) ou csv"},
+			},
+			Status: http.StatusOK, Response: User{},
+			ResponseTypes: []string{"application/x-ndjson", "text/csv"},
+			Errors:        []int{http.StatusBadRequest},
+		},
+		{
+			Method: "GET", Path: "/users/{id}", Summary: "Busca um usuário",
+			Handler: h.Get,
+			Params: []Param{
+				{Name: "include_deleted", In: "query", Type: "boolean", Description: "Permite buscar usuários removidos"},
+				{Name: "If-None-Match", In: "header", Type: "string", Description: "304 se o ETag não mudou"},
+			},
+			Status: http.StatusOK, Response: User{},
+			Errors: []int{http.StatusBadRequest, http.StatusNotFound},
+		},
+		{
+			Method: "PUT", Path: "/users/{id}", Summary: "Substitui os dados de um usuário",
+			Handler: h.Update,
+			Params:  []Param{ifMatch},
+			Request: User{},
+			Status:  http.StatusOK, Response: User{},
+			Errors: []int{http.StatusBadRequest, http.StatusNotFound, http.StatusConflict, http.StatusPreconditionFailed},
+		},
+		{
+			Method: "PATCH", Path: "/users/{id}", Summary: "Atualiza parcialmente um usuário",
+			Handler: h.Patch,
+			Params:  []Param{ifMatch},
+			Request: UserPatch{},
+			Status:  http.StatusOK, Response: User{},
+			Errors: []int{http.StatusBadRequest, http.StatusNotFound, http.StatusConflict, http.StatusPreconditionFailed},
+		},
+		{
+			Method: "DELETE", Path: "/users/{id}", Summary: "Remove um usuário (soft delete)",
+			Handler: h.Delete,
+			Params:  []Param{ifMatch},
+			Status:  http.StatusNoContent,
+			Errors:  []int{http.StatusNotFound, http.StatusPreconditionFailed},
+		},
+		{
+			Method: "POST", Path: "/users/{id}/restore", Summary: "Restaura um usuário removido",
+			Handler: h.Restore,
+			Status:  http.StatusOK, Response: User{},
+			Errors: []int{http.StatusNotFound},
+		},
+		{
+			Method: "GET", Path: "/users/{id}/history", Summary: "Trilha de auditoria do usuário",
+			Handler: h.History,
+			Status:  http.StatusOK, Response: []AuditEntry{},
+			Errors: []int{http.StatusNotFound},
+		},
+		{
+			Method: "GET", Path: "/openapi.json", Summary: "Este documento",
+			Handler: h.OpenAPI,
+			Status:  http.StatusOK,
+		},
+	}
+}
+
+func (h *UserHandler) Routes() *http.ServeMux {
+	mux := http.NewServeMux()
+	for _, r := range h.routes() {
+		// Padrão "MÉTODO /caminho" do Go 1.22
+		mux.HandleFunc(r.Method+" "+r.Path, r.Handler)
+	}
+	return mux
+}
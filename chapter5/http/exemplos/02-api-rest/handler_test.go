@@ -0,0 +1,370 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// doRequest executa uma requisição contra as rotas do handler
+func doRequest(t *testing.T, h http.Handler, method, path, body string, headers map[string]string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestUserHandlerETag(t *testing.T) {
+	h := NewUserHandler(NewMemoryUserService()).Routes()
+
+	rec := doRequest(t, h, "POST", "/users", `{"name":"Ana","email":"ana@exemplo.com"}`, nil)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("POST: esperado 201, obtido %d", rec.Code)
+	}
+
+	rec = doRequest(t, h, "GET", "/users/1", "", nil)
+	etag := rec.Header().Get("ETag")
+	if etag != `"1"` {
+		t.Fatalf("GET: esperado ETag \"1\", obtido %q", etag)
+	}
+
+	rec = doRequest(t, h, "GET", "/users/1", "", map[string]string{"If-None-Match": etag})
+	if rec.Code != http.StatusNotModified {
+		t.Errorf("GET com If-None-Match atual: esperado 304, obtido %d", rec.Code)
+	}
+
+	rec = doRequest(t, h, "PATCH", "/users/1", `{"name":"Ana Maria"}`, map[string]string{"If-Match": etag})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("PATCH com If-Match atual: esperado 200, obtido %d", rec.Code)
+	}
+	newETag := rec.Header().Get("ETag")
+	if newETag != `"2"` {
+		t.Errorf("PATCH: esperado novo ETag \"2\", obtido %q", newETag)
+	}
+
+	// O segundo cliente ainda tem o ETag antigo
+	rec = doRequest(t, h, "PUT", "/users/1", `{"name":"X","email":"x@exemplo.com"}`, map[string]string{"If-Match": etag})
+	if rec.Code != http.StatusPreconditionFailed {
+		t.Errorf("PUT com If-Match antigo: esperado 412, obtido %d", rec.Code)
+	}
+
+	rec = doRequest(t, h, "GET", "/users/1", "", map[string]string{"If-None-Match": etag})
+	if rec.Code != http.StatusOK {
+		t.Errorf("GET com If-None-Match antigo: esperado 200, obtido %d", rec.Code)
+	}
+
+	rec = doRequest(t, h, "DELETE", "/users/1", "", map[string]string{"If-Match": `"9", ` + newETag})
+	if rec.Code != http.StatusNoContent {
+		t.Errorf("DELETE com lista de If-Match: esperado 204, obtido %d", rec.Code)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "" || rec.Body.Len() != 0 {
+		t.Errorf("DELETE: 204 sem corpo não deveria ter Content-Type, obtido %q", ct)
+	}
+}
+
+func TestUserHandlerBulk(t *testing.T) {
+	h := NewUserHandler(NewMemoryUserService()).Routes()
+
+	body := `{"name":"Ana","email":"ana@exemplo.com"}
+{"name":"Bia","email":"bia@exemplo.com"}
+
+{"name":"","email":"sem-nome@exemplo.com"}
+{"name":"Ana de novo","email":"ana@exemplo.com"}
+{invalido
+`
+	rec := doRequest(t, h, "POST", "/users:bulk", body, map[string]string{"Content-Type": "application/x-ndjson"})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("POST NDJSON: esperado 200, obtido %d: %s", rec.Code, rec.Body)
+	}
+	var report ImportReport
+	if err := json.NewDecoder(rec.Body).Decode(&report); err != nil {
+		t.Fatal(err)
+	}
+	if report.Created != 2 || report.Failed != 3 {
+		t.Fatalf("NDJSON: esperado 2 criados e 3 falhas, obtido %+v", report)
+	}
+	wantLines := []int{4, 6, 5}
+	for i, e := range report.Errors {
+		if e.Line != wantLines[i] {
+			t.Errorf("erro %d: esperado linha %d, obtido %d", i, wantLines[i], e.Line)
+		}
+	}
+
+	csvBody := "email,name\ncaio@exemplo.com,Caio\nbia@exemplo.com,Bia\n"
+	rec = doRequest(t, h, "POST", "/users:bulk", csvBody, map[string]string{"Content-Type": "text/csv; charset=utf-8"})
+	report = ImportReport{}
+	json.NewDecoder(rec.Body).Decode(&report)
+	if report.Created != 1 || report.Failed != 1 || report.Errors[0].Line != 3 {
+		t.Fatalf("CSV: esperado 1 criado e falha na linha 3, obtido %+v", report)
+	}
+
+	rec = doRequest(t, h, "POST", "/users:bulk", body, map[string]string{"Content-Type": "application/json"})
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Content-Type inválido: esperado 400, obtido %d", rec.Code)
+	}
+
+	rec = doRequest(t, h, "GET", "/users:export?format=ndjson", "", nil)
+	if got := strings.Count(rec.Body.String(), "\n"); got != 3 {
+		t.Errorf("export NDJSON: esperado 3 linhas, obtido %d", got)
+	}
+
+	rec = doRequest(t, h, "GET", "/users:export?format=csv", "", nil)
+	records, err := csv.NewReader(rec.Body).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 4 || records[0][0] != "id" || records[3][2] != "caio@exemplo.com" {
+		t.Errorf("export CSV inesperado: %v", records)
+	}
+}
+
+// failingBatchService falha o lote de número failAt em ImportBatch
+type failingBatchService struct {
+	UserService
+	calls, failAt int
+}
+
+func (s *failingBatchService) ImportBatch(ctx context.Context, users []User) ([]error, error) {
+	s.calls++
+	if s.calls == s.failAt {
+		return nil, errors.New("database unavailable")
+	}
+	return s.UserService.ImportBatch(ctx, users)
+}
+
+func TestUserHandlerBulkBatchFailure(t *testing.T) {
+	service := &failingBatchService{UserService: NewMemoryUserService(), failAt: 2}
+	h := NewUserHandler(service).Routes()
+
+	var body strings.Builder
+	total := 2*importBatchSize + 10
+	for i := 1; i <= total; i++ {
+		fmt.Fprintf(&body, `{"name":"Usuário %d","email":"u%d@exemplo.com"}`+"\n", i, i)
+	}
+	rec := doRequest(t, h, "POST", "/users:bulk", body.String(), map[string]string{"Content-Type": "application/x-ndjson"})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("esperado 200 com o relatório parcial, obtido %d: %s", rec.Code, rec.Body)
+	}
+	var report ImportReport
+	json.NewDecoder(rec.Body).Decode(&report)
+	if report.Created != importBatchSize+10 || report.Failed != importBatchSize || len(report.Errors) != importBatchSize {
+		t.Fatalf("relatório inesperado: created=%d failed=%d", report.Created, report.Failed)
+	}
+	// As falhas são exatamente as linhas do segundo lote
+	for i, e := range report.Errors {
+		if e.Line != importBatchSize+i+1 || e.Message != errBatchFailed.Error() {
+			t.Fatalf("erro %d inesperado: %+v", i, e)
+		}
+	}
+	page, _ := service.List(context.Background(), ListParams{Limit: 1000})
+	if len(page.Users) != report.Created {
+		t.Errorf("esperado %d usuários gravados, obtido %d", report.Created, len(page.Users))
+	}
+}
+
+// slowListService atrasa cada página de List
+type slowListService struct {
+	UserService
+	delay time.Duration
+}
+
+func (s *slowListService) List(ctx context.Context, params ListParams) (UserPage, error) {
+	time.Sleep(s.delay)
+	return s.UserService.List(ctx, params)
+}
+
+func TestUserHandlerExportPages(t *testing.T) {
+	service := NewMemoryUserService()
+	total := 2*exportPageSize + 1
+	users := make([]User, total)
+	for i := range users {
+		users[i] = User{Name: fmt.Sprintf("Usuário %d", i), Email: fmt.Sprintf("u%d@exemplo.com", i)}
+	}
+	if _, err := service.ImportBatch(context.Background(), users); err != nil {
+		t.Fatal(err)
+	}
+
+	// As três páginas juntas levam mais que o WriteTimeout do servidor
+	srv := httptest.NewUnstartedServer(NewUserHandler(&slowListService{UserService: service, delay: 150 * time.Millisecond}).Routes())
+	srv.Config.WriteTimeout = 300 * time.Millisecond
+	srv.Start()
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/users:export?format=ndjson")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("export interrompido: %v", err)
+	}
+	if got := strings.Count(string(body), "\n"); got != total {
+		t.Errorf("export: esperado %d linhas, obtido %d", total, got)
+	}
+}
+
+func TestUserHandlerValidation(t *testing.T) {
+	h := NewUserHandler(NewMemoryUserService()).Routes()
+	doRequest(t, h, "POST", "/users", `{"name":"Ana","email":"ana@exemplo.com"}`, nil)
+
+	tests := []struct {
+		method, path, body string
+		fields             []string
+	}{
+		{"POST", "/users", `{"name":"","email":"invalido"}`, []string{"name", "email"}},
+		{"PUT", "/users/1", `{"name":"Ana"}`, []string{"email"}},
+		{"PATCH", "/users/1", `{"name":"","email":"ana@"}`, []string{"name", "email"}},
+	}
+	for _, tt := range tests {
+		rec := doRequest(t, h, tt.method, tt.path, tt.body, nil)
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("%s %s: esperado 400, obtido %d", tt.method, tt.path, rec.Code)
+			continue
+		}
+		var p Problem
+		json.NewDecoder(rec.Body).Decode(&p)
+		var got []string
+		for _, fe := range p.Errors {
+			got = append(got, fe.Field)
+		}
+		if strings.Join(got, ",") != strings.Join(tt.fields, ",") {
+			t.Errorf("%s %s: esperado erros em %v, obtido %v", tt.method, tt.path, tt.fields, got)
+		}
+	}
+}
+
+func TestUserHandlerList(t *testing.T) {
+	h := NewUserHandler(NewMemoryUserService()).Routes()
+	for _, u := range []string{"Caio", "Ana", "Bia"} {
+		doRequest(t, h, "POST", "/users", `{"name":"`+u+`","email":"`+strings.ToLower(u)+`@exemplo.com"}`, nil)
+	}
+
+	tests := []struct {
+		query    string
+		status   int
+		names    []string
+		wantMore bool
+	}{
+		{"", http.StatusOK, []string{"Caio", "Ana", "Bia"}, false},
+		{"?sort=name&limit=2", http.StatusOK, []string{"Ana", "Bia"}, true},
+		{"?sort=-name", http.StatusOK, []string{"Caio", "Bia", "Ana"}, false},
+		{"?email_contains=BIA", http.StatusOK, []string{"Bia"}, false},
+		{"?limit=500", http.StatusBadRequest, nil, false},
+		{"?sort=senha", http.StatusBadRequest, nil, false},
+		{"?cursor=invalido", http.StatusBadRequest, nil, false},
+	}
+	for _, tt := range tests {
+		rec := doRequest(t, h, "GET", "/users"+tt.query, "", nil)
+		if rec.Code != tt.status {
+			t.Errorf("GET /users%s: esperado %d, obtido %d", tt.query, tt.status, rec.Code)
+			continue
+		}
+		if tt.status != http.StatusOK {
+			continue
+		}
+		var page UserPage
+		json.NewDecoder(rec.Body).Decode(&page)
+		var names []string
+		for _, u := range page.Users {
+			names = append(names, u.Name)
+		}
+		if strings.Join(names, ",") != strings.Join(tt.names, ",") || page.HasMore != tt.wantMore || (page.NextCursor != "") != tt.wantMore {
+			t.Errorf("GET /users%s: esperado %v (has_more=%v), obtido %v (%+v)", tt.query, tt.names, tt.wantMore, names, page)
+		}
+	}
+
+	// O next_cursor leva à página seguinte
+	rec := doRequest(t, h, "GET", "/users?sort=name&limit=2", "", nil)
+	var first UserPage
+	json.NewDecoder(rec.Body).Decode(&first)
+	rec = doRequest(t, h, "GET", "/users?sort=name&limit=2&cursor="+first.NextCursor, "", nil)
+	var second UserPage
+	json.NewDecoder(rec.Body).Decode(&second)
+	if len(second.Users) != 1 || second.Users[0].Name != "Caio" || second.HasMore {
+		t.Errorf("segunda página inesperada: %+v", second)
+	}
+}
+
+func TestUserHandlerCanceledRequest(t *testing.T) {
+	h := NewUserHandler(NewMemoryUserService()).Routes()
+
+	// O contexto da requisição chega ao serviço; com o cliente
+	// desconectado, o handler não escreve resposta
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	for _, tt := range []struct{ method, path, body string }{
+		{"GET", "/users", ""},
+		{"GET", "/users/1", ""},
+		{"POST", "/users", `{"name":"Ana","email":"ana@exemplo.com"}`},
+	} {
+		req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body)).WithContext(ctx)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Body.Len() != 0 || rec.Header().Get("Content-Type") != "" {
+			t.Errorf("%s %s cancelado: esperado nenhuma resposta, obtido %d %q", tt.method, tt.path, rec.Code, rec.Body.String())
+		}
+	}
+}
+
+func TestUserHandlerReturnsPersistedUser(t *testing.T) {
+	backends := map[string]func(t *testing.T) UserService{
+		"memory": func(t *testing.T) UserService { return openTestBackend(t, Config{Backend: "memory"}) },
+		"sqlite": func(t *testing.T) UserService {
+			return openTestBackend(t, Config{Backend: "sqlite", DSN: ":memory:", AutoMigrate: true})
+		},
+	}
+	for name, open := range backends {
+		t.Run(name, func(t *testing.T) {
+			h := NewUserHandler(open(t)).Routes()
+
+			// id, created_at e version enviados pelo cliente são ignorados
+			rec := doRequest(t, h, "POST", "/users", `{"id":99,"name":"Ana","email":"ana@exemplo.com","created_at":"2000-01-01T00:00:00Z","version":7}`, nil)
+			var created User
+			json.NewDecoder(rec.Body).Decode(&created)
+			if rec.Code != http.StatusCreated || created.ID != 1 || created.Version != 1 || created.CreatedAt.Year() == 2000 || created.CreatedAt.IsZero() {
+				t.Fatalf("POST: esperado usuário persistido, obtido %d %+v", rec.Code, created)
+			}
+
+			tests := []struct {
+				method, body string
+				wantName     string
+				wantEmail    string
+				wantVersion  int
+			}{
+				{"PUT", `{"name":"Ana Maria","email":"ana.maria@exemplo.com"}`, "Ana Maria", "ana.maria@exemplo.com", 2},
+				// PATCH altera apenas os campos enviados
+				{"PATCH", `{"name":"Ana M."}`, "Ana M.", "ana.maria@exemplo.com", 3},
+				{"PATCH", `{"email":"ana@exemplo.com"}`, "Ana M.", "ana@exemplo.com", 4},
+			}
+			for _, tt := range tests {
+				rec := doRequest(t, h, tt.method, "/users/1", tt.body, nil)
+				var got User
+				json.NewDecoder(rec.Body).Decode(&got)
+				if rec.Code != http.StatusOK || got.ID != created.ID || got.Name != tt.wantName || got.Email != tt.wantEmail ||
+					got.Version != tt.wantVersion || !got.CreatedAt.Equal(created.CreatedAt) {
+					t.Errorf("%s %s: esperado %s/%s v%d, obtido %d %+v", tt.method, tt.body, tt.wantName, tt.wantEmail, tt.wantVersion, rec.Code, got)
+				}
+
+				// A resposta é o registro gravado, igual ao lido em seguida
+				var stored User
+				json.NewDecoder(doRequest(t, h, "GET", "/users/1", "", nil).Body).Decode(&stored)
+				if stored.Name != got.Name || stored.Email != got.Email || stored.Version != got.Version {
+					t.Errorf("%s %s: resposta %+v difere do gravado %+v", tt.method, tt.body, got, stored)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,339 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemoryUserService é uma implementação de UserService em memória, útil
+// para testes e para rodar o exemplo sem banco de dados
+type MemoryUserService struct {
+	mu       sync.RWMutex
+	users    map[int]User
+	nextID   int
+	auditLog []AuditEntry
+}
+
+// NewMemoryUserService cria um serviço em memória vazio
+func NewMemoryUserService() *MemoryUserService {
+	return &MemoryUserService{
+		users:  make(map[int]User),
+		nextID: 1,
+	}
+}
+
+// emailTaken verifica se outro usuário já usa o email. Exige o lock.
+func (s *MemoryUserService) emailTaken(email string, exceptID int) bool {
+	for _, u := range s.users {
+		if u.Email == email && u.ID != exceptID {
+			return true
+		}
+	}
+	return false
+}
+
+// compareSortKey compara a chave de ordenação de u com o valor do cursor
+func compareSortKey(field string, u User, value interface{}) int {
+	switch field {
+	case "name":
+		return strings.Compare(u.Name, value.(string))
+	case "email":
+		return strings.Compare(u.Email, value.(string))
+	case "created_at":
+		return u.CreatedAt.Compare(value.(time.Time))
+	default:
+		return cmp.Compare(u.ID, value.(int))
+	}
+}
+
+// compareUsers compara dois usuários pelo campo de ordenação, desempatando pelo id
+func compareUsers(field string, a, b User) int {
+	var c int
+	switch field {
+	case "name":
+		c = strings.Compare(a.Name, b.Name)
+	case "email":
+		c = strings.Compare(a.Email, b.Email)
+	case "created_at":
+		c = a.CreatedAt.Compare(b.CreatedAt)
+	}
+	if c != 0 {
+		return c
+	}
+	return cmp.Compare(a.ID, b.ID)
+}
+
+func (s *MemoryUserService) List(ctx context.Context, params ListParams) (UserPage, error) {
+	if err := ctx.Err(); err != nil {
+		return UserPage{}, err
+	}
+
+	var cursorValue interface{}
+	if params.Cursor != nil {
+		v, err := cursorArg(params.SortField, params.Cursor.Value)
+		if err != nil {
+			return UserPage{}, err
+		}
+		cursorValue = v
+	}
+
+	s.mu.RLock()
+	users := make([]User, 0, len(s.users))
+	for _, u := range s.users {
+		if u.DeletedAt != nil && !params.IncludeDeleted {
+			continue
+		}
+		if params.EmailContains != "" &&
+			!strings.Contains(strings.ToLower(u.Email), strings.ToLower(params.EmailContains)) {
+			continue
+		}
+		users = append(users, u)
+	}
+	s.mu.RUnlock()
+
+	slices.SortFunc(users, func(a, b User) int {
+		if params.SortDesc {
+			return compareUsers(params.SortField, b, a)
+		}
+		return compareUsers(params.SortField, a, b)
+	})
+
+	// Descarta tudo até a posição do cursor (inclusive)
+	if params.Cursor != nil {
+		start := len(users)
+		for i, u := range users {
+			c := compareSortKey(params.SortField, u, cursorValue)
+			if c == 0 {
+				c = cmp.Compare(u.ID, params.Cursor.ID)
+			}
+			if params.SortDesc {
+				c = -c
+			}
+			if c > 0 {
+				start = i
+				break
+			}
+		}
+		users = users[start:]
+	}
+
+	if len(users) > params.Limit+1 {
+		users = users[:params.Limit+1]
+	}
+	return newUserPage(params, users), nil
+}
+
+func (s *MemoryUserService) Get(ctx context.Context, id string, opts GetOptions) (User, error) {
+	if err := ctx.Err(); err != nil {
+		return User{}, err
+	}
+	userID, err := parseID(id)
+	if err != nil {
+		return User{}, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	u, ok := s.users[userID]
+	if !ok || (u.DeletedAt != nil && !opts.IncludeDeleted) {
+		return User{}, ErrNotFound
+	}
+	return u, nil
+}
+
+// audit registra a operação na trilha de auditoria. Exige o lock.
+func (s *MemoryUserService) audit(ctx context.Context, userID int, action string, before, after *User) {
+	entry := AuditEntry{
+		ID:        len(s.auditLog) + 1,
+		UserID:    userID,
+		Action:    action,
+		Actor:     actorFrom(ctx),
+		CreatedAt: time.Now().UTC(),
+	}
+	if before != nil {
+		entry.Before, _ = json.Marshal(before)
+	}
+	if after != nil {
+		entry.After, _ = json.Marshal(after)
+	}
+	s.auditLog = append(s.auditLog, entry)
+}
+
+// activeUser retorna o usuário não removido e confere a versão esperada.
+// Exige o lock.
+func (s *MemoryUserService) activeUser(userID, version int) (User, error) {
+	u, ok := s.users[userID]
+	if !ok || u.DeletedAt != nil {
+		return User{}, ErrNotFound
+	}
+	if version != AnyVersion && u.Version != version {
+		return User{}, ErrPreconditionFailed
+	}
+	return u, nil
+}
+
+func (s *MemoryUserService) Create(ctx context.Context, user User) (User, error) {
+	if err := ctx.Err(); err != nil {
+		return User{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.emailTaken(user.Email, 0) {
+		return User{}, ErrConflict
+	}
+	u := User{
+		ID:        s.nextID,
+		Name:      user.Name,
+		Email:     user.Email,
+		CreatedAt: time.Now().UTC(),
+		Version:   1,
+	}
+	s.users[u.ID] = u
+	s.nextID++
+	s.audit(ctx, u.ID, AuditCreate, nil, &u)
+	return u, nil
+}
+
+func (s *MemoryUserService) ImportBatch(ctx context.Context, users []User) ([]error, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	errs := make([]error, len(users))
+	now := time.Now().UTC()
+	for i, user := range users {
+		if s.emailTaken(user.Email, 0) {
+			errs[i] = ErrConflict
+			continue
+		}
+		u := User{
+			ID:        s.nextID,
+			Name:      user.Name,
+			Email:     user.Email,
+			CreatedAt: now,
+			Version:   1,
+		}
+		s.users[u.ID] = u
+		s.nextID++
+		s.audit(ctx, u.ID, AuditCreate, nil, &u)
+	}
+	return errs, nil
+}
+
+func (s *MemoryUserService) Update(ctx context.Context, id string, user User, version int) (User, error) {
+	return s.Patch(ctx, id, UserPatch{Name: &user.Name, Email: &user.Email}, version)
+}
+
+func (s *MemoryUserService) Patch(ctx context.Context, id string, patch UserPatch, version int) (User, error) {
+	if err := ctx.Err(); err != nil {
+		return User{}, err
+	}
+	userID, err := parseID(id)
+	if err != nil {
+		return User{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	before, err := s.activeUser(userID, version)
+	if err != nil {
+		return User{}, err
+	}
+	// Nada para alterar: devolve o registro atual sem criar nova versão
+	if patch.Name == nil && patch.Email == nil {
+		return before, nil
+	}
+	if patch.Email != nil && s.emailTaken(*patch.Email, userID) {
+		return User{}, ErrConflict
+	}
+	u := before
+	if patch.Name != nil {
+		u.Name = *patch.Name
+	}
+	if patch.Email != nil {
+		u.Email = *patch.Email
+	}
+	u.Version++
+	s.users[userID] = u
+	s.audit(ctx, userID, AuditUpdate, &before, &u)
+	return u, nil
+}
+
+func (s *MemoryUserService) Delete(ctx context.Context, id string, version int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	userID, err := parseID(id)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	before, err := s.activeUser(userID, version)
+	if err != nil {
+		return err
+	}
+	u := before
+	now := time.Now().UTC()
+	u.DeletedAt = &now
+	u.Version++
+	s.users[userID] = u
+	s.audit(ctx, userID, AuditDelete, &before, &u)
+	return nil
+}
+
+func (s *MemoryUserService) Restore(ctx context.Context, id string) (User, error) {
+	if err := ctx.Err(); err != nil {
+		return User{}, err
+	}
+	userID, err := parseID(id)
+	if err != nil {
+		return User{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	before, ok := s.users[userID]
+	// Só usuários removidos podem ser restaurados
+	if !ok || before.DeletedAt == nil {
+		return User{}, ErrNotFound
+	}
+	u := before
+	u.DeletedAt = nil
+	u.Version++
+	s.users[userID] = u
+	s.audit(ctx, userID, AuditRestore, &before, &u)
+	return u, nil
+}
+
+func (s *MemoryUserService) History(ctx context.Context, id string) ([]AuditEntry, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	userID, err := parseID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if _, ok := s.users[userID]; !ok {
+		return nil, ErrNotFound
+	}
+	entries := []AuditEntry{}
+	for _, e := range s.auditLog {
+		if e.UserID == userID {
+			entries = append(entries, e)
+		}
+	}
+	return entries, nil
+}
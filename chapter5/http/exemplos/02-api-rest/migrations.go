@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"os"
+
+	"github.com/cauelz/full-cycle-golang-expert/pkg/migrate"
+)
+
+// As migrações de cada banco ficam em migrations/<dialeto> e são embutidas
+// no binário
+//
+//go:embed migrations
+var migrationsFS embed.FS
+
+// newMigrator cria o runner de migrações para o dialeto informado
+func newMigrator(db *sql.DB, dialect Dialect) (*migrate.Migrator, error) {
+	return migrate.New(db, migrationsFS, dialect.MigrationsDir(), migrate.Config{
+		Placeholder: dialect.Placeholder(),
+	})
+}
+
+// runMigrate executa o subcomando "migrate" (up, down, status, goto N)
+// contra o banco configurado
+func runMigrate(cfg Config, args []string) error {
+	backend, ok := sqlBackends[cfg.Backend]
+	if !ok {
+		return fmt.Errorf("o backend %q não usa migrações", cfg.Backend)
+	}
+	db, err := openSQLDB(backend, cfg)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	m, err := newMigrator(db, backend.dialect)
+	if err != nil {
+		return err
+	}
+	return migrate.Run(context.Background(), m, args, os.Stdout)
+}
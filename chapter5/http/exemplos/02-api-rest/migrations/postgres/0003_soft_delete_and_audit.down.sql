@@ -0,0 +1,3 @@
+DROP TABLE user_audit;
+DROP FUNCTION user_audit_append_only();
+ALTER TABLE users DROP COLUMN deleted_at;
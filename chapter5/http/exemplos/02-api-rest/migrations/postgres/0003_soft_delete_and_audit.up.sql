@@ -0,0 +1,23 @@
+ALTER TABLE users ADD COLUMN deleted_at TIMESTAMPTZ;
+
+CREATE TABLE user_audit (
+    id BIGSERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL,
+    action TEXT NOT NULL,
+    actor TEXT NOT NULL,
+    before JSONB,
+    after JSONB,
+    created_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX idx_user_audit_user_id ON user_audit (user_id, id);
+
+-- A trilha de auditoria é append-only
+CREATE FUNCTION user_audit_append_only() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'user_audit is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER user_audit_append_only BEFORE UPDATE OR DELETE ON user_audit
+    FOR EACH ROW EXECUTE FUNCTION user_audit_append_only();
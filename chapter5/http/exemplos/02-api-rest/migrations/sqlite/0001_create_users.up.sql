@@ -0,0 +1,7 @@
+-- IF NOT EXISTS mantém compatibilidade com bancos criados antes das migrações
+CREATE TABLE IF NOT EXISTS users (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name TEXT NOT NULL,
+    email TEXT NOT NULL UNIQUE,
+    created_at DATETIME NOT NULL
+);
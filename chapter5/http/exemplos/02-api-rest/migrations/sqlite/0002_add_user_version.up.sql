@@ -0,0 +1,2 @@
+-- Versão usada para controle de concorrência otimista (ETag/If-Match)
+ALTER TABLE users ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
@@ -0,0 +1,2 @@
+DROP TABLE user_audit;
+ALTER TABLE users DROP COLUMN deleted_at;
@@ -0,0 +1,24 @@
+ALTER TABLE users ADD COLUMN deleted_at DATETIME;
+
+CREATE TABLE user_audit (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL,
+    action TEXT NOT NULL,
+    actor TEXT NOT NULL,
+    before TEXT,
+    after TEXT,
+    created_at DATETIME NOT NULL
+);
+
+CREATE INDEX idx_user_audit_user_id ON user_audit (user_id, id);
+
+-- A trilha de auditoria é append-only
+CREATE TRIGGER user_audit_no_update BEFORE UPDATE ON user_audit
+BEGIN
+    SELECT RAISE(ABORT, 'user_audit is append-only');
+END;
+
+CREATE TRIGGER user_audit_no_delete BEFORE DELETE ON user_audit
+BEGIN
+    SELECT RAISE(ABORT, 'user_audit is append-only');
+END;
@@ -0,0 +1,293 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Route descreve uma rota da API: além do handler, guarda os tipos de
+// requisição e resposta usados para gerar o documento OpenAPI
+type Route struct {
+	Method  string
+	Path    string
+	Summary string
+	Handler http.HandlerFunc
+
+	// Params lista parâmetros de query e headers; os de path são extraídos
+	// do próprio Path
+	Params []Param
+	// Request é um valor do tipo do corpo (nil se não houver corpo)
+	Request interface{}
+	// RequestTypes são os content types aceitos (padrão application/json)
+	RequestTypes []string
+	// Status é o status de sucesso e Response um valor do tipo retornado
+	Status   int
+	Response interface{}
+	// ResponseTypes são os content types da resposta (padrão application/json)
+	ResponseTypes []string
+	// Errors lista os status de erro possíveis, respondidos com Problem
+	Errors []int
+}
+
+// Param descreve um parâmetro de query ou header
+type Param struct {
+	Name        string
+	In          string
+	Type        string
+	Description string
+}
+
+// Estruturas do documento OpenAPI 3.1 (apenas o subconjunto usado)
+type openAPIDoc struct {
+	OpenAPI    string                           `json:"openapi"`
+	Info       openAPIInfo                      `json:"info"`
+	Servers    []openAPIServer                  `json:"servers"`
+	Paths      map[string]map[string]*operation `json:"paths"`
+	Components openAPIComponents                `json:"components"`
+}
+
+type openAPIInfo struct {
+	Title   string `json:"title"`
+	Version string `json:"version"`
+}
+
+type openAPIServer struct {
+	URL string `json:"url"`
+}
+
+type openAPIComponents struct {
+	Schemas map[string]*schema `json:"schemas"`
+}
+
+type operation struct {
+	Summary     string               `json:"summary,omitempty"`
+	Parameters  []parameter          `json:"parameters,omitempty"`
+	RequestBody *requestBody         `json:"requestBody,omitempty"`
+	Responses   map[string]*response `json:"responses"`
+}
+
+type parameter struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Required    bool    `json:"required,omitempty"`
+	Description string  `json:"description,omitempty"`
+	Schema      *schema `json:"schema"`
+}
+
+type requestBody struct {
+	Required bool                 `json:"required"`
+	Content  map[string]mediaType `json:"content"`
+}
+
+type response struct {
+	Description string               `json:"description"`
+	Content     map[string]mediaType `json:"content,omitempty"`
+}
+
+type mediaType struct {
+	Schema *schema `json:"schema"`
+}
+
+type schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Properties           map[string]*schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	Items                *schema            `json:"items,omitempty"`
+	AdditionalProperties *schema            `json:"additionalProperties,omitempty"`
+	MinLength            *int               `json:"minLength,omitempty"`
+	MaxLength            *int               `json:"maxLength,omitempty"`
+	Enum                 []string           `json:"enum,omitempty"`
+	ReadOnly             bool               `json:"readOnly,omitempty"`
+}
+
+var (
+	pathParamRe = regexp.MustCompile(`\{([^}.]+)(\.\.\.)?\}`)
+	timeType    = reflect.TypeOf(time.Time{})
+	rawJSONType = reflect.TypeOf(json.RawMessage{})
+)
+
+// newOpenAPIDoc gera o documento OpenAPI a partir das rotas registradas
+func newOpenAPIDoc(routes []Route) *openAPIDoc {
+	doc := &openAPIDoc{
+		OpenAPI: "3.1.0",
+		Info:    openAPIInfo{Title: "Users API", Version: "1.0.0"},
+		Servers: []openAPIServer{{URL: "/api"}},
+		Paths:   make(map[string]map[string]*operation),
+		Components: openAPIComponents{
+			Schemas: make(map[string]*schema),
+		},
+	}
+	problemRef := doc.schemaFor(reflect.TypeOf(Problem{}))
+
+	for _, r := range routes {
+		op := &operation{Summary: r.Summary, Responses: make(map[string]*response)}
+
+		for _, m := range pathParamRe.FindAllStringSubmatch(r.Path, -1) {
+			op.Parameters = append(op.Parameters, parameter{
+				Name: m[1], In: "path", Required: true, Schema: &schema{Type: "string"},
+			})
+		}
+		for _, p := range r.Params {
+			op.Parameters = append(op.Parameters, parameter{
+				Name: p.Name, In: p.In, Description: p.Description, Schema: &schema{Type: p.Type},
+			})
+		}
+
+		if r.Request != nil {
+			op.RequestBody = &requestBody{
+				Required: true,
+				Content:  doc.content(r.Request, r.RequestTypes),
+			}
+		}
+
+		ok := &response{Description: http.StatusText(r.Status)}
+		if r.Response != nil {
+			ok.Content = doc.content(r.Response, r.ResponseTypes)
+		}
+		op.Responses[strconv.Itoa(r.Status)] = ok
+		for _, status := range r.Errors {
+			op.Responses[strconv.Itoa(status)] = &response{
+				Description: http.StatusText(status),
+				Content:     map[string]mediaType{"application/problem+json": {Schema: problemRef}},
+			}
+		}
+		op.Responses["default"] = &response{
+			Description: "Unexpected error",
+			Content:     map[string]mediaType{"application/problem+json": {Schema: problemRef}},
+		}
+
+		// O OpenAPI não conhece o sufixo "..." dos padrões do ServeMux
+		path := pathParamRe.ReplaceAllString(r.Path, "{$1}")
+		if doc.Paths[path] == nil {
+			doc.Paths[path] = make(map[string]*operation)
+		}
+		doc.Paths[path][strings.ToLower(r.Method)] = op
+	}
+	return doc
+}
+
+// content monta o corpo para cada content type. Formatos que não são JSON
+// (CSV, NDJSON) são descritos como texto.
+func (doc *openAPIDoc) content(v interface{}, types []string) map[string]mediaType {
+	if len(types) == 0 {
+		types = []string{"application/json"}
+	}
+	content := make(map[string]mediaType, len(types))
+	for _, ct := range types {
+		if ct == "application/json" {
+			content[ct] = mediaType{Schema: doc.schemaFor(reflect.TypeOf(v))}
+		} else {
+			content[ct] = mediaType{Schema: &schema{Type: "string"}}
+		}
+	}
+	return content
+}
+
+// schemaFor converte um tipo Go em schema. Structs viram componentes
+// referenciados por $ref; as tags json e validate definem propriedades,
+// campos obrigatórios e restrições, e a tag openapi:"readonly" marca os
+// campos que o servidor preenche e ignora no corpo das requisições.
+func (doc *openAPIDoc) schemaFor(t reflect.Type) *schema {
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch {
+	case t == timeType:
+		return &schema{Type: "string", Format: "date-time"}
+	case t == rawJSONType:
+		// Qualquer valor JSON
+		return &schema{}
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return &schema{Type: "string"}
+	case reflect.Bool:
+		return &schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &schema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &schema{Type: "number"}
+	case reflect.Slice, reflect.Array:
+		return &schema{Type: "array", Items: doc.schemaFor(t.Elem())}
+	case reflect.Map:
+		return &schema{Type: "object", AdditionalProperties: doc.schemaFor(t.Elem())}
+	case reflect.Struct:
+		ref := &schema{Ref: "#/components/schemas/" + t.Name()}
+		if _, ok := doc.Components.Schemas[t.Name()]; ok {
+			return ref
+		}
+		s := &schema{Type: "object", Properties: make(map[string]*schema)}
+		// Registra antes de descer nos campos para suportar tipos recursivos
+		doc.Components.Schemas[t.Name()] = s
+		for i := 0; i < t.NumField(); i++ {
+			doc.addProperty(s, t.Field(i))
+		}
+		sort.Strings(s.Required)
+		return ref
+	default:
+		return &schema{}
+	}
+}
+
+// addProperty acrescenta o campo da struct ao schema, aplicando as regras
+// da tag validate
+func (doc *openAPIDoc) addProperty(s *schema, f reflect.StructField) {
+	if !f.IsExported() {
+		return
+	}
+	name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+	if name == "-" {
+		return
+	}
+	if name == "" {
+		name = f.Name
+	}
+
+	prop := doc.schemaFor(f.Type)
+	if f.Tag.Get("openapi") == "readonly" {
+		prop.ReadOnly = true
+	}
+	for _, rule := range strings.Split(f.Tag.Get("validate"), ",") {
+		rule, param, _ := strings.Cut(rule, "=")
+		switch rule {
+		case "required":
+			s.Required = append(s.Required, name)
+		case "email":
+			prop.Format = "email"
+		case "oneof":
+			prop.Enum = strings.Fields(param)
+		case "min", "max":
+			if prop.Type != "string" {
+				continue
+			}
+			n, err := strconv.Atoi(param)
+			if err != nil {
+				continue
+			}
+			if rule == "min" {
+				prop.MinLength = &n
+			} else {
+				prop.MaxLength = &n
+			}
+		}
+	}
+	s.Properties[name] = prop
+}
+
+// OpenAPI serve o documento OpenAPI das rotas do handler
+func (h *UserHandler) OpenAPI(w http.ResponseWriter, r *http.Request) {
+	h.openAPIOnce.Do(func() {
+		h.openAPI = newOpenAPIDoc(h.routes())
+	})
+	h.respondJSON(w, http.StatusOK, h.openAPI)
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// fetchOpenAPI busca o documento servido em /openapi.json
+func fetchOpenAPI(t *testing.T, h http.Handler) map[string]interface{} {
+	t.Helper()
+	rec := doRequest(t, h, "GET", "/openapi.json", "", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET /openapi.json: esperado 200, obtido %d", rec.Code)
+	}
+	var doc map[string]interface{}
+	if err := json.NewDecoder(rec.Body).Decode(&doc); err != nil {
+		t.Fatal(err)
+	}
+	return doc
+}
+
+func TestOpenAPICoversRoutes(t *testing.T) {
+	h := NewUserHandler(NewMemoryUserService())
+	mux := h.Routes()
+	doc := fetchOpenAPI(t, mux)
+
+	if doc["openapi"] != "3.1.0" {
+		t.Errorf("versão: esperado 3.1.0, obtido %v", doc["openapi"])
+	}
+	paths := doc["paths"].(map[string]interface{})
+
+	operations := 0
+	for _, item := range paths {
+		operations += len(item.(map[string]interface{}))
+	}
+	routes := h.routes()
+	if operations != len(routes) {
+		t.Errorf("esperado %d operações no documento, obtido %d", len(routes), operations)
+	}
+
+	for _, r := range routes {
+		pattern := r.Method + " " + r.Path
+
+		// A rota precisa estar de fato registrada no ServeMux
+		path := strings.ReplaceAll(r.Path, "{id}", "1")
+		req := httptest.NewRequest(r.Method, path, nil)
+		if _, got := mux.Handler(req); got != pattern {
+			t.Errorf("%s: ServeMux resolveu para %q", pattern, got)
+		}
+
+		item, ok := paths[r.Path].(map[string]interface{})
+		if !ok {
+			t.Errorf("%s: caminho ausente do documento OpenAPI", pattern)
+			continue
+		}
+		if _, ok := item[strings.ToLower(r.Method)]; !ok {
+			t.Errorf("%s: método ausente do documento OpenAPI", pattern)
+		}
+	}
+}
+
+func TestOpenAPISchemas(t *testing.T) {
+	doc := newOpenAPIDoc(NewUserHandler(NewMemoryUserService()).routes())
+
+	user := doc.Components.Schemas["User"]
+	if user == nil {
+		t.Fatal("schema User ausente")
+	}
+	if !reflect.DeepEqual(user.Required, []string{"email", "name"}) {
+		t.Errorf("User: esperado required [email name], obtido %v", user.Required)
+	}
+	if email := user.Properties["email"]; email.Format != "email" || email.MaxLength == nil || *email.MaxLength != 254 {
+		t.Errorf("User.email: restrições inesperadas %+v", email)
+	}
+	if got := user.Properties["created_at"]; got.Type != "string" || got.Format != "date-time" {
+		t.Errorf("User.created_at: esperado string date-time, obtido %+v", got)
+	}
+	// Campos preenchidos pelo servidor não são aceitos no corpo
+	for name, want := range map[string]bool{"id": true, "created_at": true, "version": true, "deleted_at": true, "name": false, "email": false} {
+		if got := user.Properties[name].ReadOnly; got != want {
+			t.Errorf("User.%s: esperado readOnly=%v, obtido %v", name, want, got)
+		}
+	}
+
+	problem := doc.Components.Schemas["Problem"]
+	if problem == nil || problem.Properties["errors"].Items.Ref != "#/components/schemas/FieldError" {
+		t.Errorf("Problem deve referenciar FieldError nos erros de validação: %+v", problem)
+	}
+
+	patch := doc.Paths["/users/{id}"]["patch"]
+	if patch.RequestBody.Content["application/json"].Schema.Ref != "#/components/schemas/UserPatch" {
+		t.Errorf("PATCH deve usar o schema UserPatch")
+	}
+	if _, ok := patch.Responses["412"]; !ok {
+		t.Errorf("PATCH deve documentar a resposta 412")
+	}
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultListLimit = 20
+	maxListLimit     = 100
+)
+
+// sortFields mapeia os campos aceitos em ?sort= para as colunas da tabela
+var sortFields = map[string]string{
+	"id":         "id",
+	"name":       "name",
+	"email":      "email",
+	"created_at": "created_at",
+}
+
+// ListParams reúne os parâmetros de paginação, ordenação e filtro da listagem
+type ListParams struct {
+	Limit         int
+	Cursor        *Cursor
+	SortField     string
+	SortDesc      bool
+	EmailContains string
+	// IncludeDeleted inclui usuários removidos logicamente
+	IncludeDeleted bool
+}
+
+// UserPage é uma página de resultados da listagem de usuários
+type UserPage struct {
+	Users      []User `json:"data"`
+	NextCursor string `json:"next_cursor,omitempty"`
+	HasMore    bool   `json:"has_more"`
+}
+
+// Cursor guarda a posição do último item retornado (keyset pagination).
+// Ele é serializado como um token opaco para o cliente.
+type Cursor struct {
+	Sort  string `json:"s"`
+	Value string `json:"v"`
+	ID    int    `json:"id"`
+}
+
+// Sort retorna a ordenação no formato aceito em ?sort=
+func (p ListParams) Sort() string {
+	if p.SortDesc {
+		return "-" + p.SortField
+	}
+	return p.SortField
+}
+
+// sortValue retorna o valor do campo de ordenação de um usuário como string
+func sortValue(u User, field string) string {
+	switch field {
+	case "name":
+		return u.Name
+	case "email":
+		return u.Email
+	case "created_at":
+		return u.CreatedAt.UTC().Format(time.RFC3339Nano)
+	default:
+		return strconv.Itoa(u.ID)
+	}
+}
+
+// newCursor cria o cursor que aponta para depois do usuário informado
+func newCursor(p ListParams, u User) *Cursor {
+	return &Cursor{Sort: p.Sort(), Value: sortValue(u, p.SortField), ID: u.ID}
+}
+
+// newUserPage monta a página a partir de até Limit+1 usuários já ordenados;
+// o item excedente indica que existe uma próxima página
+func newUserPage(p ListParams, users []User) UserPage {
+	page := UserPage{Users: users}
+	if len(users) > p.Limit {
+		page.Users = users[:p.Limit]
+		page.HasMore = true
+		page.NextCursor = newCursor(p, page.Users[p.Limit-1]).Encode()
+	}
+	return page
+}
+
+// Encode serializa o cursor como um token opaco
+func (c *Cursor) Encode() string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// decodeCursor desserializa um token gerado por Cursor.Encode
+func decodeCursor(token string) (*Cursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, NewValidationError("cursor", "invalid cursor")
+	}
+	var c Cursor
+	if err := json.Unmarshal(b, &c); err != nil {
+		return nil, NewValidationError("cursor", "invalid cursor")
+	}
+	return &c, nil
+}
+
+// parseListParams lê os parâmetros de listagem da query string
+func parseListParams(q url.Values) (ListParams, error) {
+	p := ListParams{Limit: defaultListLimit, SortField: "id"}
+
+	if v := q.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > maxListLimit {
+			return p, NewValidationError("limit", "must be between 1 and "+strconv.Itoa(maxListLimit))
+		}
+		p.Limit = limit
+	}
+
+	if v := q.Get("sort"); v != "" {
+		field := strings.TrimPrefix(v, "-")
+		if _, ok := sortFields[field]; !ok {
+			return p, NewValidationError("sort", "unsupported sort field")
+		}
+		p.SortField = field
+		p.SortDesc = strings.HasPrefix(v, "-")
+	}
+
+	p.EmailContains = q.Get("email_contains")
+
+	if v := q.Get("include_deleted"); v != "" {
+		include, err := strconv.ParseBool(v)
+		if err != nil {
+			return p, NewValidationError("include_deleted", "must be a boolean")
+		}
+		p.IncludeDeleted = include
+	}
+
+	if v := q.Get("cursor"); v != "" {
+		c, err := decodeCursor(v)
+		if err != nil {
+			return p, err
+		}
+		// Um cursor só é válido para a mesma ordenação em que foi gerado
+		if c.Sort != p.Sort() {
+			return p, NewValidationError("cursor", "cursor does not match sort")
+		}
+		p.Cursor = c
+	}
+
+	return p, nil
+}
+
+// cursorArg converte o valor do cursor para o tipo da coluna de ordenação
+func cursorArg(field, value string) (interface{}, error) {
+	switch field {
+	case "id":
+		id, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, NewValidationError("cursor", "invalid cursor")
+		}
+		return id, nil
+	case "created_at":
+		t, err := time.Parse(time.RFC3339Nano, value)
+		if err != nil {
+			return nil, NewValidationError("cursor", "invalid cursor")
+		}
+		return t, nil
+	default:
+		return value, nil
+	}
+}
+
+// escapeLike escapa os curingas do LIKE para busca literal
+func escapeLike(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+	return r.Replace(s)
+}
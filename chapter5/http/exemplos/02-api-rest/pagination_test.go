@@ -0,0 +1,106 @@
+package main
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestParseListParams(t *testing.T) {
+	idCursor := (&Cursor{Sort: "id", Value: "3", ID: 3}).Encode()
+	nameCursor := (&Cursor{Sort: "-name", Value: "Bia", ID: 2}).Encode()
+
+	tests := []struct {
+		query     string
+		want      ListParams
+		wantField string // campo do ValidationError; vazio se não houver erro
+	}{
+		{"", ListParams{Limit: defaultListLimit, SortField: "id"}, ""},
+		{"limit=5&sort=-name", ListParams{Limit: 5, SortField: "name", SortDesc: true}, ""},
+		{"email_contains=exemplo&include_deleted=true", ListParams{Limit: defaultListLimit, SortField: "id", EmailContains: "exemplo", IncludeDeleted: true}, ""},
+		{"cursor=" + idCursor, ListParams{Limit: defaultListLimit, SortField: "id", Cursor: &Cursor{Sort: "id", Value: "3", ID: 3}}, ""},
+		{"sort=-name&cursor=" + nameCursor, ListParams{Limit: defaultListLimit, SortField: "name", SortDesc: true, Cursor: &Cursor{Sort: "-name", Value: "Bia", ID: 2}}, ""},
+		{"limit=0", ListParams{}, "limit"},
+		{"limit=101", ListParams{}, "limit"},
+		{"limit=abc", ListParams{}, "limit"},
+		{"sort=password", ListParams{}, "sort"},
+		{"include_deleted=talvez", ListParams{}, "include_deleted"},
+		{"cursor=%%%", ListParams{}, "cursor"},
+		{"cursor=bm90LWpzb24", ListParams{}, "cursor"},
+		// Cursor gerado para outra ordenação
+		{"sort=name&cursor=" + idCursor, ListParams{}, "cursor"},
+	}
+	for _, tt := range tests {
+		q, err := url.ParseQuery(tt.query)
+		if err != nil {
+			// "%%%" não é uma query válida; envia o valor literal
+			q = url.Values{"cursor": {strings.TrimPrefix(tt.query, "cursor=")}}
+		}
+		got, err := parseListParams(q)
+
+		if tt.wantField != "" {
+			var vErr *ValidationError
+			if !errors.As(err, &vErr) || vErr.Errors[0].Field != tt.wantField {
+				t.Errorf("%q: esperado erro em %s, obtido %v", tt.query, tt.wantField, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: erro inesperado: %v", tt.query, err)
+			continue
+		}
+		if got.Limit != tt.want.Limit || got.SortField != tt.want.SortField || got.SortDesc != tt.want.SortDesc ||
+			got.EmailContains != tt.want.EmailContains || got.IncludeDeleted != tt.want.IncludeDeleted {
+			t.Errorf("%q: esperado %+v, obtido %+v", tt.query, tt.want, got)
+		}
+		if (got.Cursor == nil) != (tt.want.Cursor == nil) || (got.Cursor != nil && *got.Cursor != *tt.want.Cursor) {
+			t.Errorf("%q: esperado cursor %+v, obtido %+v", tt.query, tt.want.Cursor, got.Cursor)
+		}
+	}
+}
+
+func TestNewUserPage(t *testing.T) {
+	users := []User{{ID: 1, Name: "Ana"}, {ID: 2, Name: "Bia"}, {ID: 3, Name: "Caio"}}
+	tests := []struct {
+		limit      int
+		wantLen    int
+		wantMore   bool
+		wantCursor *Cursor
+	}{
+		{2, 2, true, &Cursor{Sort: "-name", Value: "Bia", ID: 2}},
+		{3, 3, false, nil},
+		{5, 3, false, nil},
+	}
+	for _, tt := range tests {
+		page := newUserPage(ListParams{Limit: tt.limit, SortField: "name", SortDesc: true}, users)
+		if len(page.Users) != tt.wantLen || page.HasMore != tt.wantMore {
+			t.Errorf("limit=%d: esperado %d usuários e has_more=%v, obtido %d e %v", tt.limit, tt.wantLen, tt.wantMore, len(page.Users), page.HasMore)
+		}
+		if tt.wantCursor == nil {
+			if page.NextCursor != "" {
+				t.Errorf("limit=%d: next_cursor inesperado %q", tt.limit, page.NextCursor)
+			}
+			continue
+		}
+		c, err := decodeCursor(page.NextCursor)
+		if err != nil || *c != *tt.wantCursor {
+			t.Errorf("limit=%d: esperado cursor %+v, obtido %+v (%v)", tt.limit, tt.wantCursor, c, err)
+		}
+	}
+}
+
+func TestEscapeLike(t *testing.T) {
+	tests := map[string]string{
+		"ana":     "ana",
+		"50%":     `50\%`,
+		"bia_1":   `bia\_1`,
+		`c:\temp`: `c:\\temp`,
+		`%_\`:     `\%\_\\`,
+	}
+	for in, want := range tests {
+		if got := escapeLike(in); got != want {
+			t.Errorf("escapeLike(%q): esperado %q, obtido %q", in, want, got)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+)
+
+// Problem é o corpo de erro no formato RFC 7807 (application/problem+json)
+type Problem struct {
+	Type     string       `json:"type"`
+	Title    string       `json:"title"`
+	Status   int          `json:"status"`
+	Detail   string       `json:"detail,omitempty"`
+	Instance string       `json:"instance,omitempty"`
+	Errors   []FieldError `json:"errors,omitempty"`
+}
+
+// Tipos de problema retornados pela API
+const (
+	problemValidation   = "/problems/validation-error"
+	problemNotFound     = "/problems/not-found"
+	problemConflict     = "/problems/conflict"
+	problemPrecondition = "/problems/precondition-failed"
+	problemTimeout      = "/problems/timeout"
+	problemInternal     = "/problems/internal-error"
+)
+
+// problemFor traduz um erro do serviço para o Problem correspondente
+func problemFor(err error) Problem {
+	var vErr *ValidationError
+	switch {
+	case errors.As(err, &vErr):
+		return Problem{
+			Type:   problemValidation,
+			Title:  "Validation failed",
+			Status: http.StatusBadRequest,
+			Errors: vErr.Errors,
+		}
+	case errors.Is(err, ErrNotFound):
+		return Problem{
+			Type:   problemNotFound,
+			Title:  "Resource not found",
+			Status: http.StatusNotFound,
+			Detail: err.Error(),
+		}
+	case errors.Is(err, ErrConflict):
+		return Problem{
+			Type:   problemConflict,
+			Title:  "Resource conflict",
+			Status: http.StatusConflict,
+			Detail: err.Error(),
+		}
+	case errors.Is(err, ErrPreconditionFailed):
+		return Problem{
+			Type:   problemPrecondition,
+			Title:  "Precondition failed",
+			Status: http.StatusPreconditionFailed,
+			Detail: err.Error(),
+		}
+	case errors.Is(err, context.DeadlineExceeded):
+		return Problem{
+			Type:   problemTimeout,
+			Title:  "Request timed out",
+			Status: http.StatusGatewayTimeout,
+		}
+	default:
+		// Não expor detalhes internos ao cliente
+		return Problem{
+			Type:   problemInternal,
+			Title:  "Internal server error",
+			Status: http.StatusInternalServerError,
+		}
+	}
+}
+
+// respondProblem escreve o Problem com o content type da RFC 7807
+func respondProblem(w http.ResponseWriter, p Problem) {
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(p.Status)
+	json.NewEncoder(w).Encode(p)
+}
+
+func (h *UserHandler) handleError(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, context.Canceled) {
+		// O cliente desconectou; não há para quem responder
+		log.Printf("Request canceled: %v", err)
+		return
+	}
+
+	p := problemFor(err)
+	if p.Status == http.StatusInternalServerError {
+		log.Printf("Error: %v", err)
+	}
+	p.Instance = r.URL.Path
+	respondProblem(w, p)
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestProblemFor(t *testing.T) {
+	vErr := NewValidationError("name", "obrigatório")
+	vErr.Add("email", "inválido")
+
+	tests := []struct {
+		err        error
+		wantType   string
+		wantStatus int
+		wantFields int
+	}{
+		{vErr, problemValidation, http.StatusBadRequest, 2},
+		{fmt.Errorf("bulk: %w", vErr), problemValidation, http.StatusBadRequest, 2},
+		{ErrNotFound, problemNotFound, http.StatusNotFound, 0},
+		{fmt.Errorf("get 7: %w", ErrNotFound), problemNotFound, http.StatusNotFound, 0},
+		{ErrConflict, problemConflict, http.StatusConflict, 0},
+		{ErrPreconditionFailed, problemPrecondition, http.StatusPreconditionFailed, 0},
+		{context.DeadlineExceeded, problemTimeout, http.StatusGatewayTimeout, 0},
+		{errors.New("disk I/O error"), problemInternal, http.StatusInternalServerError, 0},
+	}
+	for _, tt := range tests {
+		p := problemFor(tt.err)
+		if p.Type != tt.wantType || p.Status != tt.wantStatus || len(p.Errors) != tt.wantFields {
+			t.Errorf("problemFor(%v): esperado %s %d com %d campos, obtido %+v", tt.err, tt.wantType, tt.wantStatus, tt.wantFields, p)
+		}
+	}
+
+	// Erros internos não vazam para o cliente
+	if p := problemFor(errors.New("disk I/O error")); p.Detail != "" {
+		t.Errorf("problemFor: detalhe interno exposto: %q", p.Detail)
+	}
+}
+
+func TestUserHandlerProblems(t *testing.T) {
+	h := NewUserHandler(NewMemoryUserService()).Routes()
+	doRequest(t, h, "POST", "/users", `{"name":"Ana","email":"ana@exemplo.com"}`, nil)
+
+	tests := []struct {
+		method, path, body string
+		wantStatus         int
+		wantType           string
+	}{
+		{"GET", "/users/99", "", http.StatusNotFound, problemNotFound},
+		{"DELETE", "/users/99", "", http.StatusNotFound, problemNotFound},
+		{"POST", "/users", `{"name":"Outra","email":"ana@exemplo.com"}`, http.StatusConflict, problemConflict},
+		{"POST", "/users", `{"name":"","email":"x"}`, http.StatusBadRequest, problemValidation},
+		{"PUT", "/users/1", `{"name":"Ana","email":"ana@exemplo.com"}`, http.StatusOK, ""},
+	}
+	for _, tt := range tests {
+		rec := doRequest(t, h, tt.method, tt.path, tt.body, nil)
+		if rec.Code != tt.wantStatus {
+			t.Errorf("%s %s: esperado %d, obtido %d", tt.method, tt.path, tt.wantStatus, rec.Code)
+			continue
+		}
+		if tt.wantType == "" {
+			continue
+		}
+		if ct := rec.Header().Get("Content-Type"); ct != "application/problem+json" {
+			t.Errorf("%s %s: esperado application/problem+json, obtido %q", tt.method, tt.path, ct)
+		}
+		var p Problem
+		if err := json.NewDecoder(rec.Body).Decode(&p); err != nil {
+			t.Fatalf("%s %s: corpo inválido: %v", tt.method, tt.path, err)
+		}
+		if p.Type != tt.wantType || p.Status != tt.wantStatus || p.Instance != tt.path {
+			t.Errorf("%s %s: problem inesperado %+v", tt.method, tt.path, p)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+)
+
+// Domain types
+type User struct {
+	ID        int        `json:"id" openapi:"readonly"`
+	Name      string     `json:"name" validate:"required,max=100"`
+	Email     string     `json:"email" validate:"required,email,max=254"`
+	CreatedAt time.Time  `json:"created_at" openapi:"readonly"`
+	Version   int        `json:"version" openapi:"readonly"`
+	DeletedAt *time.Time `json:"deleted_at,omitempty" openapi:"readonly"`
+}
+
+// AnyVersion desativa a verificação de versão em Update, Patch e Delete
+const AnyVersion = 0
+
+// UserPatch representa uma atualização parcial: apenas os campos não nulos
+// são alterados, e cada campo enviado é validado
+type UserPatch struct {
+	Name  *string `json:"name" validate:"min=1,max=100"`
+	Email *string `json:"email" validate:"email,max=254"`
+}
+
+// Ações registradas na trilha de auditoria
+const (
+	AuditCreate  = "create"
+	AuditUpdate  = "update"
+	AuditDelete  = "delete"
+	AuditRestore = "restore"
+)
+
+// AuditEntry é um registro imutável de alteração em um usuário. Before e
+// After guardam o usuário em JSON antes e depois da operação.
+type AuditEntry struct {
+	ID        int             `json:"id"`
+	UserID    int             `json:"user_id"`
+	Action    string          `json:"action"`
+	Actor     string          `json:"actor"`
+	Before    json.RawMessage `json:"before,omitempty"`
+	After     json.RawMessage `json:"after,omitempty"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// GetOptions ajusta a busca de um usuário
+type GetOptions struct {
+	IncludeDeleted bool
+}
+
+// Service interface. Update, Patch e Delete recebem a versão esperada do
+// registro (controle de concorrência otimista); se ela não for a atual,
+// retornam ErrPreconditionFailed. AnyVersion ignora a verificação.
+//
+// Delete é lógico (preenche deleted_at); usuários removidos são ignorados por
+// List e Get, a menos que IncludeDeleted seja informado, e podem voltar com
+// Restore. Toda escrita é registrada na auditoria com o ator do contexto.
+type UserService interface {
+	List(ctx context.Context, params ListParams) (UserPage, error)
+	Get(ctx context.Context, id string, opts GetOptions) (User, error)
+	Create(ctx context.Context, user User) (User, error)
+	Update(ctx context.Context, id string, user User, version int) (User, error)
+	Patch(ctx context.Context, id string, patch UserPatch, version int) (User, error)
+	Delete(ctx context.Context, id string, version int) error
+	Restore(ctx context.Context, id string) (User, error)
+	History(ctx context.Context, id string) ([]AuditEntry, error)
+	// ImportBatch cria os usuários em uma única transação. Emails já
+	// cadastrados não abortam o lote: a posição correspondente do slice
+	// retornado recebe ErrConflict (nil indica sucesso).
+	ImportBatch(ctx context.Context, users []User) ([]error, error)
+}
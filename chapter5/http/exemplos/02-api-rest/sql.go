@@ -0,0 +1,457 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SQLUserService implementa UserService sobre database/sql. As consultas são
+// escritas com placeholders "?" e adaptadas ao banco pelo Dialect.
+type SQLUserService struct {
+	db           *sql.DB
+	dialect      Dialect
+	queryTimeout time.Duration
+}
+
+// NewSQLUserService cria o serviço. Cada consulta recebe o próprio deadline
+// de queryTimeout além do contexto da requisição, inclusive as que rodam
+// dentro de uma transação; zero desabilita o deadline.
+func NewSQLUserService(db *sql.DB, dialect Dialect, queryTimeout time.Duration) *SQLUserService {
+	return &SQLUserService{db: db, dialect: dialect, queryTimeout: queryTimeout}
+}
+
+// NewSQLiteUserService cria o serviço usando o dialeto do SQLite
+func NewSQLiteUserService(db *sql.DB, queryTimeout time.Duration) *SQLUserService {
+	return NewSQLUserService(db, SQLiteDialect{}, queryTimeout)
+}
+
+// NewPostgresUserService cria o serviço usando o dialeto do PostgreSQL
+func NewPostgresUserService(db *sql.DB, queryTimeout time.Duration) *SQLUserService {
+	return NewSQLUserService(db, PostgresDialect{}, queryTimeout)
+}
+
+// Close fecha a conexão com o banco
+func (s *SQLUserService) Close() error {
+	return s.db.Close()
+}
+
+// withTimeout aplica o deadline por consulta ao contexto recebido
+func (s *SQLUserService) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if s.queryTimeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, s.queryTimeout)
+}
+
+// queryUser executa uma consulta que retorna um usuário, com o deadline por
+// consulta
+func (s *SQLUserService) queryUser(ctx context.Context, q queryer, query string, args ...interface{}) (User, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	return scanUser(q.QueryRowContext(ctx, s.dialect.Rebind(query), args...))
+}
+
+// translate converte erros do driver nos erros do serviço
+func (s *SQLUserService) translate(err error) error {
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return ErrNotFound
+	case err != nil && s.dialect.IsUniqueViolation(err):
+		return ErrConflict
+	}
+	return err
+}
+
+// userColumns são as colunas lidas por scanUser, na mesma ordem
+const userColumns = "id, name, email, created_at, version, deleted_at"
+
+// rowScanner é satisfeito por *sql.Row e *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// queryer é satisfeito por *sql.DB e *sql.Tx
+type queryer interface {
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+func scanUser(row rowScanner) (User, error) {
+	var u User
+	var deletedAt sql.NullTime
+	err := row.Scan(&u.ID, &u.Name, &u.Email, &u.CreatedAt, &u.Version, &deletedAt)
+	if deletedAt.Valid {
+		t := deletedAt.Time
+		u.DeletedAt = &t
+	}
+	return u, err
+}
+
+// parseID converte o id do path; ids inválidos nunca existem no banco
+func parseID(id string) (int, error) {
+	n, err := strconv.Atoi(id)
+	if err != nil {
+		return 0, ErrNotFound
+	}
+	return n, nil
+}
+
+func (s *SQLUserService) List(ctx context.Context, params ListParams) (UserPage, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	column := sortFields[params.SortField]
+	order, cmp := "ASC", ">"
+	if params.SortDesc {
+		order, cmp = "DESC", "<"
+	}
+
+	query := "SELECT " + userColumns + " FROM users WHERE 1 = 1"
+	var args []interface{}
+
+	if !params.IncludeDeleted {
+		query += " AND deleted_at IS NULL"
+	}
+
+	if params.EmailContains != "" {
+		query += ` AND LOWER(email) LIKE '%' || LOWER(?) || '%' ESCAPE '\'`
+		args = append(args, escapeLike(params.EmailContains))
+	}
+
+	if params.Cursor != nil {
+		value, err := cursorArg(params.SortField, params.Cursor.Value)
+		if err != nil {
+			return UserPage{}, err
+		}
+		query += fmt.Sprintf(" AND (%s, id) %s (?, ?)", column, cmp)
+		args = append(args, value, params.Cursor.ID)
+	}
+
+	// Busca um item a mais para saber se existe uma próxima página
+	query += fmt.Sprintf(" ORDER BY %s %s, id %s LIMIT ?", column, order, order)
+	args = append(args, params.Limit+1)
+
+	rows, err := s.db.QueryContext(ctx, s.dialect.Rebind(query), args...)
+	if err != nil {
+		return UserPage{}, err
+	}
+	defer rows.Close()
+
+	users := make([]User, 0, params.Limit)
+	for rows.Next() {
+		u, err := scanUser(rows)
+		if err != nil {
+			return UserPage{}, err
+		}
+		users = append(users, u)
+	}
+	if err := rows.Err(); err != nil {
+		return UserPage{}, err
+	}
+
+	return newUserPage(params, users), nil
+}
+
+func (s *SQLUserService) Get(ctx context.Context, id string, opts GetOptions) (User, error) {
+	userID, err := parseID(id)
+	if err != nil {
+		return User{}, err
+	}
+
+	u, err := s.getUser(ctx, s.db, userID, opts.IncludeDeleted)
+	return u, s.translate(err)
+}
+
+// getUser busca o usuário usando q (o banco ou uma transação)
+func (s *SQLUserService) getUser(ctx context.Context, q queryer, userID int, includeDeleted bool) (User, error) {
+	query := "SELECT " + userColumns + " FROM users WHERE id = ?"
+	if !includeDeleted {
+		query += " AND deleted_at IS NULL"
+	}
+	return s.queryUser(ctx, q, query, userID)
+}
+
+// inTx executa fn em uma transação. A transação segue o contexto da
+// requisição; o deadline vale para cada consulta feita por fn, então uma
+// operação com várias consultas não divide um único prazo entre elas.
+func (s *SQLUserService) inTx(ctx context.Context, fn func(ctx context.Context, tx *sql.Tx) error) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := fn(ctx, tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// audit registra a operação na trilha de auditoria, na mesma transação
+func (s *SQLUserService) audit(ctx context.Context, tx *sql.Tx, userID int, action string, before, after *User) error {
+	beforeJSON, err := marshalAudit(before)
+	if err != nil {
+		return err
+	}
+	afterJSON, err := marshalAudit(after)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	_, err = tx.ExecContext(ctx,
+		s.dialect.Rebind("INSERT INTO user_audit (user_id, action, actor, before, after, created_at) VALUES (?, ?, ?, ?, ?, ?)"),
+		userID, action, actorFrom(ctx), beforeJSON, afterJSON, time.Now().UTC(),
+	)
+	return err
+}
+
+// marshalAudit serializa o usuário para a auditoria; nil vira NULL
+func marshalAudit(u *User) (interface{}, error) {
+	if u == nil {
+		return nil, nil
+	}
+	b, err := json.Marshal(u)
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+func (s *SQLUserService) Create(ctx context.Context, user User) (User, error) {
+	var u User
+	err := s.inTx(ctx, func(ctx context.Context, tx *sql.Tx) error {
+		var err error
+		u, err = s.queryUser(ctx, tx,
+			"INSERT INTO users (name, email, created_at) VALUES (?, ?, ?) RETURNING "+userColumns,
+			user.Name, user.Email, time.Now().UTC(),
+		)
+		if err != nil {
+			return err
+		}
+		return s.audit(ctx, tx, u.ID, AuditCreate, nil, &u)
+	})
+	return u, s.translate(err)
+}
+
+func (s *SQLUserService) Update(ctx context.Context, id string, user User, version int) (User, error) {
+	name, email := user.Name, user.Email
+	return s.update(ctx, id, UserPatch{Name: &name, Email: &email}, version)
+}
+
+func (s *SQLUserService) Patch(ctx context.Context, id string, patch UserPatch, version int) (User, error) {
+	return s.update(ctx, id, patch, version)
+}
+
+// update altera os campos não nulos do patch e incrementa a versão. Com
+// version diferente de AnyVersion, só altera se a versão atual for a esperada.
+func (s *SQLUserService) update(ctx context.Context, id string, patch UserPatch, version int) (User, error) {
+	userID, err := parseID(id)
+	if err != nil {
+		return User{}, err
+	}
+
+	sets := []string{"version = version + 1"}
+	var args []interface{}
+	if patch.Name != nil {
+		sets = append(sets, "name = ?")
+		args = append(args, *patch.Name)
+	}
+	if patch.Email != nil {
+		sets = append(sets, "email = ?")
+		args = append(args, *patch.Email)
+	}
+
+	var u User
+	err = s.inTx(ctx, func(ctx context.Context, tx *sql.Tx) error {
+		before, err := s.checkVersion(ctx, tx, userID, version)
+		if err != nil {
+			return err
+		}
+		// Nada para alterar: devolve o registro atual sem criar nova versão
+		if len(args) == 0 {
+			u = before
+			return nil
+		}
+
+		// A condição na versão lida protege contra escritas concorrentes
+		// entre o SELECT e o UPDATE
+		query := "UPDATE users SET " + strings.Join(sets, ", ") +
+			" WHERE id = ? AND version = ? AND deleted_at IS NULL RETURNING " + userColumns
+		u, err = s.queryUser(ctx, tx, query, append(args, userID, before.Version)...)
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrPreconditionFailed
+		}
+		if err != nil {
+			return err
+		}
+		return s.audit(ctx, tx, userID, AuditUpdate, &before, &u)
+	})
+	if err != nil {
+		return User{}, s.translate(err)
+	}
+	return u, nil
+}
+
+// checkVersion lê o usuário ativo e confere a versão esperada
+func (s *SQLUserService) checkVersion(ctx context.Context, tx *sql.Tx, userID, version int) (User, error) {
+	u, err := s.getUser(ctx, tx, userID, false)
+	if err != nil {
+		return User{}, err
+	}
+	if version != AnyVersion && u.Version != version {
+		return User{}, ErrPreconditionFailed
+	}
+	return u, nil
+}
+
+// setDeleted preenche ou limpa deleted_at, incrementa a versão e audita
+func (s *SQLUserService) setDeleted(ctx context.Context, tx *sql.Tx, before User, deleted bool) (User, error) {
+	var deletedAt interface{}
+	action := AuditRestore
+	if deleted {
+		deletedAt = time.Now().UTC()
+		action = AuditDelete
+	}
+	u, err := s.queryUser(ctx, tx,
+		"UPDATE users SET deleted_at = ?, version = version + 1 WHERE id = ? AND version = ? RETURNING "+userColumns,
+		deletedAt, before.ID, before.Version,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return User{}, ErrPreconditionFailed
+	}
+	if err != nil {
+		return User{}, err
+	}
+	return u, s.audit(ctx, tx, before.ID, action, &before, &u)
+}
+
+func (s *SQLUserService) Delete(ctx context.Context, id string, version int) error {
+	userID, err := parseID(id)
+	if err != nil {
+		return err
+	}
+
+	err = s.inTx(ctx, func(ctx context.Context, tx *sql.Tx) error {
+		before, err := s.checkVersion(ctx, tx, userID, version)
+		if err != nil {
+			return err
+		}
+		_, err = s.setDeleted(ctx, tx, before, true)
+		return err
+	})
+	return s.translate(err)
+}
+
+func (s *SQLUserService) Restore(ctx context.Context, id string) (User, error) {
+	userID, err := parseID(id)
+	if err != nil {
+		return User{}, err
+	}
+
+	var u User
+	err = s.inTx(ctx, func(ctx context.Context, tx *sql.Tx) error {
+		before, err := s.getUser(ctx, tx, userID, true)
+		if err != nil {
+			return err
+		}
+		if before.DeletedAt == nil {
+			// Só usuários removidos podem ser restaurados
+			return ErrNotFound
+		}
+		u, err = s.setDeleted(ctx, tx, before, false)
+		return err
+	})
+	if err != nil {
+		return User{}, s.translate(err)
+	}
+	return u, nil
+}
+
+func (s *SQLUserService) History(ctx context.Context, id string) ([]AuditEntry, error) {
+	userID, err := parseID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	// Usuários criados antes da auditoria não têm histórico, então a
+	// existência é verificada na tabela users, incluindo os removidos
+	if _, err := s.getUser(ctx, s.db, userID, true); err != nil {
+		return nil, s.translate(err)
+	}
+
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	rows, err := s.db.QueryContext(ctx,
+		s.dialect.Rebind("SELECT id, user_id, action, actor, before, after, created_at FROM user_audit WHERE user_id = ? ORDER BY id"),
+		userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []AuditEntry{}
+	for rows.Next() {
+		var e AuditEntry
+		var before, after sql.NullString
+		if err := rows.Scan(&e.ID, &e.UserID, &e.Action, &e.Actor, &before, &after, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		if before.Valid {
+			e.Before = json.RawMessage(before.String)
+		}
+		if after.Valid {
+			e.After = json.RawMessage(after.String)
+		}
+		entries = append(entries, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+func (s *SQLUserService) ImportBatch(ctx context.Context, users []User) ([]error, error) {
+	errs := make([]error, len(users))
+	err := s.inTx(ctx, func(ctx context.Context, tx *sql.Tx) error {
+		// ON CONFLICT DO NOTHING evita que um email duplicado aborte a
+		// transação (no PostgreSQL, qualquer erro invalida o restante dela)
+		pctx, cancel := s.withTimeout(ctx)
+		stmt, err := tx.PrepareContext(pctx, s.dialect.Rebind(
+			"INSERT INTO users (name, email, created_at) VALUES (?, ?, ?) ON CONFLICT (email) DO NOTHING RETURNING "+userColumns,
+		))
+		cancel()
+		if err != nil {
+			return err
+		}
+		defer stmt.Close()
+
+		now := time.Now().UTC()
+		for i, user := range users {
+			qctx, cancel := s.withTimeout(ctx)
+			u, err := scanUser(stmt.QueryRowContext(qctx, user.Name, user.Email, now))
+			cancel()
+			if errors.Is(err, sql.ErrNoRows) {
+				errs[i] = ErrConflict
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			if err := s.audit(ctx, tx, u.ID, AuditCreate, nil, &u); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, s.translate(err)
+	}
+	return errs, nil
+}
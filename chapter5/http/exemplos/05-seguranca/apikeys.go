@@ -0,0 +1,293 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cauelz/full-cycle-golang-expert/pkg/auth"
+)
+
+// apiKeyPrefix identifica as API keys, o que permite reconhecê-las em logs
+// e em scanners de segredos vazados
+const apiKeyPrefix = "sk_live_"
+
+// apiKeyDisplayLen é quanto da chave é guardado em claro, para o usuário
+// reconhecê-la na listagem
+const apiKeyDisplayLen = len(apiKeyPrefix) + 4
+
+// ErrAPIKeyNotFound indica uma API key inexistente ou revogada
+var ErrAPIKeyNotFound = errors.New("API key não encontrada")
+
+// APIKey é o registro de uma API key. Apenas o hash da chave é guardado.
+type APIKey struct {
+	ID     string `json:"id"`
+	UserID string `json:"-"`
+	Name   string `json:"name"`
+	// Prefix é o início da chave, exibido na listagem
+	Prefix string `json:"prefix"`
+	Hash   string `json:"-"`
+	// Scopes são as permissões que a chave pode exercer, dentro das
+	// concedidas pela role do usuário
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+}
+
+// APIKeyStore guarda as API keys
+type APIKeyStore interface {
+	// Create grava uma nova API key
+	Create(ctx context.Context, key APIKey) error
+	// GetByHash busca a API key pelo hash da chave
+	GetByHash(ctx context.Context, hash string) (APIKey, error)
+	// ListByUser retorna as API keys do usuário, da mais antiga para a
+	// mais nova
+	ListByUser(ctx context.Context, userID string) ([]APIKey, error)
+	// Revoke remove a API key. Retorna ErrAPIKeyNotFound se ela não
+	// pertencer ao usuário.
+	Revoke(ctx context.Context, userID, id string) error
+	// Touch registra o último uso da API key
+	Touch(ctx context.Context, id string, at time.Time) error
+}
+
+// MemoryAPIKeyStore é uma implementação de APIKeyStore em memória
+type MemoryAPIKeyStore struct {
+	mu     sync.Mutex
+	keys   map[string]APIKey // ID → API key
+	byHash map[string]string // hash → ID
+}
+
+// NewMemoryAPIKeyStore cria um APIKeyStore em memória vazio
+func NewMemoryAPIKeyStore() *MemoryAPIKeyStore {
+	return &MemoryAPIKeyStore{
+		keys:   make(map[string]APIKey),
+		byHash: make(map[string]string),
+	}
+}
+
+func (s *MemoryAPIKeyStore) Create(ctx context.Context, key APIKey) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys[key.ID] = key
+	s.byHash[key.Hash] = key.ID
+	return nil
+}
+
+func (s *MemoryAPIKeyStore) GetByHash(ctx context.Context, hash string) (APIKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	id, ok := s.byHash[hash]
+	if !ok {
+		return APIKey{}, ErrAPIKeyNotFound
+	}
+	return s.keys[id], nil
+}
+
+func (s *MemoryAPIKeyStore) ListByUser(ctx context.Context, userID string) ([]APIKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	keys := []APIKey{}
+	for _, key := range s.keys {
+		if key.UserID == userID {
+			keys = append(keys, key)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].CreatedAt.Before(keys[j].CreatedAt) })
+	return keys, nil
+}
+
+func (s *MemoryAPIKeyStore) Revoke(ctx context.Context, userID, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key, ok := s.keys[id]
+	if !ok || key.UserID != userID {
+		return ErrAPIKeyNotFound
+	}
+	delete(s.keys, id)
+	delete(s.byHash, key.Hash)
+	return nil
+}
+
+func (s *MemoryAPIKeyStore) Touch(ctx context.Context, id string, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key, ok := s.keys[id]
+	if !ok {
+		return ErrAPIKeyNotFound
+	}
+	key.LastUsedAt = &at
+	s.keys[id] = key
+	return nil
+}
+
+// hashAPIKey calcula o hash guardado no store. Como os refresh tokens, as
+// chaves têm 256 bits aleatórios, então SHA-256 sem salt é suficiente.
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// authenticateAPIKey autentica a requisição pela API key. O Principal é o
+// mesmo de um JWT do usuário, com a role atual, o ID da chave em TokenID e
+// os escopos da chave.
+func (s *Server) authenticateAPIKey(w http.ResponseWriter, r *http.Request, key string) (context.Context, bool) {
+	if !strings.HasPrefix(key, apiKeyPrefix) {
+		http.Error(w, "Invalid API key", http.StatusUnauthorized)
+		return nil, false
+	}
+	apiKey, err := s.apiKeys.GetByHash(r.Context(), hashAPIKey(key))
+	if errors.Is(err, ErrAPIKeyNotFound) {
+		http.Error(w, "Invalid API key", http.StatusUnauthorized)
+		return nil, false
+	}
+	if err != nil {
+		http.Error(w, "Error validating API key", http.StatusInternalServerError)
+		return nil, false
+	}
+
+	// A role é lida a cada requisição, então rebaixar o usuário vale
+	// imediatamente para as chaves dele
+	user, err := s.store.Get(r.Context(), apiKey.UserID)
+	if errors.Is(err, ErrUserNotFound) {
+		http.Error(w, "Invalid API key", http.StatusUnauthorized)
+		return nil, false
+	}
+	if err != nil {
+		http.Error(w, "Error loading user", http.StatusInternalServerError)
+		return nil, false
+	}
+
+	s.apiKeys.Touch(r.Context(), apiKey.ID, s.now())
+
+	return auth.WithPrincipal(r.Context(), auth.Principal{
+		Subject: user.ID,
+		Role:    user.Role,
+		TokenID: apiKey.ID,
+		Scopes:  apiKey.Scopes,
+	}), true
+}
+
+// requireSession recusa requisições autenticadas por API key. As rotas de
+// conta (API keys, MFA, logout) já usam authMiddleware, que não aceita
+// chaves; a verificação no handler protege contra uma rota registrada com
+// apiKeyAuthMiddleware por engano, que deixaria uma chave vazada criar
+// outras ou trocar o segredo TOTP do dono.
+func requireSession(w http.ResponseWriter, r *http.Request) (auth.Principal, bool) {
+	p, ok := auth.PrincipalFrom(r.Context())
+	if !ok {
+		http.Error(w, "Authentication required", http.StatusUnauthorized)
+		return auth.Principal{}, false
+	}
+	if p.Restricted() {
+		http.Error(w, "API keys are not accepted on this route", http.StatusForbidden)
+		return auth.Principal{}, false
+	}
+	return p, true
+}
+
+// createAPIKeyResponse inclui a chave, exibida apenas na criação
+type createAPIKeyResponse struct {
+	APIKey
+	Key string `json:"key"`
+}
+
+// handleCreateAPIKey cria uma API key para o usuário autenticado. Os
+// escopos precisam ser concedidos pela role dele.
+func (s *Server) handleCreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	p, ok := requireSession(w, r)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Name   string   `json:"name"`
+		Scopes []string `json:"scopes"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	req.Name = sanitizeInput(req.Name)
+	if req.Name == "" || len(req.Name) > 100 || len(req.Scopes) == 0 {
+		http.Error(w, "Name and at least one scope are required", http.StatusBadRequest)
+		return
+	}
+	var missing []string
+	for _, scope := range req.Scopes {
+		if !s.policy.Allows(p.Role, scope) {
+			missing = append(missing, scope)
+		}
+	}
+	if len(missing) > 0 {
+		respondForbidden(w, Denial{Reason: denyPermission, Role: p.Role, Required: missing})
+		return
+	}
+
+	secret, err := randomToken(32)
+	if err != nil {
+		http.Error(w, "Error generating API key", http.StatusInternalServerError)
+		return
+	}
+	id, err := randomToken(12)
+	if err != nil {
+		http.Error(w, "Error generating API key", http.StatusInternalServerError)
+		return
+	}
+	key := apiKeyPrefix + secret
+	apiKey := APIKey{
+		ID:        "key_" + id,
+		UserID:    p.Subject,
+		Name:      req.Name,
+		Prefix:    key[:apiKeyDisplayLen],
+		Hash:      hashAPIKey(key),
+		Scopes:    req.Scopes,
+		CreatedAt: s.now(),
+	}
+	if err := s.apiKeys.Create(r.Context(), apiKey); err != nil {
+		http.Error(w, "Error saving API key", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(createAPIKeyResponse{APIKey: apiKey, Key: key})
+}
+
+// handleListAPIKeys lista as API keys do usuário autenticado, sem as chaves
+func (s *Server) handleListAPIKeys(w http.ResponseWriter, r *http.Request) {
+	p, ok := requireSession(w, r)
+	if !ok {
+		return
+	}
+	keys, err := s.apiKeys.ListByUser(r.Context(), p.Subject)
+	if err != nil {
+		http.Error(w, "Error listing API keys", http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(keys)
+}
+
+// handleRevokeAPIKey revoga uma API key do usuário autenticado
+func (s *Server) handleRevokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	p, ok := requireSession(w, r)
+	if !ok {
+		return
+	}
+	err := s.apiKeys.Revoke(r.Context(), p.Subject, r.PathValue("id"))
+	if errors.Is(err, ErrAPIKeyNotFound) {
+		http.Error(w, "API key not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Error revoking API key", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// SQLiteAPIKeyStore implementa APIKeyStore sobre SQLite. As chaves dos jobs
+// continuam valendo depois de um reinício.
+type SQLiteAPIKeyStore struct {
+	db *sql.DB
+}
+
+// NewSQLiteAPIKeyStore cria o store sobre um banco aberto por openSQLite
+func NewSQLiteAPIKeyStore(db *sql.DB) *SQLiteAPIKeyStore {
+	return &SQLiteAPIKeyStore{db: db}
+}
+
+// apiKeyColumns são as colunas lidas por scanAPIKey, na mesma ordem
+const apiKeyColumns = "id, user_id, name, prefix, hash, scopes, created_at, last_used_at"
+
+func scanAPIKey(row rowScanner) (APIKey, error) {
+	var key APIKey
+	var scopes string
+	var created int64
+	var lastUsed sql.NullInt64
+	err := row.Scan(&key.ID, &key.UserID, &key.Name, &key.Prefix, &key.Hash, &scopes, &created, &lastUsed)
+	if errors.Is(err, sql.ErrNoRows) {
+		return APIKey{}, ErrAPIKeyNotFound
+	}
+	if err != nil {
+		return APIKey{}, err
+	}
+	if err := json.Unmarshal([]byte(scopes), &key.Scopes); err != nil {
+		return APIKey{}, err
+	}
+	key.CreatedAt = time.Unix(0, created)
+	if lastUsed.Valid {
+		at := time.Unix(0, lastUsed.Int64)
+		key.LastUsedAt = &at
+	}
+	return key, nil
+}
+
+func (s *SQLiteAPIKeyStore) Create(ctx context.Context, key APIKey) error {
+	scopes, err := json.Marshal(key.Scopes)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.ExecContext(ctx,
+		`INSERT INTO api_keys (id, user_id, name, prefix, hash, scopes, created_at) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		key.ID, key.UserID, key.Name, key.Prefix, key.Hash, string(scopes), key.CreatedAt.UnixNano())
+	return err
+}
+
+func (s *SQLiteAPIKeyStore) GetByHash(ctx context.Context, hash string) (APIKey, error) {
+	return scanAPIKey(s.db.QueryRowContext(ctx,
+		`SELECT `+apiKeyColumns+` FROM api_keys WHERE hash = ?`, hash))
+}
+
+func (s *SQLiteAPIKeyStore) ListByUser(ctx context.Context, userID string) ([]APIKey, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT `+apiKeyColumns+` FROM api_keys WHERE user_id = ? ORDER BY created_at, id`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []APIKey{}
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+func (s *SQLiteAPIKeyStore) Revoke(ctx context.Context, userID, id string) error {
+	return apiKeyErr(execOne(ctx, s.db, `DELETE FROM api_keys WHERE id = ? AND user_id = ?`, id, userID))
+}
+
+func (s *SQLiteAPIKeyStore) Touch(ctx context.Context, id string, at time.Time) error {
+	return apiKeyErr(execOne(ctx, s.db, `UPDATE api_keys SET last_used_at = ? WHERE id = ?`, at.UnixNano(), id))
+}
+
+// apiKeyErr troca o ErrUserNotFound de execOne pelo erro das API keys
+func apiKeyErr(err error) error {
+	if errors.Is(err, ErrUserNotFound) {
+		return ErrAPIKeyNotFound
+	}
+	return err
+}
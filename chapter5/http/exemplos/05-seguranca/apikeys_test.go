@@ -0,0 +1,236 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cauelz/full-cycle-golang-expert/pkg/auth"
+)
+
+// serveAPIKey executa uma requisição autenticada por API key
+func serveAPIKey(t *testing.T, s *Server, method, path, body, key string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Authorization", "ApiKey "+key)
+	rec := httptest.NewRecorder()
+	s.Routes().ServeHTTP(rec, req)
+	return rec
+}
+
+// createAPIKey cria uma API key com os escopos informados
+func createAPIKey(t *testing.T, s *Server, access string, scopes ...string) createAPIKeyResponse {
+	t.Helper()
+	body, _ := json.Marshal(map[string]interface{}{"name": "job noturno", "scopes": scopes})
+	rec := serve(t, s, "POST", "/api-keys", string(body), access)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("POST /api-keys: esperado 201, obtido %d %s", rec.Code, rec.Body)
+	}
+	var created createAPIKeyResponse
+	json.NewDecoder(rec.Body).Decode(&created)
+	return created
+}
+
+func TestAPIKeyLifecycle(t *testing.T) {
+	s := newTestServer(t)
+	access := login(t, s).AccessToken
+
+	created := createAPIKey(t, s, access, PermProfileRead)
+	if !strings.HasPrefix(created.Key, apiKeyPrefix) || !strings.HasPrefix(created.Key, created.Prefix) {
+		t.Fatalf("chave inesperada: %+v", created)
+	}
+
+	// A mesma identidade do JWT
+	rec := serveAPIKey(t, s, "GET", "/protected", "", created.Key)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET /protected com API key: esperado 200, obtido %d", rec.Code)
+	}
+	ana, _ := s.store.GetByUsername(context.Background(), "ana")
+	if !strings.Contains(rec.Body.String(), ana.ID) {
+		t.Errorf("principal inesperado: %s", rec.Body)
+	}
+	// Jobs não têm cookie CSRF
+	if rec := serveAPIKey(t, s, "POST", "/protected", "", created.Key); rec.Code != http.StatusOK {
+		t.Errorf("POST /protected com API key: esperado 200, obtido %d", rec.Code)
+	}
+
+	// A listagem não expõe a chave nem o hash e registra o último uso
+	rec = serve(t, s, "GET", "/api-keys", "", access)
+	if strings.Contains(rec.Body.String(), created.Key) || strings.Contains(rec.Body.String(), hashAPIKey(created.Key)) {
+		t.Errorf("listagem expõe a chave: %s", rec.Body)
+	}
+	var keys []APIKey
+	json.NewDecoder(rec.Body).Decode(&keys)
+	if len(keys) != 1 || keys[0].ID != created.ID || keys[0].LastUsedAt == nil {
+		t.Errorf("listagem inesperada: %+v", keys)
+	}
+
+	// Uma API key não gerencia a conta: as rotas aceitam apenas o JWT
+	for _, route := range []struct{ method, path string }{
+		{"GET", "/api-keys"},
+		{"POST", "/api-keys"},
+		{"POST", "/mfa/enroll"},
+		{"POST", "/mfa/confirm"},
+		{"POST", "/logout"},
+		{"GET", "/csrf"},
+	} {
+		if rec := serveAPIKey(t, s, route.method, route.path, `{}`, created.Key); rec.Code != http.StatusUnauthorized {
+			t.Errorf("%s %s com API key: esperado 401, obtido %d", route.method, route.path, rec.Code)
+		}
+	}
+	if user, _ := s.store.Get(context.Background(), ana.ID); user.TOTPSecret != "" {
+		t.Error("a API key não deveria iniciar o cadastro de MFA")
+	}
+	// O logout recusado não afeta a chave
+	if rec := serveAPIKey(t, s, "GET", "/protected", "", created.Key); rec.Code != http.StatusOK {
+		t.Errorf("API key após logout recusado: esperado 200, obtido %d", rec.Code)
+	}
+
+	// Mesmo se uma rota de conta aceitasse API keys por engano, os handlers
+	// as recusam
+	keyPrincipal := auth.Principal{Subject: ana.ID, Role: ana.Role, TokenID: created.ID, Scopes: created.Scopes}
+	for name, h := range map[string]http.HandlerFunc{
+		"logout":     s.handleLogout,
+		"mfa/enroll": s.handleMFAEnroll,
+		"api-keys":   s.handleListAPIKeys,
+	} {
+		req := httptest.NewRequest("POST", "/", strings.NewReader(`{}`))
+		req = req.WithContext(auth.WithPrincipal(req.Context(), keyPrincipal))
+		rec := httptest.NewRecorder()
+		h(rec, req)
+		if rec.Code != http.StatusForbidden {
+			t.Errorf("%s com principal de API key: esperado 403, obtido %d", name, rec.Code)
+		}
+	}
+
+	// Outro usuário não revoga a chave de ana
+	serve(t, s, "POST", "/users", `{"username":"bruno","password":"senha-do-bruno"}`, "")
+	rec = serve(t, s, "POST", "/login", `{"username":"bruno","password":"senha-do-bruno"}`, "")
+	var bruno tokenResponse
+	json.NewDecoder(rec.Body).Decode(&bruno)
+	if rec := serve(t, s, "DELETE", "/api-keys/"+created.ID, "", bruno.AccessToken); rec.Code != http.StatusNotFound {
+		t.Errorf("revogação por outro usuário: esperado 404, obtido %d", rec.Code)
+	}
+
+	if rec := serve(t, s, "DELETE", "/api-keys/"+created.ID, "", access); rec.Code != http.StatusNoContent {
+		t.Fatalf("revogação: esperado 204, obtido %d", rec.Code)
+	}
+	if rec := serveAPIKey(t, s, "GET", "/protected", "", created.Key); rec.Code != http.StatusUnauthorized {
+		t.Errorf("API key revogada: esperado 401, obtido %d", rec.Code)
+	}
+	if rec := serveAPIKey(t, s, "GET", "/protected", "", apiKeyPrefix+"inventada"); rec.Code != http.StatusUnauthorized {
+		t.Errorf("API key inexistente: esperado 401, obtido %d", rec.Code)
+	}
+}
+
+func TestAPIKeyScopes(t *testing.T) {
+	s := newTestServer(t)
+	admin := loginAdmin(t, s)
+
+	// Escopos além da role são recusados
+	rec := serve(t, s, "POST", "/api-keys", `{"name":"x","scopes":["users:read"]}`, login(t, s).AccessToken)
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("escopo além da role: esperado 403, obtido %d", rec.Code)
+	}
+	if rec := serve(t, s, "POST", "/api-keys", `{"name":"x","scopes":[]}`, admin); rec.Code != http.StatusBadRequest {
+		t.Errorf("sem escopos: esperado 400, obtido %d", rec.Code)
+	}
+
+	// Mesmo de um admin, a chave só exerce os próprios escopos
+	readOnly := createAPIKey(t, s, admin, PermUsersRead)
+	if rec := serveAPIKey(t, s, "GET", "/admin/users", "", readOnly.Key); rec.Code != http.StatusOK {
+		t.Errorf("users:read: esperado 200, obtido %d", rec.Code)
+	}
+	ana, _ := s.store.GetByUsername(context.Background(), "ana")
+	rec = serveAPIKey(t, s, "PUT", "/admin/users/"+ana.ID+"/role", `{"role":"admin"}`, readOnly.Key)
+	var denial Denial
+	json.NewDecoder(rec.Body).Decode(&denial)
+	if rec.Code != http.StatusForbidden || denial.Reason != denyScope {
+		t.Errorf("users:write fora do escopo: esperado 403 %s, obtido %d %+v", denyScope, rec.Code, denial)
+	}
+
+	// Rebaixar o dono vale imediatamente para a chave
+	root, _ := s.store.GetByUsername(context.Background(), "root")
+	s.store.SetRole(context.Background(), root.ID, "user")
+	if rec := serveAPIKey(t, s, "GET", "/admin/users", "", readOnly.Key); rec.Code != http.StatusForbidden {
+		t.Errorf("dono rebaixado: esperado 403, obtido %d", rec.Code)
+	}
+}
+
+// apiKeyStores retorna uma instância nova de cada implementação
+func apiKeyStores(t *testing.T) map[string]APIKeyStore {
+	t.Helper()
+	db, err := openSQLite(context.Background(), filepath.Join(t.TempDir(), "api_keys.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return map[string]APIKeyStore{
+		"memory": NewMemoryAPIKeyStore(),
+		"sqlite": NewSQLiteAPIKeyStore(db),
+	}
+}
+
+func TestAPIKeyStore(t *testing.T) {
+	ctx := context.Background()
+	now := time.Unix(1_700_000_000, 123)
+	for name, store := range apiKeyStores(t) {
+		t.Run(name, func(t *testing.T) {
+			first := APIKey{ID: "k1", UserID: "u1", Name: "backup", Prefix: "sk_live_abcd", Hash: "h1",
+				Scopes: []string{PermProfileRead}, CreatedAt: now}
+			second := APIKey{ID: "k2", UserID: "u1", Name: "relatório", Prefix: "sk_live_efgh", Hash: "h2",
+				Scopes: []string{PermProfileRead, PermUsersRead}, CreatedAt: now.Add(time.Minute)}
+			for _, key := range []APIKey{second, first, {ID: "k3", UserID: "u2", Hash: "h3", CreatedAt: now}} {
+				if err := store.Create(ctx, key); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			got, err := store.GetByHash(ctx, "h1")
+			if err != nil || !reflect.DeepEqual(got, first) {
+				t.Errorf("GetByHash: obtido %+v (%v)", got, err)
+			}
+			if _, err := store.GetByHash(ctx, "inexistente"); !errors.Is(err, ErrAPIKeyNotFound) {
+				t.Errorf("GetByHash inexistente: esperado ErrAPIKeyNotFound, obtido %v", err)
+			}
+
+			// Da mais antiga para a mais nova, só as do usuário
+			keys, err := store.ListByUser(ctx, "u1")
+			if err != nil || len(keys) != 2 || keys[0].ID != "k1" || keys[1].ID != "k2" {
+				t.Errorf("ListByUser: obtido %+v (%v)", keys, err)
+			}
+			if keys, _ := store.ListByUser(ctx, "ninguém"); keys == nil || len(keys) != 0 {
+				t.Errorf("ListByUser sem chaves: esperado lista vazia, obtido %#v", keys)
+			}
+
+			used := now.Add(time.Hour)
+			if err := store.Touch(ctx, "k1", used); err != nil {
+				t.Fatal(err)
+			}
+			if got, _ := store.GetByHash(ctx, "h1"); got.LastUsedAt == nil || !got.LastUsedAt.Equal(used) {
+				t.Errorf("Touch: obtido %+v", got.LastUsedAt)
+			}
+			if err := store.Touch(ctx, "inexistente", used); !errors.Is(err, ErrAPIKeyNotFound) {
+				t.Errorf("Touch inexistente: esperado ErrAPIKeyNotFound, obtido %v", err)
+			}
+
+			// Só o dono revoga a chave
+			if err := store.Revoke(ctx, "u2", "k1"); !errors.Is(err, ErrAPIKeyNotFound) {
+				t.Errorf("Revoke por outro usuário: esperado ErrAPIKeyNotFound, obtido %v", err)
+			}
+			if err := store.Revoke(ctx, "u1", "k1"); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := store.GetByHash(ctx, "h1"); !errors.Is(err, ErrAPIKeyNotFound) {
+				t.Errorf("chave revogada: esperado ErrAPIKeyNotFound, obtido %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// IPResolver descobre o IP do cliente. Headers de encaminhamento
+// (Forwarded, X-Forwarded-For e X-Real-IP) só são considerados quando a
+// conexão vem de um proxy confiável; caso contrário qualquer cliente
+// poderia escolher o próprio IP e escapar do rate limiting.
+//
+// Um *IPResolver nil não confia em nenhum proxy e usa apenas RemoteAddr.
+type IPResolver struct {
+	trusted []*net.IPNet
+}
+
+// NewIPResolver cria o resolver com os proxies confiáveis, em notação CIDR
+// ("10.0.0.0/8") ou como IP isolado ("192.0.2.1")
+func NewIPResolver(proxies ...string) (*IPResolver, error) {
+	r := &IPResolver{}
+	for _, p := range proxies {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+		if !strings.Contains(p, "/") {
+			ip := net.ParseIP(p)
+			if ip == nil {
+				return nil, fmt.Errorf("proxy confiável inválido: %q", p)
+			}
+			bits := 128
+			if ip.To4() != nil {
+				bits = 32
+			}
+			p = fmt.Sprintf("%s/%d", p, bits)
+		}
+		_, network, err := net.ParseCIDR(p)
+		if err != nil {
+			return nil, fmt.Errorf("proxy confiável inválido: %q", p)
+		}
+		r.trusted = append(r.trusted, network)
+	}
+	return r, nil
+}
+
+// isTrusted informa se o IP pertence a um proxy confiável
+func (r *IPResolver) isTrusted(ip net.IP) bool {
+	if r == nil {
+		return false
+	}
+	for _, network := range r.trusted {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// ClientIP retorna o IP do cliente.
+//
+// Partindo de RemoteAddr, a cadeia de encaminhamento é percorrida da direita
+// para a esquerda enquanto o salto atual for um proxy confiável: cada proxy
+// acrescenta à direita o endereço de quem se conectou a ele, então só as
+// entradas adicionadas por proxies confiáveis merecem crédito. O primeiro
+// endereço que não é de proxy confiável é o cliente. Entradas inválidas
+// interrompem a busca.
+func (r *IPResolver) ClientIP(req *http.Request) string {
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		host = req.RemoteAddr
+	}
+	client := parseIP(host)
+	if client == nil {
+		return host
+	}
+	if !r.isTrusted(client) {
+		return client.String()
+	}
+
+	for _, hop := range r.forwardedChain(req) {
+		ip := parseIP(hop)
+		if ip == nil {
+			break
+		}
+		client = ip
+		if !r.isTrusted(ip) {
+			break
+		}
+	}
+	return client.String()
+}
+
+// forwardedChain retorna os endereços encaminhados, do mais recente (à
+// direita) para o mais antigo. Forwarded (RFC 7239) tem precedência sobre
+// X-Forwarded-For, que tem precedência sobre X-Real-IP.
+func (r *IPResolver) forwardedChain(req *http.Request) []string {
+	var hops []string
+	if values := req.Header.Values("Forwarded"); len(values) > 0 {
+		hops = parseForwarded(strings.Join(values, ","))
+	} else if values := req.Header.Values("X-Forwarded-For"); len(values) > 0 {
+		for _, part := range strings.Split(strings.Join(values, ","), ",") {
+			hops = append(hops, strings.TrimSpace(part))
+		}
+	} else if real := req.Header.Get("X-Real-IP"); real != "" {
+		hops = []string{strings.TrimSpace(real)}
+	}
+
+	for i, j := 0, len(hops)-1; i < j; i, j = i+1, j-1 {
+		hops[i], hops[j] = hops[j], hops[i]
+	}
+	return hops
+}
+
+// parseForwarded extrai o parâmetro for de cada elemento do header
+// Forwarded, na ordem em que aparecem:
+//
+//	Forwarded: for=192.0.2.60;proto=https, for="[2001:db8::17]:4711"
+//
+// Elementos sem for produzem uma entrada vazia, que interrompe a busca.
+func parseForwarded(header string) []string {
+	var hops []string
+	for _, element := range strings.Split(header, ",") {
+		var hop string
+		for _, pair := range strings.Split(element, ";") {
+			key, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+			if ok && strings.EqualFold(key, "for") {
+				hop = strings.Trim(value, `"`)
+			}
+		}
+		hops = append(hops, hop)
+	}
+	return hops
+}
+
+// parseIP interpreta um endereço com ou sem porta, aceitando IPv6 entre
+// colchetes ("[2001:db8::1]:443"). Identificadores ofuscados da RFC 7239
+// ("unknown", "_proxy1") retornam nil.
+func parseIP(s string) net.IP {
+	if host, _, err := net.SplitHostPort(s); err == nil {
+		s = host
+	}
+	s = strings.TrimSuffix(strings.TrimPrefix(s, "["), "]")
+	return net.ParseIP(s)
+}
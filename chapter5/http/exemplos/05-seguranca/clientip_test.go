@@ -0,0 +1,89 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+func TestClientIP(t *testing.T) {
+	resolver, err := NewIPResolver("10.0.0.0/8", "2001:db8:ffff::/48", "192.0.2.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		remote  string
+		headers map[string]string
+		want    string
+	}{
+		{"sem proxy", "203.0.113.7:5000", nil, "203.0.113.7"},
+		{"IPv6 em RemoteAddr", "[2001:db8::1]:5000", nil, "2001:db8::1"},
+		{"XFF de cliente não confiável é ignorado", "203.0.113.7:5000",
+			map[string]string{"X-Forwarded-For": "1.2.3.4"}, "203.0.113.7"},
+		{"XFF de proxy confiável", "10.0.0.1:80",
+			map[string]string{"X-Forwarded-For": "203.0.113.7"}, "203.0.113.7"},
+		{"XFF forjado pelo cliente antes do proxy", "10.0.0.1:80",
+			map[string]string{"X-Forwarded-For": "1.2.3.4, 203.0.113.7"}, "203.0.113.7"},
+		{"cadeia de proxies confiáveis", "10.0.0.1:80",
+			map[string]string{"X-Forwarded-For": "203.0.113.7, 192.0.2.1, 10.0.0.2"}, "203.0.113.7"},
+		{"entrada inválida interrompe a busca", "10.0.0.1:80",
+			map[string]string{"X-Forwarded-For": "203.0.113.7, lixo, 10.0.0.2"}, "10.0.0.2"},
+		{"todos confiáveis", "10.0.0.1:80",
+			map[string]string{"X-Forwarded-For": "10.0.0.3, 10.0.0.2"}, "10.0.0.3"},
+		{"X-Real-IP de proxy confiável", "10.0.0.1:80",
+			map[string]string{"X-Real-IP": "203.0.113.7"}, "203.0.113.7"},
+		{"Forwarded", "10.0.0.1:80",
+			map[string]string{"Forwarded": `for=1.2.3.4, for="[2001:db8:cafe::17]:4711";proto=https, for=10.0.0.2`}, "2001:db8:cafe::17"},
+		{"Forwarded tem precedência", "10.0.0.1:80",
+			map[string]string{"Forwarded": "for=203.0.113.7", "X-Forwarded-For": "1.2.3.4"}, "203.0.113.7"},
+		{"Forwarded ofuscado", "10.0.0.1:80",
+			map[string]string{"Forwarded": "for=_oculto"}, "10.0.0.1"},
+		{"proxy IPv6 confiável", "[2001:db8:ffff::1]:443",
+			map[string]string{"X-Forwarded-For": "2001:db8::42"}, "2001:db8::42"},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = tt.remote
+		for k, v := range tt.headers {
+			req.Header.Set(k, v)
+		}
+		if got := resolver.ClientIP(req); got != tt.want {
+			t.Errorf("%s: esperado %s, obtido %s", tt.name, tt.want, got)
+		}
+	}
+}
+
+func TestNewIPResolverInvalid(t *testing.T) {
+	for _, proxy := range []string{"10.0.0.0/33", "proxy.local"} {
+		if _, err := NewIPResolver(proxy); err == nil {
+			t.Errorf("%q: esperado erro", proxy)
+		}
+	}
+}
+
+func TestRateLimitIgnoresSpoofedHeader(t *testing.T) {
+	limiter := NewIPRateLimiter(rate.Every(time.Hour), 1)
+	h := limiter.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	// Trocar o X-Forwarded-For não libera novas requisições
+	for i, xff := range []string{"1.1.1.1", "2.2.2.2"} {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = "203.0.113.7:5000"
+		req.Header.Set("X-Forwarded-For", xff)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+
+		want := http.StatusOK
+		if i > 0 {
+			want = http.StatusTooManyRequests
+		}
+		if rec.Code != want {
+			t.Errorf("requisição %d: esperado %d, obtido %d", i+1, want, rec.Code)
+		}
+	}
+}
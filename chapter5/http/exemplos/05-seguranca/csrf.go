@@ -0,0 +1,222 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cauelz/full-cycle-golang-expert/pkg/auth"
+)
+
+// CSRFConfig configura a proteção CSRF (double-submit cookie com tokens
+// assinados)
+type CSRFConfig struct {
+	CookieName string
+	HeaderName string
+	// FormField é o campo aceito em formulários HTML, como alternativa ao header
+	FormField string
+	// MaxAge é a validade de um token
+	MaxAge time.Duration
+	// ExemptPaths não exigem token. Um "*" final casa qualquer sufixo:
+	// "/webhooks/*".
+	ExemptPaths []string
+	// CheckOrigin confere Origin (ou Referer, na falta dele) em requisições
+	// que alteram estado
+	CheckOrigin bool
+	// TrustedOrigins são origens aceitas além da do próprio servidor,
+	// como "https://app.exemplo.com"
+	TrustedOrigins []string
+}
+
+// DefaultCSRFConfig retorna a configuração padrão
+func DefaultCSRFConfig() CSRFConfig {
+	return CSRFConfig{
+		// O prefixo __Host- impede que um subdomínio plante o cookie
+		CookieName:  "__Host-csrf_token",
+		HeaderName:  "X-CSRF-Token",
+		FormField:   "csrf_token",
+		MaxAge:      12 * time.Hour,
+		CheckOrigin: true,
+	}
+}
+
+// csrfSessionID é a sessão à qual o token fica vinculado: o jti do access
+// token ou o ID da sessão por cookie, ou vazio para requisições anônimas.
+// Um token emitido para uma sessão não vale em outra, nem do mesmo usuário,
+// e deixa de valer no logout.
+func csrfSessionID(r *http.Request) string {
+	if p, ok := auth.PrincipalFrom(r.Context()); ok {
+		return p.TokenID
+	}
+	return ""
+}
+
+// csrfMAC assina o nonce e o instante de emissão vinculados à sessão
+func (s *Server) csrfMAC(sessionID, nonce, issued string) []byte {
+	mac := hmac.New(sha256.New, s.csrfSecret)
+	mac.Write([]byte(sessionID + "|" + nonce + "|" + issued))
+	return mac.Sum(nil)
+}
+
+// generateCSRFToken gera um token no formato <nonce>.<emissão>.<hmac>
+func (s *Server) generateCSRFToken(sessionID string) (string, error) {
+	nonce, err := randomToken(16)
+	if err != nil {
+		return "", err
+	}
+	issued := strconv.FormatInt(s.now().Unix(), 10)
+	sig := base64.RawURLEncoding.EncodeToString(s.csrfMAC(sessionID, nonce, issued))
+	return nonce + "." + issued + "." + sig, nil
+}
+
+// validateCSRFToken confere se o token enviado é o mesmo do cookie, se a
+// assinatura corresponde à sessão e se o token não expirou. As comparações
+// são feitas em tempo constante.
+func (s *Server) validateCSRFToken(token, cookieToken, sessionID string) bool {
+	if token == "" || !hmac.Equal([]byte(token), []byte(cookieToken)) {
+		return false
+	}
+
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return false
+	}
+	nonce, issued, sig := parts[0], parts[1], parts[2]
+
+	got, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil || !hmac.Equal(got, s.csrfMAC(sessionID, nonce, issued)) {
+		return false
+	}
+
+	unix, err := strconv.ParseInt(issued, 10, 64)
+	if err != nil {
+		return false
+	}
+	return s.now().Sub(time.Unix(unix, 0)) < s.csrfConfig.MaxAge
+}
+
+// csrfExempt informa se o caminho dispensa o token
+func (s *Server) csrfExempt(path string) bool {
+	for _, exempt := range s.csrfConfig.ExemptPaths {
+		if prefix, ok := strings.CutSuffix(exempt, "*"); ok {
+			if strings.HasPrefix(path, prefix) {
+				return true
+			}
+		} else if path == exempt {
+			return true
+		}
+	}
+	return false
+}
+
+// originAllowed confere Origin, ou Referer quando Origin não vem. Sem
+// nenhum dos dois (clientes que não são navegadores), a decisão fica com o
+// token.
+func (s *Server) originAllowed(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		referer := r.Header.Get("Referer")
+		if referer == "" {
+			return true
+		}
+		u, err := url.Parse(referer)
+		if err != nil || u.Host == "" {
+			return false
+		}
+		origin = u.Scheme + "://" + u.Host
+	}
+
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	if origin == scheme+"://"+r.Host {
+		return true
+	}
+	for _, trusted := range s.csrfConfig.TrustedOrigins {
+		if origin == trusted {
+			return true
+		}
+	}
+	return false
+}
+
+// setCSRFCookie grava o token em um cookie legível pelo JavaScript, que
+// precisa copiá-lo para o header
+func (s *Server) setCSRFCookie(w http.ResponseWriter, token string) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     s.csrfConfig.CookieName,
+		Value:    token,
+		Path:     "/",
+		MaxAge:   int(s.csrfConfig.MaxAge.Seconds()),
+		HttpOnly: false,
+		Secure:   true,
+		SameSite: http.SameSiteStrictMode,
+	})
+}
+
+// handleCSRFToken emite um token novo em GET /csrf, no cookie e no corpo
+func (s *Server) handleCSRFToken(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	token, err := s.generateCSRFToken(csrfSessionID(r))
+	if err != nil {
+		http.Error(w, "Error generating CSRF token", http.StatusInternalServerError)
+		return
+	}
+	s.setCSRFCookie(w, token)
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(map[string]string{"csrf_token": token})
+}
+
+// csrfMiddleware exige o token em requisições que alteram estado. O token
+// pode vir no header ou, em formulários, no campo configurado.
+func (s *Server) csrfMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case "GET", "HEAD", "OPTIONS", "TRACE":
+			next.ServeHTTP(w, r)
+			return
+		}
+		if s.csrfExempt(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		// API keys são usadas por jobs, não por navegadores, e nunca são
+		// enviadas automaticamente
+		if p, ok := auth.PrincipalFrom(r.Context()); ok && p.Restricted() {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if s.csrfConfig.CheckOrigin && !s.originAllowed(r) {
+			http.Error(w, "Cross-origin request rejected", http.StatusForbidden)
+			return
+		}
+
+		cookie, err := r.Cookie(s.csrfConfig.CookieName)
+		if err != nil {
+			http.Error(w, "CSRF cookie not found", http.StatusForbidden)
+			return
+		}
+
+		token := r.Header.Get(s.csrfConfig.HeaderName)
+		if token == "" && s.csrfConfig.FormField != "" {
+			token = r.PostFormValue(s.csrfConfig.FormField)
+		}
+		if !s.validateCSRFToken(token, cookie.Value, csrfSessionID(r)) {
+			http.Error(w, "Invalid CSRF token", http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fetchCSRF busca um token em GET /csrf
+func fetchCSRF(t *testing.T, s *Server, bearer string) string {
+	t.Helper()
+	rec := serve(t, s, "GET", "/csrf", "", bearer)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET /csrf: esperado 200, obtido %d", rec.Code)
+	}
+	var body map[string]string
+	json.NewDecoder(rec.Body).Decode(&body)
+
+	cookies := rec.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].HttpOnly || cookies[0].Value != body["csrf_token"] {
+		t.Fatalf("cookie inesperado: %+v", cookies)
+	}
+	return body["csrf_token"]
+}
+
+// postProtected envia POST /protected com o cookie e, se informados, o
+// header e os headers extras
+func postProtected(s *Server, bearer, cookie, header string, extra map[string]string) int {
+	req := httptest.NewRequest("POST", "/protected", nil)
+	req.Header.Set("Authorization", "Bearer "+bearer)
+	if cookie != "" {
+		req.AddCookie(&http.Cookie{Name: s.csrfConfig.CookieName, Value: cookie})
+	}
+	if header != "" {
+		req.Header.Set("X-CSRF-Token", header)
+	}
+	for k, v := range extra {
+		req.Header.Set(k, v)
+	}
+	rec := httptest.NewRecorder()
+	s.Routes().ServeHTTP(rec, req)
+	return rec.Code
+}
+
+func TestCSRF(t *testing.T) {
+	s := newTestServer(t)
+	access := login(t, s).AccessToken
+	token := fetchCSRF(t, s, access)
+
+	// Troca o primeiro caractere do nonce, mantendo a assinatura
+	tampered := "A" + token[1:]
+	if tampered == token {
+		tampered = "B" + token[1:]
+	}
+	tests := []struct {
+		name           string
+		cookie, header string
+		extra          map[string]string
+		want           int
+	}{
+		{"token válido", token, token, nil, http.StatusOK},
+		{"sem cookie", "", token, nil, http.StatusForbidden},
+		{"sem header", token, "", nil, http.StatusForbidden},
+		{"header diferente do cookie", token, "outro", nil, http.StatusForbidden},
+		{"assinatura adulterada", tampered, tampered, nil, http.StatusForbidden},
+		{"mesma origem", token, token, map[string]string{"Origin": "http://example.com"}, http.StatusOK},
+		{"outra origem", token, token, map[string]string{"Origin": "https://evil.example"}, http.StatusForbidden},
+		{"referer de outra origem", token, token, map[string]string{"Referer": "https://evil.example/form"}, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		if got := postProtected(s, access, tt.cookie, tt.header, tt.extra); got != tt.want {
+			t.Errorf("%s: esperado %d, obtido %d", tt.name, tt.want, got)
+		}
+	}
+}
+
+func TestCSRFFormField(t *testing.T) {
+	s := newTestServer(t)
+	access := login(t, s).AccessToken
+	token := fetchCSRF(t, s, access)
+
+	form := url.Values{"csrf_token": {token}}.Encode()
+	req := httptest.NewRequest("POST", "/protected", strings.NewReader(form))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Authorization", "Bearer "+access)
+	req.AddCookie(&http.Cookie{Name: s.csrfConfig.CookieName, Value: token})
+	rec := httptest.NewRecorder()
+	s.Routes().ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Errorf("token no formulário: esperado 200, obtido %d", rec.Code)
+	}
+}
+
+func TestCSRFBoundToSession(t *testing.T) {
+	s := newTestServer(t)
+	serve(t, s, "POST", "/users", `{"username":"bruno","password":"outra-senha"}`, "")
+	rec := serve(t, s, "POST", "/login", `{"username":"bruno","password":"outra-senha"}`, "")
+	var bruno tokenResponse
+	json.NewDecoder(rec.Body).Decode(&bruno)
+
+	// Um token emitido para bruno não vale na sessão de ana
+	token := fetchCSRF(t, s, bruno.AccessToken)
+	if got := postProtected(s, login(t, s).AccessToken, token, token, nil); got != http.StatusForbidden {
+		t.Errorf("token de outro usuário: esperado 403, obtido %d", got)
+	}
+
+	// Nem em outra sessão do próprio bruno
+	rec = serve(t, s, "POST", "/login", `{"username":"bruno","password":"outra-senha"}`, "")
+	var again tokenResponse
+	json.NewDecoder(rec.Body).Decode(&again)
+	if got := postProtected(s, again.AccessToken, token, token, nil); got != http.StatusForbidden {
+		t.Errorf("token de outra sessão do mesmo usuário: esperado 403, obtido %d", got)
+	}
+	if got := postProtected(s, bruno.AccessToken, token, token, nil); got != http.StatusOK {
+		t.Errorf("token da própria sessão: esperado 200, obtido %d", got)
+	}
+}
+
+func TestCSRFExpiry(t *testing.T) {
+	s := newTestServer(t)
+	access := login(t, s).AccessToken
+	token := fetchCSRF(t, s, access)
+	claims, err := s.validateToken(access, accessTokenAudience)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !s.validateCSRFToken(token, token, claims.Id) {
+		t.Fatal("token recém-emitido deveria ser aceito")
+	}
+
+	now := time.Now().Add(s.csrfConfig.MaxAge + time.Minute)
+	s.now = func() time.Time { return now }
+	if s.validateCSRFToken(token, token, claims.Id) {
+		t.Error("token expirado deveria ser rejeitado")
+	}
+}
+
+func TestCSRFConfig(t *testing.T) {
+	s := newTestServer(t)
+	access := login(t, s).AccessToken
+	token := fetchCSRF(t, s, access)
+
+	s.csrfConfig.TrustedOrigins = []string{"https://app.example"}
+	if got := postProtected(s, access, token, token, map[string]string{"Origin": "https://app.example"}); got != http.StatusOK {
+		t.Errorf("origem confiável: esperado 200, obtido %d", got)
+	}
+
+	s.csrfConfig.CheckOrigin = false
+	if got := postProtected(s, access, token, token, map[string]string{"Origin": "https://evil.example"}); got != http.StatusOK {
+		t.Errorf("sem checagem de origem: esperado 200, obtido %d", got)
+	}
+
+	s.csrfConfig.ExemptPaths = []string{"/prot*"}
+	if got := postProtected(s, access, "", "", nil); got != http.StatusOK {
+		t.Errorf("rota isenta: esperado 200, obtido %d", got)
+	}
+}
@@ -3,6 +3,13 @@ module seguranca
 go 1.22
 
 require (
+	github.com/cauelz/full-cycle-golang-expert/pkg v0.0.0
 	github.com/golang-jwt/jwt v3.2.2+incompatible
+	github.com/mattn/go-sqlite3 v1.14.28
+	golang.org/x/crypto v0.23.0
 	golang.org/x/time v0.5.0
 )
+
+require golang.org/x/sys v0.20.0 // indirect
+
+replace github.com/cauelz/full-cycle-golang-expert/pkg => ../../../../pkg
@@ -0,0 +1,313 @@
+package main
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+)
+
+var (
+	// ErrNoActiveKey indica que nenhuma chave está ativa no momento
+	ErrNoActiveKey = errors.New("nenhuma chave de assinatura ativa")
+	// ErrUnknownKey indica um kid desconhecido ou de chave já aposentada
+	ErrUnknownKey = errors.New("chave de assinatura desconhecida")
+)
+
+// SigningKey é uma chave de assinatura de JWT identificada pelo kid
+type SigningKey struct {
+	ID     string
+	Method jwt.SigningMethod
+	// Private assina os tokens: []byte (HS256), *rsa.PrivateKey,
+	// *ecdsa.PrivateKey ou ed25519.PrivateKey
+	Private interface{}
+	// Public verifica os tokens; em HS256 é o próprio segredo
+	Public interface{}
+	// NotBefore é quando a chave passa a assinar novos tokens
+	NotBefore time.Time
+}
+
+// KeyManager escolhe a chave ativa segundo o agendamento de rotação e
+// resolve as chaves de verificação pelo kid.
+//
+// As chaves são ordenadas por NotBefore. A ativa é a mais recente cujo
+// NotBefore já passou. Uma chave substituída continua aceita para
+// verificação (e publicada no JWKS) por retention, tempo suficiente para
+// os tokens assinados por ela expirarem. Chaves futuras também são
+// publicadas, para que os clientes as conheçam antes da rotação.
+//
+// As chaves são fixas após a construção, o que dispensa lock. Rotações já
+// previstas no keys.json acontecem sozinhas pelo NotBefore, mas incluir uma
+// chave nova exige reiniciar o processo. Dê a ela um NotBefore futuro, para
+// que todas as réplicas já a tenham carregado quando ela passar a assinar.
+type KeyManager struct {
+	keys      []*SigningKey
+	retention time.Duration
+	now       func() time.Time
+}
+
+// NewKeyManager cria o gerenciador com as chaves e o tempo de retenção.
+// Retorna ErrNoActiveKey se nenhuma chave puder assinar agora, para que o
+// servidor falhe na inicialização e não no primeiro login.
+func NewKeyManager(keys []*SigningKey, retention time.Duration) (*KeyManager, error) {
+	if len(keys) == 0 {
+		return nil, ErrNoActiveKey
+	}
+	seen := make(map[string]bool)
+	for _, k := range keys {
+		if seen[k.ID] {
+			return nil, fmt.Errorf("kid duplicado: %s", k.ID)
+		}
+		seen[k.ID] = true
+	}
+
+	sorted := append([]*SigningKey(nil), keys...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].NotBefore.Before(sorted[j].NotBefore)
+	})
+	m := &KeyManager{keys: sorted, retention: retention, now: time.Now}
+	if m.active(m.now()) < 0 {
+		return nil, ErrNoActiveKey
+	}
+	return m, nil
+}
+
+// active retorna o índice da chave ativa em now, ou -1.
+func (m *KeyManager) active(now time.Time) int {
+	idx := -1
+	for i, k := range m.keys {
+		if !k.NotBefore.After(now) {
+			idx = i
+		}
+	}
+	return idx
+}
+
+// usable informa se a chave de índice i ainda pode verificar tokens em now:
+// a ativa, as futuras e as substituídas há menos de retention.
+func (m *KeyManager) usable(i, active int, now time.Time) bool {
+	if i >= active {
+		return true
+	}
+	replacedAt := m.keys[i+1].NotBefore
+	return now.Before(replacedAt.Add(m.retention))
+}
+
+// Active retorna a chave que deve assinar novos tokens
+func (m *KeyManager) Active() (*SigningKey, error) {
+	i := m.active(m.now())
+	if i < 0 {
+		return nil, ErrNoActiveKey
+	}
+	return m.keys[i], nil
+}
+
+// Lookup retorna a chave de verificação do kid, se ainda estiver em uso
+func (m *KeyManager) Lookup(kid string) (*SigningKey, error) {
+	now := m.now()
+	active := m.active(now)
+	for i, k := range m.keys {
+		if k.ID == kid && m.usable(i, active, now) {
+			return k, nil
+		}
+	}
+	return nil, ErrUnknownKey
+}
+
+// Sign assina os claims com a chave ativa, incluindo o kid no header
+func (m *KeyManager) Sign(claims jwt.Claims) (string, error) {
+	key, err := m.Active()
+	if err != nil {
+		return "", err
+	}
+	token := jwt.NewWithClaims(key.Method, claims)
+	token.Header["kid"] = key.ID
+	return token.SignedString(key.Private)
+}
+
+// Keyfunc resolve a chave de verificação pelo kid do token. O algoritmo do
+// token precisa ser o da chave, o que impede ataques de troca de algoritmo
+// (por exemplo, um HS256 assinado com a chave pública RSA).
+func (m *KeyManager) Keyfunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" {
+		return nil, fmt.Errorf("token sem kid")
+	}
+	key, err := m.Lookup(kid)
+	if err != nil {
+		return nil, err
+	}
+	if token.Method.Alg() != key.Method.Alg() {
+		return nil, fmt.Errorf("método de assinatura inesperado: %v", token.Header["alg"])
+	}
+	return key.Public, nil
+}
+
+// JWK é uma chave pública no formato da RFC 7517
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+// JWKS retorna as chaves públicas em uso. Chaves HS256 são segredos e
+// nunca são publicadas.
+func (m *KeyManager) JWKS() []JWK {
+	now := m.now()
+	active := m.active(now)
+
+	b64 := base64.RawURLEncoding
+	jwks := []JWK{}
+	for i, k := range m.keys {
+		if !m.usable(i, active, now) {
+			continue
+		}
+		jwk := JWK{Kid: k.ID, Use: "sig", Alg: k.Method.Alg()}
+		switch pub := k.Public.(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = b64.EncodeToString(pub.N.Bytes())
+			jwk.E = b64.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+		case *ecdsa.PublicKey:
+			size := (pub.Curve.Params().BitSize + 7) / 8
+			jwk.Kty = "EC"
+			jwk.Crv = pub.Curve.Params().Name
+			jwk.X = b64.EncodeToString(pub.X.FillBytes(make([]byte, size)))
+			jwk.Y = b64.EncodeToString(pub.Y.FillBytes(make([]byte, size)))
+		case ed25519.PublicKey:
+			jwk.Kty = "OKP"
+			jwk.Crv = "Ed25519"
+			jwk.X = b64.EncodeToString(pub)
+		default:
+			continue
+		}
+		jwks = append(jwks, jwk)
+	}
+	return jwks
+}
+
+// ServeJWKS publica as chaves em GET /.well-known/jwks.json
+func (m *KeyManager) ServeJWKS(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	// Cache curto: clientes voltam a buscar logo após uma rotação
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	json.NewEncoder(w).Encode(map[string][]JWK{"keys": m.JWKS()})
+}
+
+// keyManifestEntry descreve uma chave no keys.json
+type keyManifestEntry struct {
+	Kid       string    `json:"kid"`
+	Alg       string    `json:"alg"`
+	File      string    `json:"file"`
+	NotBefore time.Time `json:"not_before"`
+}
+
+// LoadKeys lê as chaves descritas em dir/keys.json:
+//
+//	[
+//	  {"kid": "2026-01", "alg": "ES256", "file": "2026-01.pem", "not_before": "2026-01-01T00:00:00Z"},
+//	  {"kid": "2026-04", "alg": "ES256", "file": "2026-04.pem", "not_before": "2026-04-01T00:00:00Z"}
+//	]
+//
+// Chaves RS256, ES256 e EdDSA são arquivos PEM com a chave privada; chaves
+// HS256 são arquivos com o segredo bruto. Todas as réplicas que leem o
+// mesmo diretório assinam com a mesma chave e rotacionam juntas.
+func LoadKeys(dir string) ([]*SigningKey, error) {
+	data, err := os.ReadFile(filepath.Join(dir, "keys.json"))
+	if err != nil {
+		return nil, err
+	}
+	var manifest []keyManifestEntry
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("keys.json inválido: %w", err)
+	}
+
+	keys := make([]*SigningKey, 0, len(manifest))
+	for _, e := range manifest {
+		raw, err := os.ReadFile(filepath.Join(dir, e.File))
+		if err != nil {
+			return nil, err
+		}
+		key, err := parseSigningKey(e.Kid, e.Alg, raw)
+		if err != nil {
+			return nil, fmt.Errorf("chave %s: %w", e.Kid, err)
+		}
+		key.NotBefore = e.NotBefore
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// parseSigningKey interpreta o conteúdo do arquivo conforme o algoritmo e
+// confere se o tipo da chave corresponde a ele
+func parseSigningKey(kid, alg string, raw []byte) (*SigningKey, error) {
+	key := &SigningKey{ID: kid, Method: jwt.GetSigningMethod(alg)}
+	var err error
+	switch alg {
+	case "HS256":
+		secret := []byte(strings.TrimSpace(string(raw)))
+		if len(secret) < 32 {
+			return nil, errors.New("segredo HS256 deve ter pelo menos 32 bytes")
+		}
+		key.Private, key.Public = secret, secret
+	case "RS256":
+		var priv *rsa.PrivateKey
+		if priv, err = jwt.ParseRSAPrivateKeyFromPEM(raw); err == nil {
+			key.Private, key.Public = priv, &priv.PublicKey
+		}
+	case "ES256":
+		var priv *ecdsa.PrivateKey
+		if priv, err = jwt.ParseECPrivateKeyFromPEM(raw); err == nil {
+			if priv.Curve != elliptic.P256() {
+				return nil, errors.New("ES256 exige curva P-256")
+			}
+			key.Private, key.Public = priv, &priv.PublicKey
+		}
+	case "EdDSA":
+		var priv crypto.PrivateKey
+		if priv, err = jwt.ParseEdPrivateKeyFromPEM(raw); err == nil {
+			edKey := priv.(ed25519.PrivateKey)
+			key.Private, key.Public = edKey, edKey.Public()
+		}
+	default:
+		return nil, fmt.Errorf("algoritmo não suportado: %q", alg)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// GenerateEd25519Key cria uma chave EdDSA efêmera, ativa imediatamente
+func GenerateEd25519Key(kid string) (*SigningKey, error) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	return &SigningKey{ID: kid, Method: jwt.SigningMethodEdDSA, Private: priv, Public: pub}, nil
+}
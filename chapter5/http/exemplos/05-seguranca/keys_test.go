@@ -0,0 +1,195 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+)
+
+// writeKeyDir grava uma chave de cada algoritmo e o keys.json
+func writeKeyDir(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	_, edKey, _ := ed25519.GenerateKey(rand.Reader)
+
+	files := map[string]interface{}{"rs.pem": rsaKey, "es.pem": ecKey, "ed.pem": edKey}
+	for name, key := range files {
+		der, err := x509.MarshalPKCS8PrivateKey(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	os.WriteFile(filepath.Join(dir, "hs.key"), []byte("segredo-compartilhado-com-32-bytes-ou-mais\n"), 0o600)
+
+	manifest := `[
+		{"kid": "rs", "alg": "RS256", "file": "rs.pem", "not_before": "2026-01-01T00:00:00Z"},
+		{"kid": "es", "alg": "ES256", "file": "es.pem", "not_before": "2026-02-01T00:00:00Z"},
+		{"kid": "ed", "alg": "EdDSA", "file": "ed.pem", "not_before": "2026-03-01T00:00:00Z"},
+		{"kid": "hs", "alg": "HS256", "file": "hs.key", "not_before": "2026-04-01T00:00:00Z"}
+	]`
+	os.WriteFile(filepath.Join(dir, "keys.json"), []byte(manifest), 0o600)
+	return dir
+}
+
+func TestLoadKeysSignAndVerify(t *testing.T) {
+	keys, err := LoadKeys(writeKeyDir(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, key := range keys {
+		m, err := NewKeyManager([]*SigningKey{key}, time.Hour)
+		if err != nil {
+			t.Fatal(err)
+		}
+		signed, err := m.Sign(jwt.StandardClaims{Subject: "ana"})
+		if err != nil {
+			t.Fatalf("%s: Sign: %v", key.ID, err)
+		}
+		token, err := jwt.Parse(signed, m.Keyfunc)
+		if err != nil || !token.Valid {
+			t.Fatalf("%s: token inválido: %v", key.ID, err)
+		}
+		if token.Header["kid"] != key.ID || token.Method.Alg() != key.Method.Alg() {
+			t.Errorf("%s: header inesperado %v", key.ID, token.Header)
+		}
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	keys, err := LoadKeys(writeKeyDir(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := NewKeyManager(keys, 20*time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	at := func(s string) {
+		now, _ := time.Parse(time.RFC3339, s)
+		m.now = func() time.Time { return now }
+	}
+	kids := func() []string {
+		var ids []string
+		for _, k := range m.JWKS() {
+			ids = append(ids, k.Kid)
+		}
+		return ids
+	}
+
+	at("2026-01-15T00:00:00Z")
+	if k, _ := m.Active(); k.ID != "rs" {
+		t.Fatalf("esperado rs ativa, obtido %s", k.ID)
+	}
+	oldToken, _ := m.Sign(jwt.StandardClaims{})
+	// As chaves futuras já são publicadas; HS256 nunca
+	if got := kids(); len(got) != 3 {
+		t.Errorf("JWKS: esperado rs, es e ed, obtido %v", got)
+	}
+
+	// Logo após a rotação, a chave anterior ainda verifica
+	at("2026-02-01T00:10:00Z")
+	if k, _ := m.Active(); k.ID != "es" {
+		t.Fatalf("esperado es ativa, obtido %s", k.ID)
+	}
+	if _, err := jwt.Parse(oldToken, m.Keyfunc); err != nil {
+		t.Errorf("chave em aposentadoria deveria verificar: %v", err)
+	}
+
+	// Depois da retenção, a chave antiga sai do JWKS e da verificação
+	at("2026-02-01T00:30:00Z")
+	if _, err := m.Lookup("rs"); err != ErrUnknownKey {
+		t.Errorf("esperado ErrUnknownKey para chave aposentada, obtido %v", err)
+	}
+	if got := kids(); len(got) != 2 || got[0] != "es" {
+		t.Errorf("JWKS após retenção: esperado [es ed], obtido %v", got)
+	}
+
+	at("2025-12-01T00:00:00Z")
+	if _, err := m.Active(); err != ErrNoActiveKey {
+		t.Errorf("antes da primeira chave: esperado ErrNoActiveKey, obtido %v", err)
+	}
+}
+
+func TestNewKeyManagerRequiresActiveKey(t *testing.T) {
+	key, err := GenerateEd25519Key("futura")
+	if err != nil {
+		t.Fatal(err)
+	}
+	key.NotBefore = time.Now().Add(time.Hour)
+
+	tests := []struct {
+		name string
+		keys []*SigningKey
+	}{
+		{"sem chaves", nil},
+		{"apenas chave futura", []*SigningKey{key}},
+	}
+	for _, tt := range tests {
+		if _, err := NewKeyManager(tt.keys, time.Hour); err != ErrNoActiveKey {
+			t.Errorf("%s: esperado ErrNoActiveKey, obtido %v", tt.name, err)
+		}
+	}
+}
+
+func TestKeyfuncRejectsAlgorithmConfusion(t *testing.T) {
+	keys, err := LoadKeys(writeKeyDir(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, _ := NewKeyManager(keys[:1], time.Hour) // rs
+
+	// Token HS256 assinado com a chave pública RSA como segredo
+	pub, _ := x509.MarshalPKIXPublicKey(keys[0].Public)
+	forged := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.StandardClaims{Subject: "admin"})
+	forged.Header["kid"] = "rs"
+	signed, _ := forged.SignedString(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pub}))
+
+	if _, err := jwt.Parse(signed, m.Keyfunc); err == nil {
+		t.Error("token com algoritmo trocado deveria ser rejeitado")
+	}
+}
+
+func TestServeJWKS(t *testing.T) {
+	s := newTestServer(t)
+	rec := serve(t, s, "GET", "/.well-known/jwks.json", "", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("esperado 200, obtido %d", rec.Code)
+	}
+	var body struct {
+		Keys []JWK `json:"keys"`
+	}
+	json.NewDecoder(rec.Body).Decode(&body)
+	if len(body.Keys) != 1 || body.Keys[0].Kty != "OKP" || body.Keys[0].X == "" {
+		t.Fatalf("JWKS inesperado: %+v", body.Keys)
+	}
+
+	// O token emitido no login usa o kid publicado
+	tokens := login(t, s)
+	token, _, err := new(jwt.Parser).ParseUnverified(tokens.AccessToken, &Claims{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token.Header["kid"] != body.Keys[0].Kid {
+		t.Errorf("kid do token %v não está no JWKS", token.Header["kid"])
+	}
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"container/list"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// LockoutConfig configura o bloqueio de contas após falhas de login
+type LockoutConfig struct {
+	// MaxFailures é o número de falhas seguidas que bloqueia a conta
+	MaxFailures int
+	// BaseLockout é a duração do primeiro bloqueio; cada falha seguinte
+	// dobra a duração
+	BaseLockout time.Duration
+	// MaxLockout limita a duração de um bloqueio
+	MaxLockout time.Duration
+	// ResetAfter zera o contador quando não há falhas por esse tempo
+	ResetAfter time.Duration
+	// OnEvent recebe os eventos de bloqueio e desbloqueio, para log ou alerta
+	OnEvent func(LockoutEvent)
+}
+
+// DefaultLockoutConfig retorna a configuração padrão: 5 falhas bloqueiam
+// a conta por 1 minuto, depois 2, 4, ... até 1 hora
+func DefaultLockoutConfig() LockoutConfig {
+	return LockoutConfig{
+		MaxFailures: 5,
+		BaseLockout: time.Minute,
+		MaxLockout:  time.Hour,
+		ResetAfter:  time.Hour,
+		OnEvent:     logLockoutEvent,
+	}
+}
+
+// Tipos de LockoutEvent
+const (
+	lockoutLocked   = "locked"
+	lockoutUnlocked = "unlocked"
+)
+
+// LockoutEvent descreve um bloqueio ou desbloqueio de conta
+type LockoutEvent struct {
+	Type     string
+	Username string
+	Failures int
+	// Until é o fim do bloqueio; vazio em desbloqueios
+	Until time.Time
+}
+
+func logLockoutEvent(e LockoutEvent) {
+	if e.Type == lockoutLocked {
+		log.Printf("Conta %q bloqueada até %s após %d falhas de login", e.Username, e.Until.Format(time.RFC3339), e.Failures)
+		return
+	}
+	log.Printf("Conta %q desbloqueada", e.Username)
+}
+
+// maxLockoutEntries limita quantos usernames são acompanhados. Cheio, o
+// tracker descarta o username com a falha mais antiga, mesmo bloqueado:
+// para liberar uma conta assim, o atacante precisaria de outras 10 mil
+// falhas depois da última dela, o que o rate limit de /login impede.
+const maxLockoutEntries = 10_000
+
+// LockoutTracker conta as falhas de login por username, de qualquer IP.
+// Usernames inexistentes são contados da mesma forma, para que o bloqueio
+// não revele quais contas existem.
+type LockoutTracker struct {
+	mu  sync.Mutex
+	cfg LockoutConfig
+	// attempts aponta para os elementos de lru, que vai da falha mais
+	// recente (frente) para a mais antiga (fundo)
+	attempts map[string]*list.Element
+	lru      *list.List
+	max      int
+	now      func() time.Time
+}
+
+type loginAttempts struct {
+	username    string
+	failures    int
+	lastFailure time.Time
+	lockedUntil time.Time
+}
+
+// NewLockoutTracker cria o tracker com a configuração informada
+func NewLockoutTracker(cfg LockoutConfig) *LockoutTracker {
+	return &LockoutTracker{
+		cfg:      cfg,
+		attempts: make(map[string]*list.Element),
+		lru:      list.New(),
+		max:      maxLockoutEntries,
+		now:      time.Now,
+	}
+}
+
+// emit envia o evento ao hook, se houver
+func (t *LockoutTracker) emit(e LockoutEvent) {
+	if t.cfg.OnEvent != nil {
+		t.cfg.OnEvent(e)
+	}
+}
+
+// Locked informa se o username está bloqueado e por quanto tempo ainda
+func (t *LockoutTracker) Locked(username string) (time.Duration, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	el, ok := t.attempts[username]
+	if !ok {
+		return 0, false
+	}
+	remaining := el.Value.(*loginAttempts).lockedUntil.Sub(t.now())
+	return remaining, remaining > 0
+}
+
+// RecordFailure registra uma falha. A partir de MaxFailures, cada falha
+// bloqueia a conta pelo dobro do tempo da anterior.
+func (t *LockoutTracker) RecordFailure(username string) {
+	t.mu.Lock()
+	now := t.now()
+	var a *loginAttempts
+	if el, ok := t.attempts[username]; ok {
+		a = el.Value.(*loginAttempts)
+		if now.Sub(a.lastFailure) > t.cfg.ResetAfter {
+			*a = loginAttempts{username: username}
+		}
+		t.lru.MoveToFront(el)
+	} else {
+		t.evict(now)
+		a = &loginAttempts{username: username}
+		t.attempts[username] = t.lru.PushFront(a)
+	}
+	a.failures++
+	a.lastFailure = now
+
+	var event *LockoutEvent
+	if a.failures >= t.cfg.MaxFailures {
+		lockout := t.cfg.MaxLockout
+		if shift := a.failures - t.cfg.MaxFailures; shift < 32 {
+			lockout = min(t.cfg.BaseLockout<<shift, t.cfg.MaxLockout)
+		}
+		a.lockedUntil = now.Add(lockout)
+		event = &LockoutEvent{Type: lockoutLocked, Username: username, Failures: a.failures, Until: a.lockedUntil}
+	}
+	t.mu.Unlock()
+
+	// O hook roda fora do lock: pode ser lento (alertas) sem travar logins
+	if event != nil {
+		t.emit(*event)
+	}
+}
+
+// RecordSuccess zera as falhas após um login bem-sucedido
+func (t *LockoutTracker) RecordSuccess(username string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.remove(username)
+}
+
+// Unlock remove o bloqueio e as falhas do username. Retorna false se ele
+// não estava bloqueado.
+func (t *LockoutTracker) Unlock(username string) bool {
+	t.mu.Lock()
+	el, ok := t.attempts[username]
+	locked := ok && el.Value.(*loginAttempts).lockedUntil.After(t.now())
+	t.remove(username)
+	t.mu.Unlock()
+
+	if locked {
+		t.emit(LockoutEvent{Type: lockoutUnlocked, Username: username})
+	}
+	return locked
+}
+
+// remove descarta o username. Exige o lock.
+func (t *LockoutTracker) remove(username string) {
+	if el, ok := t.attempts[username]; ok {
+		t.lru.Remove(el)
+		delete(t.attempts, username)
+	}
+}
+
+// evict abre espaço para um username novo: descarta pelo fundo os que não
+// têm bloqueio ativo nem falhas recentes e, se ainda faltar espaço, os de
+// falha mais antiga. Exige o lock.
+func (t *LockoutTracker) evict(now time.Time) {
+	for el := t.lru.Back(); el != nil; el = t.lru.Back() {
+		a := el.Value.(*loginAttempts)
+		stale := now.After(a.lockedUntil) && now.Sub(a.lastFailure) > t.cfg.ResetAfter
+		if t.lru.Len() < t.max && !stale {
+			break
+		}
+		t.remove(a.username)
+	}
+}
+
+// respondLocked responde 429 com o tempo restante de bloqueio
+func respondLocked(w http.ResponseWriter, remaining time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(ceilSeconds(remaining)))
+	http.Error(w, "Too many failed login attempts", http.StatusTooManyRequests)
+}
+
+// handleUnlockUser remove o bloqueio de login do usuário (admin)
+func (s *Server) handleUnlockUser(w http.ResponseWriter, r *http.Request) {
+	user, err := s.store.Get(r.Context(), r.PathValue("id"))
+	if errors.Is(err, ErrUserNotFound) {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Error loading user", http.StatusInternalServerError)
+		return
+	}
+	s.lockout.Unlock(user.Username)
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestLockoutBackoff(t *testing.T) {
+	var events []LockoutEvent
+	tracker := NewLockoutTracker(LockoutConfig{
+		MaxFailures: 3,
+		BaseLockout: time.Minute,
+		MaxLockout:  5 * time.Minute,
+		ResetAfter:  time.Hour,
+		OnEvent:     func(e LockoutEvent) { events = append(events, e) },
+	})
+	now := time.Now()
+	tracker.now = func() time.Time { return now }
+
+	for i := 0; i < 2; i++ {
+		tracker.RecordFailure("ana")
+	}
+	if _, locked := tracker.Locked("ana"); locked {
+		t.Fatal("abaixo do limite não deveria bloquear")
+	}
+
+	// 1, 2, 4 minutos e depois o teto de 5
+	for _, want := range []time.Duration{time.Minute, 2 * time.Minute, 4 * time.Minute, 5 * time.Minute} {
+		tracker.RecordFailure("ana")
+		if remaining, locked := tracker.Locked("ana"); !locked || remaining != want {
+			t.Errorf("esperado bloqueio de %s, obtido %s (%v)", want, remaining, locked)
+		}
+	}
+	if len(events) != 4 || events[0].Type != lockoutLocked || events[0].Failures != 3 {
+		t.Errorf("eventos inesperados: %+v", events)
+	}
+
+	// O bloqueio expira sozinho
+	now = now.Add(6 * time.Minute)
+	if _, locked := tracker.Locked("ana"); locked {
+		t.Error("bloqueio deveria ter expirado")
+	}
+
+	// Sem falhas por ResetAfter, o contador recomeça
+	now = now.Add(2 * time.Hour)
+	tracker.RecordFailure("ana")
+	if _, locked := tracker.Locked("ana"); locked {
+		t.Error("contador deveria ter sido zerado")
+	}
+}
+
+func TestLockoutEviction(t *testing.T) {
+	tracker := NewLockoutTracker(LockoutConfig{MaxFailures: 1, BaseLockout: time.Hour, MaxLockout: time.Hour, ResetAfter: time.Hour})
+	tracker.max = 3
+	now := time.Now()
+	tracker.now = func() time.Time { return now }
+
+	for _, username := range []string{"ana", "bia", "caio"} {
+		tracker.RecordFailure(username)
+		now = now.Add(time.Second)
+	}
+	// Uma falha nova de ana a torna a mais recente
+	tracker.RecordFailure("ana")
+
+	// Cheio, o tracker descarta a falha mais antiga, mesmo bloqueada
+	tracker.RecordFailure("davi")
+	if len(tracker.attempts) != 3 || tracker.lru.Len() != 3 {
+		t.Fatalf("esperado 3 usernames, obtido %d", len(tracker.attempts))
+	}
+	for username, want := range map[string]bool{"ana": true, "bia": false, "caio": true, "davi": true} {
+		if _, locked := tracker.Locked(username); locked != want {
+			t.Errorf("%s: esperado bloqueado=%v, obtido %v", username, want, locked)
+		}
+	}
+
+	// Usernames sem bloqueio nem falhas recentes saem antes de faltar espaço
+	now = now.Add(3 * time.Hour)
+	tracker.RecordFailure("eva")
+	if len(tracker.attempts) != 1 {
+		t.Errorf("esperado apenas eva após a expiração, obtido %d usernames", len(tracker.attempts))
+	}
+
+	tracker.RecordSuccess("eva")
+	if len(tracker.attempts) != 0 || tracker.lru.Len() != 0 {
+		t.Error("RecordSuccess deveria descartar o username")
+	}
+}
+
+func TestLoginLockout(t *testing.T) {
+	s := newTestServer(t)
+	var events []LockoutEvent
+	cfg := DefaultLockoutConfig()
+	cfg.OnEvent = func(e LockoutEvent) { events = append(events, e) }
+	s.lockout = NewLockoutTracker(cfg)
+
+	for _, username := range []string{"ana", "fantasma"} {
+		for i := 0; i < cfg.MaxFailures; i++ {
+			body := `{"username":"` + username + `","password":"errada"}`
+			if rec := serve(t, s, "POST", "/login", body, ""); rec.Code != http.StatusUnauthorized {
+				t.Fatalf("%s: esperado 401, obtido %d", username, rec.Code)
+			}
+		}
+	}
+
+	// Conta existente e inexistente recebem a mesma resposta
+	for _, username := range []string{"ana", "fantasma"} {
+		rec := serve(t, s, "POST", "/login", `{"username":"`+username+`","password":"senha-secreta"}`, "")
+		if rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") != "60" {
+			t.Errorf("%s: esperado 429 com Retry-After 60, obtido %d %q", username, rec.Code, rec.Header().Get("Retry-After"))
+		}
+	}
+	if len(events) != 2 || events[0].Username != "ana" {
+		t.Errorf("eventos inesperados: %+v", events)
+	}
+
+	// Admin desbloqueia ana
+	admin := loginAdmin(t, s)
+
+	ana, _ := s.store.GetByUsername(context.Background(), "ana")
+	if rec := serve(t, s, "DELETE", "/admin/users/"+ana.ID+"/lockout", "", admin); rec.Code != http.StatusNoContent {
+		t.Fatalf("desbloqueio: esperado 204, obtido %d", rec.Code)
+	}
+	if events[len(events)-1].Type != lockoutUnlocked {
+		t.Errorf("esperado evento de desbloqueio, obtido %+v", events[len(events)-1])
+	}
+
+	// ana volta a entrar; fantasma continua bloqueado
+	login(t, s)
+	if rec := serve(t, s, "POST", "/login", `{"username":"fantasma","password":"x"}`, ""); rec.Code != http.StatusTooManyRequests {
+		t.Errorf("fantasma: esperado 429, obtido %d", rec.Code)
+	}
+}
@@ -4,8 +4,8 @@ import (
 	"context"
 	"crypto/rand"
 	"crypto/tls"
-	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
@@ -17,56 +17,29 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/cauelz/full-cycle-golang-expert/pkg/auth"
+	"github.com/cauelz/full-cycle-golang-expert/pkg/validate"
 	"github.com/golang-jwt/jwt"
-	"golang.org/x/time/rate"
+	"golang.org/x/crypto/bcrypt"
 )
 
-// User representa um usuário do sistema
+// User representa um usuário do sistema. Apenas o hash da senha é
+// armazenado, e ele nunca é serializado.
 type User struct {
-	ID       string `json:"id"`
-	Username string `json:"username" validate:"required,min=3,max=50"`
-	Password string `json:"password" validate:"required,min=8"`
-	Role     string `json:"role"`
-}
-
-// UserStore é um armazenamento em memória para usuários
-type UserStore struct {
-	sync.RWMutex
-	users map[string]User
-}
-
-// NewUserStore cria um novo armazenamento de usuários
-func NewUserStore() *UserStore {
-	return &UserStore{
-		users: make(map[string]User),
-	}
-}
-
-// Add adiciona um novo usuário
-func (s *UserStore) Add(user User) {
-	s.Lock()
-	defer s.Unlock()
-	s.users[user.ID] = user
-}
-
-// Get retorna um usuário pelo ID
-func (s *UserStore) Get(id string) (User, bool) {
-	s.RLock()
-	defer s.RUnlock()
-	user, ok := s.users[id]
-	return user, ok
+	ID           string `json:"id"`
+	Username     string `json:"username"`
+	PasswordHash string `json:"-"`
+	Role         string `json:"role"`
+	// TOTPSecret é o segredo TOTP em base32. Com MFAEnabled falso, é uma
+	// inscrição ainda não confirmada.
+	TOTPSecret string `json:"-"`
+	MFAEnabled bool   `json:"mfa_enabled"`
 }
 
-// GetByUsername retorna um usuário pelo username
-func (s *UserStore) GetByUsername(username string) (User, bool) {
-	s.RLock()
-	defer s.RUnlock()
-	for _, user := range s.users {
-		if user.Username == username {
-			return user, true
-		}
-	}
-	return User{}, false
+// createUserRequest é o corpo de POST /users
+type createUserRequest struct {
+	Username string `json:"username" validate:"required,min=3,max=50"`
+	Password string `json:"password" validate:"required,min=8,max=128"`
 }
 
 // Claims representa os claims do JWT
@@ -76,81 +49,292 @@ type Claims struct {
 	jwt.StandardClaims
 }
 
+// Audiências (claim aud) dos JWTs. O token emitido entre a senha e o
+// segundo fator tem audiência própria: ele é assinado com a mesma chave,
+// mas validateToken o recusa onde se espera um access token.
+const (
+	accessTokenAudience     = "seguranca:access"
+	mfaPendingTokenAudience = "seguranca:mfa_pending"
+)
+
+var (
+	// errMFAPendingToken indica um token mfa_pending usado como access token
+	errMFAPendingToken = errors.New("token aceito apenas em /login/mfa")
+	// errTokenAudience indica um token emitido para outra finalidade
+	errTokenAudience = errors.New("audiência do token inválida")
+)
+
 // Server representa o servidor HTTP
 type Server struct {
-	store      *UserStore
-	jwtSecret  []byte
+	store      UserRepository
+	passwords  *PasswordManager
+	tokens     TokenStore
+	apiKeys    APIKeyStore
+	sessions   *SessionManager
+	keys       *KeyManager
+	policy     *Policy
 	csrfSecret []byte
-	limiter    *IPRateLimiter
+	csrfConfig CSRFConfig
+	clientIPs  *IPResolver
+	lockout    *LockoutTracker
+	accessTTL  time.Duration
+	refreshTTL time.Duration
+	now        func() time.Time
+
+	// limiters guarda um IPRateLimiter por política de rate limiting
+	limitersMu    sync.Mutex
+	limiters      map[string]*IPRateLimiter
+	rateKey       KeyFunc
+	rateLimitMode string
 }
 
 // NewServer cria um novo servidor
 func NewServer() *Server {
 	// Gerar segredos aleatórios
-	jwtSecret := make([]byte, 32)
-	csrfSecret := make([]byte, 32)
-	rand.Read(jwtSecret)
-	rand.Read(csrfSecret)
-
-	return &Server{
-		store:      NewUserStore(),
-		jwtSecret:  jwtSecret,
+	// Com CSRF_SECRET, os tokens CSRF continuam válidos após reinícios e
+	// entre réplicas
+	csrfSecret := []byte(os.Getenv("CSRF_SECRET"))
+	if len(csrfSecret) == 0 {
+		csrfSecret = make([]byte, 32)
+		rand.Read(csrfSecret)
+	} else if len(csrfSecret) < 32 {
+		log.Fatal("CSRF_SECRET deve ter pelo menos 32 bytes")
+	}
+
+	csrfConfig := DefaultCSRFConfig()
+	if origins := os.Getenv("CSRF_TRUSTED_ORIGINS"); origins != "" {
+		csrfConfig.TrustedOrigins = strings.Split(origins, ",")
+	}
+	if exempt := os.Getenv("CSRF_EXEMPT_PATHS"); exempt != "" {
+		csrfConfig.ExemptPaths = strings.Split(exempt, ",")
+	}
+
+	// Headers de encaminhamento só valem quando a conexão vem de um dos
+	// proxies de TRUSTED_PROXIES
+	clientIPs, err := NewIPResolver(strings.Split(os.Getenv("TRUSTED_PROXIES"), ",")...)
+	if err != nil {
+		log.Fatalf("Erro ao configurar proxies confiáveis: %v", err)
+	}
+	store, sessions, apiKeys, err := openStores(os.Getenv("USERS_DB"))
+	if err != nil {
+		log.Fatalf("Erro ao abrir banco de usuários: %v", err)
+	}
+
+	keys, err := loadKeyManager(os.Getenv("JWT_KEYS_DIR"))
+	if err != nil {
+		log.Fatalf("Erro ao carregar chaves JWT: %v", err)
+	}
+
+	policy := DefaultPolicy()
+	if path := os.Getenv("RBAC_CONFIG"); path != "" {
+		if policy, err = LoadPolicy(path); err != nil {
+			log.Fatalf("Erro ao carregar política de acesso: %v", err)
+		}
+	}
+
+	// Novos hashes usam argon2id; hashes bcrypt antigos continuam válidos
+	// e são convertidos no próximo login
+	passwords, err := NewPasswordManager(DefaultArgon2id(), BcryptHasher{Cost: bcrypt.DefaultCost})
+	if err != nil {
+		log.Fatalf("Erro ao inicializar hash de senhas: %v", err)
+	}
+
+	s := &Server{
+		store:      store,
+		passwords:  passwords,
+		tokens:     NewMemoryTokenStore(),
+		apiKeys:    apiKeys,
+		sessions:   NewSessionManager(sessions, DefaultSessionConfig()),
+		keys:       keys,
+		policy:     policy,
 		csrfSecret: csrfSecret,
-		limiter:    NewIPRateLimiter(rate.Every(time.Second), 10),
+		csrfConfig: csrfConfig,
+		clientIPs:  clientIPs,
+		lockout:    NewLockoutTracker(DefaultLockoutConfig()),
+		limiters:   make(map[string]*IPRateLimiter),
+		accessTTL:  defaultAccessTTL,
+		refreshTTL: defaultRefreshTTL,
+		now:        time.Now,
+	}
+
+	if s.rateKey, err = s.rateLimitKey(os.Getenv("RATE_LIMIT_KEY")); err != nil {
+		log.Fatalf("Erro ao configurar rate limiting: %v", err)
 	}
+	switch s.rateLimitMode = os.Getenv("RATE_LIMIT_MODE"); s.rateLimitMode {
+	case "":
+		s.rateLimitMode = rateLimitEnforce
+	case rateLimitEnforce, rateLimitDryRun, rateLimitOff:
+	default:
+		log.Fatalf("RATE_LIMIT_MODE desconhecido: %q", s.rateLimitMode)
+	}
+	return s
 }
 
-// createToken cria um novo JWT
-func (s *Server) createToken(userID, role string) (string, error) {
-	claims := Claims{
-		UserID: userID,
-		Role:   role,
-		StandardClaims: jwt.StandardClaims{
-			ExpiresAt: time.Now().Add(24 * time.Hour).Unix(),
-			IssuedAt:  time.Now().Unix(),
-		},
+// rateLimitKey escolhe como o rate limiting agrupa as requisições: por
+// IP (padrão), por prefixo /64 em IPv6, por usuário do JWT ou por API key.
+// As duas últimas usam o IP para requisições anônimas.
+func (s *Server) rateLimitKey(name string) (KeyFunc, error) {
+	byIP := KeyByIP(s.clientIPs)
+	switch name {
+	case "", "ip":
+		return byIP, nil
+	case "prefix":
+		return KeyByIPPrefix(s.clientIPs, 64), nil
+	case "user":
+		return s.KeyByUser(byIP), nil
+	case "apikey":
+		return s.KeyByAPIKey(byIP), nil
+	default:
+		return nil, fmt.Errorf("RATE_LIMIT_KEY desconhecida: %q", name)
 	}
+}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(s.jwtSecret)
+// openStores abre o banco SQLite em path, com os usuários, as sessões e as
+// API keys. Sem path, todos ficam em memória e se perdem quando o processo
+// reinicia.
+func openStores(path string) (UserRepository, SessionStore, APIKeyStore, error) {
+	if path == "" {
+		log.Print("USERS_DB não definido; usuários, sessões e API keys em memória")
+		return NewMemoryUserRepository(), NewMemorySessionStore(), NewMemoryAPIKeyStore(), nil
+	}
+	db, err := openSQLite(context.Background(), path)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return NewSQLiteUserRepository(db), NewSQLiteSessionStore(db), NewSQLiteAPIKeyStore(db), nil
 }
 
-// validateToken valida um JWT
-func (s *Server) validateToken(tokenString string) (*Claims, error) {
-	token, err := jwt.ParseWithClaims(tokenString, &Claims{},
-		func(token *jwt.Token) (interface{}, error) {
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, fmt.Errorf("método de assinatura inesperado: %v",
-					token.Header["alg"])
-			}
-			return s.jwtSecret, nil
-		})
+// loadKeyManager carrega as chaves de JWT_KEYS_DIR. Sem diretório, usa
+// uma chave Ed25519 efêmera: os tokens deixam de valer quando o processo
+// reinicia e não podem ser compartilhados entre réplicas.
+func loadKeyManager(dir string) (*KeyManager, error) {
+	// Uma chave substituída continua aceita até os tokens emitidos por ela
+	// expirarem, com folga para diferença de relógio
+	retention := defaultAccessTTL + 5*time.Minute
+
+	if dir == "" {
+		log.Print("JWT_KEYS_DIR não definido; usando chave efêmera")
+		key, err := GenerateEd25519Key("ephemeral")
+		if err != nil {
+			return nil, err
+		}
+		return NewKeyManager([]*SigningKey{key}, retention)
+	}
 
+	keys, err := LoadKeys(dir)
 	if err != nil {
 		return nil, err
 	}
+	return NewKeyManager(keys, retention)
+}
+
+// createToken cria um novo access token (JWT de curta duração)
+func (s *Server) createToken(userID, role string) (string, error) {
+	return s.signToken(Claims{UserID: userID, Role: role}, accessTokenAudience, s.accessTTL)
+}
 
-	if claims, ok := token.Claims.(*Claims); ok && token.Valid {
-		return claims, nil
+// signToken assina os claims para a audiência, com validade ttl. O jti
+// permite revogar o token antes de expirar.
+func (s *Server) signToken(claims Claims, audience string, ttl time.Duration) (string, error) {
+	jti, err := randomToken(16)
+	if err != nil {
+		return "", err
+	}
+	now := s.now()
+	claims.StandardClaims = jwt.StandardClaims{
+		Audience:  audience,
+		Id:        jti,
+		ExpiresAt: now.Add(ttl).Unix(),
+		IssuedAt:  now.Unix(),
 	}
 
-	return nil, fmt.Errorf("token inválido")
+	return s.keys.Sign(claims)
 }
 
-// generateCSRFToken gera um token CSRF
-func (s *Server) generateCSRFToken() string {
-	token := make([]byte, 32)
-	rand.Read(token)
-	return base64.StdEncoding.EncodeToString(token)
+// tokenResponse é a resposta de login e refresh
+type tokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
 }
 
-// validateCSRFToken valida um token CSRF
-func (s *Server) validateCSRFToken(token, cookieToken string) bool {
-	return token == cookieToken
+// issueTokens cria um access token e um refresh token da família informada.
+// Um familyID vazio inicia uma nova família (novo login).
+func (s *Server) issueTokens(ctx context.Context, user User, familyID string) (tokenResponse, error) {
+	access, err := s.createToken(user.ID, user.Role)
+	if err != nil {
+		return tokenResponse{}, err
+	}
+	refresh, err := randomToken(32)
+	if err != nil {
+		return tokenResponse{}, err
+	}
+	if familyID == "" {
+		if familyID, err = randomToken(16); err != nil {
+			return tokenResponse{}, err
+		}
+	}
+
+	err = s.tokens.SaveRefresh(ctx, RefreshToken{
+		Hash:      hashRefreshToken(refresh),
+		UserID:    user.ID,
+		FamilyID:  familyID,
+		ExpiresAt: s.now().Add(s.refreshTTL),
+	})
+	if err != nil {
+		return tokenResponse{}, err
+	}
+
+	return tokenResponse{
+		AccessToken:  access,
+		RefreshToken: refresh,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(s.accessTTL.Seconds()),
+	}, nil
 }
 
-// authMiddleware é um middleware de autenticação
+// validateToken valida um JWT emitido para a audiência informada. Um token
+// mfa_pending fora de /login/mfa retorna errMFAPendingToken.
+func (s *Server) validateToken(tokenString, audience string) (*Claims, error) {
+	// A chave é escolhida pelo kid do header
+	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, s.keys.Keyfunc)
+
+	if err != nil {
+		return nil, err
+	}
+
+	claims, ok := token.Claims.(*Claims)
+	if !ok || !token.Valid {
+		return nil, fmt.Errorf("token inválido")
+	}
+	if !claims.VerifyAudience(audience, true) {
+		if claims.Audience == mfaPendingTokenAudience {
+			return nil, errMFAPendingToken
+		}
+		return nil, errTokenAudience
+	}
+	return claims, nil
+}
+
+// authMiddleware é o middleware de autenticação por JWT (Authorization:
+// Bearer). API keys são recusadas; as rotas que as aceitam usam
+// apiKeyAuthMiddleware.
 func (s *Server) authMiddleware(next http.Handler) http.Handler {
+	return s.authenticate(next, false)
+}
+
+// apiKeyAuthMiddleware aceita, além do JWT, uma API key (Authorization:
+// ApiKey); as duas produzem o mesmo Principal, com os escopos da chave.
+// Deve envolver apenas rotas protegidas por RequirePermission ou que não
+// alterem a conta do usuário.
+func (s *Server) apiKeyAuthMiddleware(next http.Handler) http.Handler {
+	return s.authenticate(next, true)
+}
+
+// authenticate valida o header Authorization e guarda o Principal no
+// contexto
+func (s *Server) authenticate(next http.Handler, allowAPIKey bool) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		authHeader := r.Header.Get("Authorization")
 		if authHeader == "" {
@@ -159,50 +343,63 @@ func (s *Server) authMiddleware(next http.Handler) http.Handler {
 		}
 
 		parts := strings.Split(authHeader, " ")
-		if len(parts) != 2 || parts[0] != "Bearer" {
+		if len(parts) != 2 {
 			http.Error(w, "Invalid authorization format", http.StatusUnauthorized)
 			return
 		}
 
-		claims, err := s.validateToken(parts[1])
-		if err != nil {
-			http.Error(w, "Invalid token", http.StatusUnauthorized)
+		var ctx context.Context
+		var ok bool
+		switch parts[0] {
+		case "Bearer":
+			ctx, ok = s.authenticateBearer(w, r, parts[1])
+		case "ApiKey":
+			if !allowAPIKey {
+				http.Error(w, "API keys are not accepted on this route", http.StatusUnauthorized)
+				return
+			}
+			ctx, ok = s.authenticateAPIKey(w, r, parts[1])
+		default:
+			http.Error(w, "Invalid authorization format", http.StatusUnauthorized)
+			return
+		}
+		if !ok {
 			return
 		}
-
-		ctx := context.WithValue(r.Context(), "claims", claims)
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
 
-// csrfMiddleware é um middleware CSRF
-func (s *Server) csrfMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if r.Method == "GET" {
-			token := s.generateCSRFToken()
-			http.SetCookie(w, &http.Cookie{
-				Name:     "csrf_token",
-				Value:    token,
-				HttpOnly: true,
-				Secure:   true,
-				SameSite: http.SameSiteStrictMode,
-			})
-		} else {
-			cookie, err := r.Cookie("csrf_token")
-			if err != nil {
-				http.Error(w, "CSRF cookie not found", http.StatusBadRequest)
-				return
-			}
+// authenticateBearer autentica a requisição pelo JWT
+func (s *Server) authenticateBearer(w http.ResponseWriter, r *http.Request, token string) (context.Context, bool) {
+	claims, err := s.validateToken(token, accessTokenAudience)
+	// Só a senha foi verificada; o token serve apenas para /login/mfa
+	if errors.Is(err, errMFAPendingToken) {
+		http.Error(w, "MFA verification required", http.StatusUnauthorized)
+		return nil, false
+	}
+	if err != nil {
+		http.Error(w, "Invalid token", http.StatusUnauthorized)
+		return nil, false
+	}
 
-			token := r.Header.Get("X-CSRF-Token")
-			if !s.validateCSRFToken(token, cookie.Value) {
-				http.Error(w, "Invalid CSRF token", http.StatusForbidden)
-				return
-			}
-		}
+	// Tokens revogados no logout continuam com assinatura válida
+	revoked, err := s.tokens.IsAccessRevoked(r.Context(), claims.Id)
+	if err != nil {
+		http.Error(w, "Error validating token", http.StatusInternalServerError)
+		return nil, false
+	}
+	if revoked {
+		http.Error(w, "Token revoked", http.StatusUnauthorized)
+		return nil, false
+	}
 
-		next.ServeHTTP(w, r)
-	})
+	return auth.WithPrincipal(r.Context(), auth.Principal{
+		Subject:   claims.UserID,
+		Role:      claims.Role,
+		TokenID:   claims.Id,
+		ExpiresAt: time.Unix(claims.ExpiresAt, 0),
+	}), true
 }
 
 // securityHeadersMiddleware adiciona headers de segurança
@@ -220,6 +417,37 @@ func securityHeadersMiddleware(next http.Handler) http.Handler {
 	})
 }
 
+// statusRecorder captura o status da resposta para o log
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (rec *statusRecorder) WriteHeader(status int) {
+	rec.status = status
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+// loggingMiddleware registra cada requisição com o IP do cliente, resolvido
+// da mesma forma que no rate limiting
+func (s *Server) loggingMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+
+		next.ServeHTTP(rec, r)
+
+		log.Printf(
+			"ip=%s method=%s path=%s status=%d duration=%s",
+			s.clientIPs.ClientIP(r),
+			r.Method,
+			r.URL.Path,
+			rec.status,
+			time.Since(start),
+		)
+	})
+}
+
 // sanitizeInput sanitiza uma string de entrada
 func sanitizeInput(input string) string {
 	// Permitir apenas letras, números e alguns caracteres especiais
@@ -248,23 +476,173 @@ func (s *Server) handleLogin(w http.ResponseWriter, r *http.Request) {
 	username := sanitizeInput(creds.Username)
 	password := creds.Password // Não sanitizar senha, pois pode conter caracteres especiais
 
-	// Buscar usuário
-	user, ok := s.store.GetByUsername(username)
-	if !ok || user.Password != password { // Na prática, usar bcrypt para comparar senhas
+	user, err := s.checkPassword(r.Context(), username, password)
+	var locked *lockedError
+	switch {
+	case errors.As(err, &locked):
+		respondLocked(w, locked.remaining)
+		return
+	case errors.Is(err, errInvalidCredentials):
 		http.Error(w, "Invalid credentials", http.StatusUnauthorized)
 		return
+	case err != nil:
+		http.Error(w, "Error loading user", http.StatusInternalServerError)
+		return
+	}
+
+	// Com MFA, as falhas só são zeradas depois do segundo fator
+	if user.MFAEnabled {
+		s.respondMFARequired(w, user)
+		return
 	}
+	s.lockout.RecordSuccess(username)
 
-	// Gerar token
-	token, err := s.createToken(user.ID, user.Role)
+	// Gerar tokens
+	tokens, err := s.issueTokens(r.Context(), user, "")
 	if err != nil {
 		http.Error(w, "Error generating token", http.StatusInternalServerError)
 		return
 	}
 
-	json.NewEncoder(w).Encode(map[string]string{
-		"token": token,
-	})
+	json.NewEncoder(w).Encode(tokens)
+}
+
+// errInvalidCredentials indica usuário inexistente ou senha errada, sem
+// distinguir os dois casos
+var errInvalidCredentials = errors.New("credenciais inválidas")
+
+// lockedError indica uma conta bloqueada por falhas seguidas
+type lockedError struct {
+	remaining time.Duration
+}
+
+func (e *lockedError) Error() string {
+	return fmt.Sprintf("conta bloqueada por mais %s", e.remaining)
+}
+
+// checkPassword confere a senha, aplicando o bloqueio de conta. As falhas
+// são registradas aqui; o sucesso fica com o chamador, que pode ainda
+// exigir o segundo fator.
+func (s *Server) checkPassword(ctx context.Context, username, password string) (User, error) {
+	// Conta bloqueada por falhas seguidas, de qualquer IP. Usernames
+	// inexistentes também são bloqueados, então a resposta não revela quais
+	// contas existem.
+	if remaining, locked := s.lockout.Locked(username); locked {
+		return User{}, &lockedError{remaining: remaining}
+	}
+
+	// Buscar usuário. Sem usuário, a verificação falsa mantém o tempo de
+	// resposta igual ao de uma senha errada, e a falha é contada do mesmo
+	// jeito.
+	var valid bool
+	var rehash string
+	user, err := s.store.GetByUsername(ctx, username)
+	switch {
+	case errors.Is(err, ErrUserNotFound):
+		s.passwords.VerifyDummy(password)
+	case err != nil:
+		return User{}, err
+	default:
+		valid, rehash, err = s.passwords.Verify(password, user.PasswordHash)
+		if err != nil {
+			log.Printf("Erro ao verificar senha de %s: %v", user.ID, err)
+		}
+	}
+	if !valid {
+		s.lockout.RecordFailure(username)
+		return User{}, errInvalidCredentials
+	}
+	// Hash com algoritmo ou parâmetros antigos: atualiza com a senha em mãos
+	if rehash != "" {
+		if err := s.store.UpdatePasswordHash(ctx, user.ID, rehash); err != nil {
+			log.Printf("Erro ao atualizar hash de %s: %v", user.ID, err)
+		}
+	}
+	return user, nil
+}
+
+// handleRefresh troca um refresh token por um novo par de tokens. O refresh
+// token usado é invalidado (rotação); reapresentá-lo revoga a família.
+func (s *Server) handleRefresh(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.RefreshToken == "" {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	old, err := s.tokens.UseRefresh(r.Context(), hashRefreshToken(req.RefreshToken), s.now())
+	if err != nil {
+		if errors.Is(err, ErrRefreshReused) {
+			log.Printf("Reuso de refresh token detectado; família revogada")
+		}
+		http.Error(w, "Invalid refresh token", http.StatusUnauthorized)
+		return
+	}
+
+	// A role é lida de novo para refletir alterações desde o login
+	user, err := s.store.Get(r.Context(), old.UserID)
+	if errors.Is(err, ErrUserNotFound) {
+		s.tokens.RevokeFamily(r.Context(), old.FamilyID)
+		http.Error(w, "Invalid refresh token", http.StatusUnauthorized)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Error loading user", http.StatusInternalServerError)
+		return
+	}
+
+	tokens, err := s.issueTokens(r.Context(), user, old.FamilyID)
+	if err != nil {
+		http.Error(w, "Error generating token", http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(tokens)
+}
+
+// handleLogout revoga o access token atual e, se informado, a família do
+// refresh token
+func (s *Server) handleLogout(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Uma API key é encerrada em DELETE /api-keys/{id}; a denylist só
+	// conhece jtis de JWT
+	p, ok := requireSession(w, r)
+	if !ok {
+		return
+	}
+	if err := s.tokens.RevokeAccess(r.Context(), p.TokenID, p.ExpiresAt); err != nil {
+		http.Error(w, "Error revoking token", http.StatusInternalServerError)
+		return
+	}
+
+	var req struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	// O corpo é opcional
+	json.NewDecoder(r.Body).Decode(&req)
+	if req.RefreshToken != "" {
+		// Só revoga a família se o refresh token pertencer ao mesmo usuário.
+		// A busca não consome o token, então um token alheio continua válido.
+		token, err := s.tokens.GetRefresh(r.Context(), hashRefreshToken(req.RefreshToken))
+		if err == nil && token.UserID == p.Subject {
+			if err := s.tokens.RevokeFamily(r.Context(), token.FamilyID); err != nil {
+				http.Error(w, "Error revoking token", http.StatusInternalServerError)
+				return
+			}
+		}
+	}
+
+	w.WriteHeader(http.StatusNoContent)
 }
 
 // handleCreateUser cria um novo usuário
@@ -274,64 +652,186 @@ func (s *Server) handleCreateUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var user User
-	if err := json.NewDecoder(r.Body).Decode(&user); err != nil {
+	var req createUserRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
 
 	// Sanitizar entrada
-	user.Username = sanitizeInput(user.Username)
+	req.Username = sanitizeInput(req.Username)
 	// Não sanitizar senha
 
-	// Validar campos
-	if len(user.Username) < 3 || len(user.Password) < 8 {
-		http.Error(w, "Invalid input", http.StatusBadRequest)
+	// Validar campos a partir das tags `validate`, retornando todos os
+	// campos inválidos de uma vez
+	if err := validate.Struct(req); err != nil {
+		var errs validate.ValidationErrors
+		errors.As(err, &errs)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"error":  "Invalid input",
+			"errors": errs,
+		})
 		return
 	}
 
-	// Verificar se usuário já existe
-	if _, exists := s.store.GetByUsername(user.Username); exists {
-		http.Error(w, "Username already exists", http.StatusConflict)
+	hash, err := s.passwords.Hash(req.Password)
+	if err != nil {
+		http.Error(w, "Error creating user", http.StatusInternalServerError)
+		return
+	}
+	id, err := newUserID()
+	if err != nil {
+		http.Error(w, "Error creating user", http.StatusInternalServerError)
 		return
 	}
 
-	// Criar usuário
-	user.ID = fmt.Sprintf("user_%d", time.Now().UnixNano())
-	user.Role = "user" // Role padrão
-	s.store.Add(user)
+	// Criar usuário. A checagem de username e a gravação são uma única
+	// operação, então cadastros simultâneos não geram duplicatas.
+	user := User{
+		ID:           id,
+		Username:     req.Username,
+		PasswordHash: hash,
+		Role:         "user", // Role padrão
+	}
+	if err := s.store.CreateIfAbsent(r.Context(), user); err != nil {
+		if errors.Is(err, ErrUserExists) {
+			http.Error(w, "Username already exists", http.StatusConflict)
+			return
+		}
+		http.Error(w, "Error creating user", http.StatusInternalServerError)
+		return
+	}
 
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(user)
 }
 
-func main() {
-	// Criar servidor
-	server := NewServer()
+// bootstrapAdmin cria um usuário admin se o username ainda não existir. As
+// rotas administrativas ficam recusadas até ele ativar o MFA.
+func (s *Server) bootstrapAdmin(username, password string) error {
+	ctx := context.Background()
+	if _, err := s.store.GetByUsername(ctx, username); err == nil {
+		return nil
+	}
+	req := createUserRequest{Username: username, Password: password}
+	if err := validate.Struct(req); err != nil {
+		return err
+	}
+	hash, err := s.passwords.Hash(password)
+	if err != nil {
+		return err
+	}
+	id, err := newUserID()
+	if err != nil {
+		return err
+	}
+	err = s.store.CreateIfAbsent(ctx, User{
+		ID:           id,
+		Username:     username,
+		PasswordHash: hash,
+		Role:         adminRole,
+	})
+	if errors.Is(err, ErrUserExists) {
+		return nil
+	}
+	return err
+}
+
+// newUserID gera um ID aleatório, que não colide entre cadastros
+// simultâneos nem entre réplicas
+func newUserID() (string, error) {
+	id, err := randomToken(12)
+	if err != nil {
+		return "", err
+	}
+	return "user_" + id, nil
+}
 
-	// Criar mux e adicionar rotas
+// Routes cria o mux com todas as rotas e aplica os middlewares globais
+func (s *Server) Routes() http.Handler {
 	mux := http.NewServeMux()
 
+	// Cada rota declara sua política de rate limiting
+	handle := func(pattern string, policy RateLimitPolicy, h http.Handler) {
+		mux.Handle(pattern, s.RateLimit(policy)(h))
+	}
+
 	// Rotas públicas
-	mux.HandleFunc("/login", server.handleLogin)
-	mux.HandleFunc("/users", server.handleCreateUser)
+	handle("/login", loginRateLimit, http.HandlerFunc(s.handleLogin))
+	handle("POST /login/mfa", loginRateLimit, http.HandlerFunc(s.handleLoginMFA))
+	handle("/users", defaultRateLimit, http.HandlerFunc(s.handleCreateUser))
+	handle("/token/refresh", defaultRateLimit, http.HandlerFunc(s.handleRefresh))
+	handle("/.well-known/jwks.json", defaultRateLimit, http.HandlerFunc(s.keys.ServeJWKS))
+
+	// O token CSRF fica vinculado ao usuário autenticado
+	handle("/csrf", defaultRateLimit, s.authMiddleware(http.HandlerFunc(s.handleCSRFToken)))
+
+	// Logout e MFA usam apenas o bearer token, que o navegador não envia sozinho,
+	// então não precisa de CSRF. API keys não são aceitas: uma chave vazada
+	// não pode trocar o segundo fator do dono.
+	handle("/logout", defaultRateLimit, s.authMiddleware(http.HandlerFunc(s.handleLogout)))
+	handle("POST /mfa/enroll", defaultRateLimit, s.authMiddleware(http.HandlerFunc(s.handleMFAEnroll)))
+	handle("POST /mfa/confirm", defaultRateLimit, s.authMiddleware(http.HandlerFunc(s.handleMFAConfirm)))
+
+	// API keys são gerenciadas apenas com um JWT
+	handle("POST /api-keys", defaultRateLimit, s.authMiddleware(http.HandlerFunc(s.handleCreateAPIKey)))
+	handle("GET /api-keys", defaultRateLimit, s.authMiddleware(http.HandlerFunc(s.handleListAPIKeys)))
+	handle("DELETE /api-keys/{id}", defaultRateLimit, s.authMiddleware(http.HandlerFunc(s.handleRevokeAPIKey)))
+
+	// Rotas administrativas, pelo mesmo motivo também sem CSRF. Aceitam
+	// API keys, limitadas pelos escopos em RequirePermission.
+	handle("GET /admin/users", defaultRateLimit, s.apiKeyAuthMiddleware(
+		s.RequirePermission(PermUsersRead)(http.HandlerFunc(s.handleListUsers))))
+	handle("PUT /admin/users/{id}/role", defaultRateLimit, s.apiKeyAuthMiddleware(
+		s.RequirePermission(PermUsersWrite)(http.HandlerFunc(s.handleSetRole))))
+	handle("DELETE /admin/users/{id}/lockout", defaultRateLimit, s.apiKeyAuthMiddleware(
+		s.RequirePermission(PermUsersWrite)(http.HandlerFunc(s.handleUnlockUser))))
+
+	// Páginas com cookie de sessão. O navegador envia o cookie sozinho,
+	// então todo POST passa pelo csrfMiddleware; no login, o token é o de
+	// uma sessão anônima.
+	handle("GET /session/login", defaultRateLimit, http.HandlerFunc(s.handleLoginPage))
+	handle("POST /session/login", loginRateLimit, s.csrfMiddleware(http.HandlerFunc(s.handleSessionLogin)))
+	handle("GET /dashboard", defaultRateLimit, s.sessionMiddleware(http.HandlerFunc(s.handleDashboard)))
+	handle("POST /session/logout", defaultRateLimit, s.sessionMiddleware(
+		s.csrfMiddleware(http.HandlerFunc(s.handleSessionLogout))))
 
 	// Rotas protegidas
-	protected := server.authMiddleware(
-		server.csrfMiddleware(
+	protected := s.apiKeyAuthMiddleware(
+		s.csrfMiddleware(
 			http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 				// Exemplo de rota protegida
-				claims := r.Context().Value("claims").(*Claims)
+				p, ok := auth.PrincipalFrom(r.Context())
+				if !ok {
+					http.Error(w, "Authentication required", http.StatusUnauthorized)
+					return
+				}
 				json.NewEncoder(w).Encode(map[string]string{
-					"message": fmt.Sprintf("Hello, %s!", claims.UserID),
+					"message": fmt.Sprintf("Hello, %s!", p.Subject),
 				})
 			}),
 		),
 	)
-	mux.Handle("/protected", protected)
+	handle("/protected", protectedRateLimit, protected)
 
 	// Aplicar middlewares globais
-	handler := securityHeadersMiddleware(server.limiter.Middleware(mux))
+	return securityHeadersMiddleware(s.loggingMiddleware(mux))
+}
+
+func main() {
+	// Criar servidor
+	server := NewServer()
+
+	// Cria o primeiro admin; os demais são promovidos por ele
+	if username := os.Getenv("ADMIN_USERNAME"); username != "" {
+		if err := server.bootstrapAdmin(username, os.Getenv("ADMIN_PASSWORD")); err != nil {
+			log.Fatalf("Erro ao criar admin: %v", err)
+		}
+	}
+
+	handler := server.Routes()
 
 	// Configurar servidor HTTP
 	srv := &http.Server{
@@ -370,4 +870,4 @@ func main() {
 	}
 
 	log.Println("Servidor desligado")
-} 
\ No newline at end of file
+}
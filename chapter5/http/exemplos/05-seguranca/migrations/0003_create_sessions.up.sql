@@ -0,0 +1,9 @@
+CREATE TABLE sessions (
+    id TEXT PRIMARY KEY, -- hash do ID enviado no cookie
+    user_id TEXT NOT NULL DEFAULT '',
+    flashes TEXT NOT NULL DEFAULT '[]', -- JSON
+    created_at INTEGER NOT NULL, -- Unix em nanossegundos
+    last_seen INTEGER NOT NULL
+);
+
+CREATE INDEX sessions_last_seen ON sessions (last_seen);
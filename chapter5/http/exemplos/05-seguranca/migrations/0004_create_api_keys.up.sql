@@ -0,0 +1,12 @@
+CREATE TABLE api_keys (
+    id TEXT PRIMARY KEY,
+    user_id TEXT NOT NULL REFERENCES users (id),
+    name TEXT NOT NULL,
+    prefix TEXT NOT NULL,
+    hash TEXT NOT NULL UNIQUE, -- SHA-256 da chave
+    scopes TEXT NOT NULL DEFAULT '[]', -- JSON
+    created_at INTEGER NOT NULL, -- Unix em nanossegundos
+    last_used_at INTEGER -- NULL enquanto a chave não for usada
+);
+
+CREATE INDEX api_keys_user_id ON api_keys (user_id);
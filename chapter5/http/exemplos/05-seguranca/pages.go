@@ -0,0 +1,174 @@
+package main
+
+import (
+	"embed"
+	"errors"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/cauelz/full-cycle-golang-expert/pkg/auth"
+)
+
+// Páginas renderizadas no servidor, autenticadas por cookie de sessão
+//
+//go:embed templates
+var templatesFS embed.FS
+
+var pages = template.Must(template.ParseFS(templatesFS, "templates/*.html"))
+
+// pageData são os dados comuns às páginas
+type pageData struct {
+	Flashes   []string
+	CSRFToken string
+	User      User
+}
+
+// render executa o template com um token CSRF novo, também gravado no
+// cookie, para os formulários da página
+func (s *Server) render(w http.ResponseWriter, r *http.Request, name string, data pageData) {
+	flashes, err := s.sessions.Flashes(r)
+	if err != nil {
+		http.Error(w, "Error loading session", http.StatusInternalServerError)
+		return
+	}
+	data.Flashes = flashes
+
+	if data.CSRFToken, err = s.generateCSRFToken(csrfSessionID(r)); err != nil {
+		http.Error(w, "Error generating CSRF token", http.StatusInternalServerError)
+		return
+	}
+	s.setCSRFCookie(w, data.CSRFToken)
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	if err := pages.ExecuteTemplate(w, name, data); err != nil {
+		log.Printf("Erro ao renderizar %s: %v", name, err)
+	}
+}
+
+// sessionMiddleware autentica pelo cookie de sessão e produz o mesmo
+// Principal de authMiddleware. Sem sessão, páginas redirecionam para o
+// login. Rotas que alteram estado precisam também de csrfMiddleware, já
+// que o navegador envia o cookie sozinho.
+func (s *Server) sessionMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		session, ok, err := s.sessions.Get(r)
+		if err != nil {
+			http.Error(w, "Error loading session", http.StatusInternalServerError)
+			return
+		}
+		if !ok || session.UserID == "" {
+			if r.Method == "GET" {
+				http.Redirect(w, r, "/session/login", http.StatusSeeOther)
+				return
+			}
+			http.Error(w, "Authentication required", http.StatusUnauthorized)
+			return
+		}
+
+		// Como nas API keys, a role é lida a cada requisição
+		user, err := s.store.Get(r.Context(), session.UserID)
+		if errors.Is(err, ErrUserNotFound) {
+			s.sessions.Logout(w, r)
+			http.Error(w, "Authentication required", http.StatusUnauthorized)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Error loading user", http.StatusInternalServerError)
+			return
+		}
+
+		// TokenID é o hash do ID da sessão, ao qual o token CSRF se vincula
+		ctx := auth.WithPrincipal(r.Context(), auth.Principal{
+			Subject:   user.ID,
+			Role:      user.Role,
+			TokenID:   session.ID,
+			ExpiresAt: session.CreatedAt.Add(s.sessions.cfg.AbsoluteTimeout),
+		})
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// handleLoginPage exibe o formulário de login
+func (s *Server) handleLoginPage(w http.ResponseWriter, r *http.Request) {
+	s.render(w, r, "login.html", pageData{})
+}
+
+// handleSessionLogin autentica pelo formulário e inicia a sessão. Com MFA
+// ativo, o código do autenticador vai no mesmo formulário. Falhas voltam ao
+// formulário com uma mensagem flash.
+func (s *Server) handleSessionLogin(w http.ResponseWriter, r *http.Request) {
+	username := sanitizeInput(r.PostFormValue("username"))
+	password := r.PostFormValue("password")
+
+	user, err := s.checkPassword(r.Context(), username, password)
+	var locked *lockedError
+	switch {
+	case errors.As(err, &locked):
+		minutes := int(locked.remaining.Round(time.Minute).Minutes())
+		s.loginFailed(w, r, fmt.Sprintf("Conta bloqueada temporariamente. Tente novamente em %d min.", max(minutes, 1)))
+		return
+	case errors.Is(err, errInvalidCredentials):
+		s.loginFailed(w, r, "Usuário, senha ou código inválidos.")
+		return
+	case err != nil:
+		http.Error(w, "Error loading user", http.StatusInternalServerError)
+		return
+	}
+
+	// A mesma mensagem de senha errada, para não confirmar a senha a quem
+	// não tem o segundo fator
+	if user.MFAEnabled {
+		valid, err := s.verifySecondFactor(r, user, r.PostFormValue("code"), "")
+		if err != nil {
+			http.Error(w, "Error verifying code", http.StatusInternalServerError)
+			return
+		}
+		if !valid {
+			s.lockout.RecordFailure(username)
+			s.loginFailed(w, r, "Usuário, senha ou código inválidos.")
+			return
+		}
+	}
+	s.lockout.RecordSuccess(username)
+
+	if err := s.sessions.Login(w, r, user.ID, "Login realizado."); err != nil {
+		http.Error(w, "Error creating session", http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, "/dashboard", http.StatusSeeOther)
+}
+
+// loginFailed volta ao formulário de login com a mensagem
+func (s *Server) loginFailed(w http.ResponseWriter, r *http.Request, message string) {
+	if err := s.sessions.AddFlash(w, r, message); err != nil {
+		http.Error(w, "Error saving session", http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, "/session/login", http.StatusSeeOther)
+}
+
+// handleDashboard é a página inicial do usuário logado
+func (s *Server) handleDashboard(w http.ResponseWriter, r *http.Request) {
+	user, ok := s.currentUser(w, r)
+	if !ok {
+		return
+	}
+	s.render(w, r, "dashboard.html", pageData{User: user})
+}
+
+// handleSessionLogout encerra a sessão
+func (s *Server) handleSessionLogout(w http.ResponseWriter, r *http.Request) {
+	if err := s.sessions.Logout(w, r); err != nil {
+		http.Error(w, "Error ending session", http.StatusInternalServerError)
+		return
+	}
+	if err := s.sessions.AddFlash(w, r, "Você saiu da sua conta."); err != nil {
+		http.Error(w, "Error saving session", http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, "/session/login", http.StatusSeeOther)
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// ErrUnknownHash indica um hash em formato que nenhum hasher reconhece
+var ErrUnknownHash = errors.New("formato de hash desconhecido")
+
+// PasswordHasher gera e verifica hashes de senha. O hash codificado carrega
+// o algoritmo e os parâmetros usados, então pode ser verificado mesmo depois
+// que a configuração mudar.
+type PasswordHasher interface {
+	// Hash gera o hash codificado da senha com um salt aleatório
+	Hash(password string) (string, error)
+	// Identify informa se o hash foi gerado por este algoritmo
+	Identify(encoded string) bool
+	// Verify compara a senha com o hash em tempo constante
+	Verify(password, encoded string) (bool, error)
+	// NeedsRehash informa se o hash usa parâmetros diferentes dos atuais
+	NeedsRehash(encoded string) bool
+}
+
+// BcryptHasher usa bcrypt; o custo fica codificado no próprio hash
+type BcryptHasher struct {
+	Cost int
+}
+
+func (h BcryptHasher) Hash(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), h.Cost)
+	return string(hash), err
+}
+
+func (h BcryptHasher) Identify(encoded string) bool {
+	return strings.HasPrefix(encoded, "$2a$") ||
+		strings.HasPrefix(encoded, "$2b$") ||
+		strings.HasPrefix(encoded, "$2y$")
+}
+
+func (h BcryptHasher) Verify(password, encoded string) (bool, error) {
+	// CompareHashAndPassword já compara em tempo constante
+	err := bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password))
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (h BcryptHasher) NeedsRehash(encoded string) bool {
+	cost, err := bcrypt.Cost([]byte(encoded))
+	return err != nil || cost != h.Cost
+}
+
+// Argon2idHasher usa argon2id com hash no formato PHC:
+//
+//	$argon2id$v=19$m=65536,t=3,p=2$<salt>$<hash>
+type Argon2idHasher struct {
+	Time    uint32
+	Memory  uint32 // em KiB
+	Threads uint8
+	KeyLen  uint32
+	SaltLen uint32
+}
+
+// DefaultArgon2id retorna os parâmetros recomendados pela RFC 9106 para
+// ambientes com memória limitada
+func DefaultArgon2id() Argon2idHasher {
+	return Argon2idHasher{Time: 3, Memory: 64 * 1024, Threads: 2, KeyLen: 32, SaltLen: 16}
+}
+
+// Limites aceitos ao ler um hash argon2id. O hash vem do banco, e um valor
+// corrompido não pode derrubar o processo (p=0 causa panic em argon2.IDKey)
+// nem alocar memória sem limite a cada login.
+const (
+	maxArgon2Memory = 1 << 20 // KiB, 1 GiB
+	maxArgon2Time   = 16
+	minArgon2KeyLen = 16
+	maxArgon2KeyLen = 64
+	minArgon2Salt   = 8
+)
+
+// argon2Params são os parâmetros lidos de um hash codificado
+type argon2Params struct {
+	version int
+	time    uint32
+	memory  uint32
+	threads uint8
+	salt    []byte
+	key     []byte
+}
+
+func (h Argon2idHasher) Hash(password string) (string, error) {
+	salt := make([]byte, h.SaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(password), salt, h.Time, h.Memory, h.Threads, h.KeyLen)
+	b64 := base64.RawStdEncoding
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, h.Memory, h.Time, h.Threads,
+		b64.EncodeToString(salt), b64.EncodeToString(key)), nil
+}
+
+func (h Argon2idHasher) Identify(encoded string) bool {
+	return strings.HasPrefix(encoded, "$argon2id$")
+}
+
+func (h Argon2idHasher) Verify(password, encoded string) (bool, error) {
+	p, err := parseArgon2id(encoded)
+	if err != nil {
+		return false, err
+	}
+	// A verificação usa os parâmetros do hash, não os atuais
+	key := argon2.IDKey([]byte(password), p.salt, p.time, p.memory, p.threads, uint32(len(p.key)))
+	return subtle.ConstantTimeCompare(key, p.key) == 1, nil
+}
+
+func (h Argon2idHasher) NeedsRehash(encoded string) bool {
+	p, err := parseArgon2id(encoded)
+	if err != nil {
+		return true
+	}
+	return p.version != argon2.Version || p.time != h.Time || p.memory != h.Memory ||
+		p.threads != h.Threads || uint32(len(p.key)) != h.KeyLen || uint32(len(p.salt)) != h.SaltLen
+}
+
+func parseArgon2id(encoded string) (argon2Params, error) {
+	var p argon2Params
+	parts := strings.Split(encoded, "$")
+	// "", "argon2id", "v=19", "m=...,t=...,p=...", salt, hash
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return p, ErrUnknownHash
+	}
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &p.version); err != nil {
+		return p, fmt.Errorf("argon2id: versão inválida: %w", err)
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.memory, &p.time, &p.threads); err != nil {
+		return p, fmt.Errorf("argon2id: parâmetros inválidos: %w", err)
+	}
+	var err error
+	if p.salt, err = base64.RawStdEncoding.DecodeString(parts[4]); err != nil {
+		return p, fmt.Errorf("argon2id: salt inválido: %w", err)
+	}
+	if p.key, err = base64.RawStdEncoding.DecodeString(parts[5]); err != nil {
+		return p, fmt.Errorf("argon2id: hash inválido: %w", err)
+	}
+	switch {
+	case p.time < 1 || p.time > maxArgon2Time:
+		return p, fmt.Errorf("argon2id: t=%d fora do intervalo 1..%d", p.time, maxArgon2Time)
+	case p.threads < 1:
+		return p, fmt.Errorf("argon2id: p=%d deve ser pelo menos 1", p.threads)
+	case p.memory < 8*uint32(p.threads) || p.memory > maxArgon2Memory:
+		return p, fmt.Errorf("argon2id: m=%d fora do intervalo %d..%d", p.memory, 8*uint32(p.threads), maxArgon2Memory)
+	case len(p.key) < minArgon2KeyLen || len(p.key) > maxArgon2KeyLen:
+		return p, fmt.Errorf("argon2id: hash de %d bytes fora do intervalo %d..%d", len(p.key), minArgon2KeyLen, maxArgon2KeyLen)
+	case len(p.salt) < minArgon2Salt:
+		return p, fmt.Errorf("argon2id: salt de %d bytes, mínimo %d", len(p.salt), minArgon2Salt)
+	}
+	return p, nil
+}
+
+// PasswordManager gera hashes com o hasher atual e verifica hashes de
+// qualquer hasher conhecido. Quando o hash armazenado usa outro algoritmo
+// ou parâmetros antigos, Verify devolve um novo hash para ser salvo
+// (rehash transparente no login).
+type PasswordManager struct {
+	current PasswordHasher
+	hashers []PasswordHasher
+	// dummy é verificado quando o usuário não existe, para que o tempo de
+	// resposta não revele quais usernames estão cadastrados
+	dummy string
+}
+
+// NewPasswordManager cria o gerenciador. legacy são hashers aceitos apenas
+// para verificação de hashes antigos.
+func NewPasswordManager(current PasswordHasher, legacy ...PasswordHasher) (*PasswordManager, error) {
+	dummy, err := current.Hash("senha-inexistente")
+	if err != nil {
+		return nil, err
+	}
+	return &PasswordManager{
+		current: current,
+		hashers: append([]PasswordHasher{current}, legacy...),
+		dummy:   dummy,
+	}, nil
+}
+
+// Hash gera o hash da senha com o hasher atual
+func (m *PasswordManager) Hash(password string) (string, error) {
+	return m.current.Hash(password)
+}
+
+// Verify confere a senha. Se ela estiver correta e o hash precisar ser
+// atualizado, rehash contém o novo hash; caso contrário, é vazio.
+func (m *PasswordManager) Verify(password, encoded string) (ok bool, rehash string, err error) {
+	for _, h := range m.hashers {
+		if !h.Identify(encoded) {
+			continue
+		}
+		if ok, err = h.Verify(password, encoded); err != nil || !ok {
+			return false, "", err
+		}
+		if h != m.current || m.current.NeedsRehash(encoded) {
+			if rehash, err = m.current.Hash(password); err != nil {
+				// A senha está correta; o rehash fica para o próximo login
+				return true, "", nil
+			}
+		}
+		return true, rehash, nil
+	}
+	return false, "", ErrUnknownHash
+}
+
+// VerifyDummy consome o mesmo tempo de uma verificação real; deve ser
+// chamado quando o usuário não é encontrado
+func (m *PasswordManager) VerifyDummy(password string) {
+	m.current.Verify(password, m.dummy)
+}
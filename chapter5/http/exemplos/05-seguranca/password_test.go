@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// fastArgon2id usa parâmetros baixos para os testes não ficarem lentos
+func fastArgon2id() Argon2idHasher {
+	return Argon2idHasher{Time: 1, Memory: 1024, Threads: 1, KeyLen: 32, SaltLen: 16}
+}
+
+func TestPasswordHashers(t *testing.T) {
+	hashers := []PasswordHasher{fastArgon2id(), BcryptHasher{Cost: bcrypt.MinCost}}
+	for _, h := range hashers {
+		hash, err := h.Hash("senha-secreta")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !h.Identify(hash) {
+			t.Errorf("%T não reconhece o próprio hash %q", h, hash)
+		}
+		if ok, err := h.Verify("senha-secreta", hash); !ok || err != nil {
+			t.Errorf("%T: senha correta rejeitada (%v)", h, err)
+		}
+		if ok, _ := h.Verify("senha-errada", hash); ok {
+			t.Errorf("%T: senha errada aceita", h)
+		}
+		if h.NeedsRehash(hash) {
+			t.Errorf("%T: hash recém-gerado não deveria precisar de rehash", h)
+		}
+	}
+}
+
+func TestPasswordManagerRehash(t *testing.T) {
+	legacy := BcryptHasher{Cost: bcrypt.MinCost}
+	oldHash, _ := legacy.Hash("senha-secreta")
+
+	m, err := NewPasswordManager(fastArgon2id(), legacy)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Hash bcrypt antigo é aceito e convertido para argon2id
+	ok, rehash, err := m.Verify("senha-secreta", oldHash)
+	if !ok || err != nil {
+		t.Fatalf("hash legado rejeitado: %v", err)
+	}
+	if !strings.HasPrefix(rehash, "$argon2id$") {
+		t.Fatalf("esperado rehash argon2id, obtido %q", rehash)
+	}
+
+	// Senha errada nunca gera rehash
+	if ok, rehash, _ := m.Verify("senha-errada", oldHash); ok || rehash != "" {
+		t.Errorf("senha errada: ok=%v rehash=%q", ok, rehash)
+	}
+
+	// Hash atual não precisa de rehash
+	if _, again, _ := m.Verify("senha-secreta", rehash); again != "" {
+		t.Errorf("hash atual não deveria gerar rehash")
+	}
+
+	// Mudança de parâmetros dispara rehash
+	stronger := fastArgon2id()
+	stronger.Time = 2
+	m2, _ := NewPasswordManager(stronger)
+	if _, again, _ := m2.Verify("senha-secreta", rehash); !strings.Contains(again, "t=2") {
+		t.Errorf("esperado rehash com t=2, obtido %q", again)
+	}
+
+	if _, _, err := m.Verify("senha-secreta", "texto-puro"); err != ErrUnknownHash {
+		t.Errorf("esperado ErrUnknownHash, obtido %v", err)
+	}
+}
+
+func TestArgon2idMalformedHash(t *testing.T) {
+	h := fastArgon2id()
+	valid, err := h.Hash("senha-secreta")
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts := strings.Split(valid, "$")
+	salt, key := parts[4], parts[5]
+
+	tests := map[string]string{
+		"p=0":         "$argon2id$v=19$m=1024,t=1,p=0$" + salt + "$" + key,
+		"t=0":         "$argon2id$v=19$m=1024,t=0,p=1$" + salt + "$" + key,
+		"t enorme":    "$argon2id$v=19$m=1024,t=1000000,p=1$" + salt + "$" + key,
+		"m enorme":    "$argon2id$v=19$m=4294967295,t=1,p=1$" + salt + "$" + key,
+		"m pequeno":   "$argon2id$v=19$m=1,t=1,p=4$" + salt + "$" + key,
+		"p estoura":   "$argon2id$v=19$m=1024,t=1,p=300$" + salt + "$" + key,
+		"hash curto":  "$argon2id$v=19$m=1024,t=1,p=1$" + salt + "$AAAA",
+		"hash enorme": "$argon2id$v=19$m=1024,t=1,p=1$" + salt + "$" + base64.RawStdEncoding.EncodeToString(make([]byte, 128)),
+		"sem salt":    "$argon2id$v=19$m=1024,t=1,p=1$$" + key,
+	}
+	for name, encoded := range tests {
+		if ok, err := h.Verify("senha-secreta", encoded); ok || err == nil {
+			t.Errorf("%s: esperado erro, obtido ok=%v err=%v", name, ok, err)
+		}
+	}
+	if ok, err := h.Verify("senha-secreta", valid); !ok || err != nil {
+		t.Errorf("hash válido: obtido ok=%v err=%v", ok, err)
+	}
+}
+
+func TestUserJSONOmitsPassword(t *testing.T) {
+	data, _ := json.Marshal(User{ID: "1", Username: "ana", PasswordHash: "$argon2id$segredo"})
+	if strings.Contains(string(data), "segredo") || strings.Contains(string(data), "password") {
+		t.Errorf("User serializado expõe a senha: %s", data)
+	}
+}
@@ -1,63 +1,289 @@
 package main
 
 import (
+	"container/list"
+	"hash/fnv"
+	"log"
+	"math"
+	"net"
 	"net/http"
+	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"golang.org/x/time/rate"
 )
 
-// IPRateLimiter implementa rate limiting por IP
+// KeyFunc extrai da requisição a chave que agrupa as requisições de um
+// mesmo cliente. Chaves diferentes têm limites independentes.
+type KeyFunc func(r *http.Request) string
+
+// KeyByIP agrupa por IP do cliente
+func KeyByIP(resolver *IPResolver) KeyFunc {
+	return func(r *http.Request) string {
+		return "ip:" + resolver.ClientIP(r)
+	}
+}
+
+// KeyByIPPrefix agrupa clientes IPv6 pelo prefixo de bits (normalmente
+// 64): um único assinante costuma receber um /64 inteiro e poderia trocar
+// de endereço a cada requisição. Endereços IPv4 continuam agrupados por IP.
+func KeyByIPPrefix(resolver *IPResolver, bits int) KeyFunc {
+	mask := net.CIDRMask(bits, 128)
+	return func(r *http.Request) string {
+		client := resolver.ClientIP(r)
+		ip := net.ParseIP(client)
+		if ip == nil || ip.To4() != nil {
+			return "ip:" + client
+		}
+		return "ip:" + ip.Mask(mask).String()
+	}
+}
+
+// KeyByAPIKey agrupa pela API key do header "Authorization: ApiKey". A
+// chave é buscada no store, então chaves inventadas, que dariam um balde
+// novo a cada requisição, caem no fallback junto com as anônimas.
+func (s *Server) KeyByAPIKey(fallback KeyFunc) KeyFunc {
+	return func(r *http.Request) string {
+		apiKey, ok := s.rateLimitAPIKey(r)
+		if !ok {
+			return fallback(r)
+		}
+		return "apikey:" + apiKey.ID
+	}
+}
+
+// rateLimitAPIKey busca a API key do header Authorization, se houver uma
+// cadastrada
+func (s *Server) rateLimitAPIKey(r *http.Request) (APIKey, bool) {
+	key, ok := strings.CutPrefix(r.Header.Get("Authorization"), "ApiKey ")
+	if !ok || !strings.HasPrefix(key, apiKeyPrefix) {
+		return APIKey{}, false
+	}
+	apiKey, err := s.apiKeys.GetByHash(r.Context(), hashAPIKey(key))
+	if err != nil {
+		return APIKey{}, false
+	}
+	return apiKey, true
+}
+
+// KeyByUser agrupa pelo usuário do JWT ou da API key, de modo que o limite
+// acompanha o usuário em qualquer IP. Requisições sem credencial válida
+// usam fallback. O rate limiting roda antes de authMiddleware, então a
+// credencial é verificada aqui mesmo: aceitar claims sem assinatura
+// deixaria o cliente escolher a própria chave.
+func (s *Server) KeyByUser(fallback KeyFunc) KeyFunc {
+	return func(r *http.Request) string {
+		if apiKey, ok := s.rateLimitAPIKey(r); ok {
+			return "user:" + apiKey.UserID
+		}
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok {
+			return fallback(r)
+		}
+		// Tokens mfa_pending também caem no fallback: antes do segundo
+		// fator, o cliente ainda não provou ser o usuário
+		claims, err := s.validateToken(token, accessTokenAudience)
+		if err != nil {
+			return fallback(r)
+		}
+		return "user:" + claims.UserID
+	}
+}
+
+// RateLimiterConfig configura o IPRateLimiter
+type RateLimiterConfig struct {
+	// Name identifica o limiter nos logs
+	Name  string
+	Rate  rate.Limit
+	Burst int
+	// MaxKeys limita quantas chaves ficam em memória; ao atingir o limite,
+	// a usada há mais tempo é descartada
+	MaxKeys int
+	// IdleTTL descarta chaves sem requisições há mais que isso. Deve ser
+	// maior que Burst/Rate, o tempo para o balde encher de novo; antes
+	// disso, descartar a chave devolveria créditos ao cliente.
+	IdleTTL time.Duration
+	// Shards divide as chaves entre locks independentes
+	Shards int
+	// Key agrupa as requisições; o padrão é KeyByIP sem proxies confiáveis
+	Key KeyFunc
+	// DryRun apenas registra no log as requisições que seriam rejeitadas
+	DryRun bool
+}
+
+// Valores padrão de RateLimiterConfig
+const (
+	defaultMaxKeys = 100_000
+	defaultIdleTTL = 10 * time.Minute
+	defaultShards  = 64
+)
+
+// IPRateLimiter implementa rate limiting por chave (IP, usuário, API key).
+//
+// As chaves ficam em shards, cada um com seu lock e sua lista LRU, de modo
+// que requisições de clientes diferentes raramente disputam o mesmo lock e
+// a memória fica limitada a MaxKeys, mesmo com milhões de chaves distintas.
 type IPRateLimiter struct {
-	ips    map[string]*rate.Limiter
-	mu     sync.RWMutex
+	name   string
+	shards []*limiterShard
 	rate   rate.Limit
 	burst  int
+	ttl    time.Duration
+	key    KeyFunc
+	dryRun bool
+	now    func() time.Time
+}
+
+// limiterShard guarda parte das chaves, da mais recente (frente da lista)
+// para a usada há mais tempo (fundo)
+type limiterShard struct {
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	lru     *list.List
+	max     int
 }
 
-// NewIPRateLimiter cria um novo rate limiter por IP
+type limiterEntry struct {
+	key      string
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// NewIPRateLimiter cria um rate limiter por IP com os limites padrão de
+// memória
 func NewIPRateLimiter(r rate.Limit, b int) *IPRateLimiter {
+	return NewRateLimiter(RateLimiterConfig{Rate: r, Burst: b})
+}
+
+// NewRateLimiter cria um rate limiter a partir da configuração
+func NewRateLimiter(cfg RateLimiterConfig) *IPRateLimiter {
+	if cfg.MaxKeys <= 0 {
+		cfg.MaxKeys = defaultMaxKeys
+	}
+	if cfg.IdleTTL <= 0 {
+		cfg.IdleTTL = defaultIdleTTL
+	}
+	if cfg.Shards <= 0 {
+		cfg.Shards = defaultShards
+	}
+	if cfg.Shards > cfg.MaxKeys {
+		cfg.Shards = cfg.MaxKeys
+	}
+	if cfg.Key == nil {
+		cfg.Key = KeyByIP(nil)
+	}
+
+	// Divide MaxKeys entre os shards; os primeiros recebem o resto
+	shards := make([]*limiterShard, cfg.Shards)
+	for i := range shards {
+		max := cfg.MaxKeys / cfg.Shards
+		if i < cfg.MaxKeys%cfg.Shards {
+			max++
+		}
+		shards[i] = &limiterShard{
+			entries: make(map[string]*list.Element),
+			lru:     list.New(),
+			max:     max,
+		}
+	}
 	return &IPRateLimiter{
-		ips:   make(map[string]*rate.Limiter),
-		rate:  r,
-		burst: b,
+		name:   cfg.Name,
+		shards: shards,
+		rate:   cfg.Rate,
+		burst:  cfg.Burst,
+		ttl:    cfg.IdleTTL,
+		key:    cfg.Key,
+		dryRun: cfg.DryRun,
+		now:    time.Now,
 	}
 }
 
-// AddIP adiciona um IP ao rate limiter
-func (i *IPRateLimiter) AddIP(ip string) *rate.Limiter {
-	i.mu.Lock()
-	defer i.mu.Unlock()
+// shard escolhe o shard da chave
+func (i *IPRateLimiter) shard(key string) *limiterShard {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return i.shards[h.Sum32()%uint32(len(i.shards))]
+}
 
-	limiter := rate.NewLimiter(i.rate, i.burst)
-	i.ips[ip] = limiter
+// GetLimiter retorna o rate limiter da chave, criando-o se necessário.
+// Busca e criação acontecem sob o mesmo lock, então requisições
+// simultâneas da mesma chave sempre compartilham o limiter.
+func (i *IPRateLimiter) GetLimiter(key string) *rate.Limiter {
+	s := i.shard(key)
+	now := i.now()
 
-	return limiter
-}
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
-// GetLimiter retorna o rate limiter para um IP
-func (i *IPRateLimiter) GetLimiter(ip string) *rate.Limiter {
-	i.mu.Lock()
-	limiter, exists := i.ips[ip]
+	if el, ok := s.entries[key]; ok {
+		entry := el.Value.(*limiterEntry)
+		entry.lastSeen = now
+		s.lru.MoveToFront(el)
+		return entry.limiter
+	}
 
-	if !exists {
-		i.mu.Unlock()
-		return i.AddIP(ip)
+	// Descarta as chaves ociosas e, se ainda faltar espaço, as usadas há
+	// mais tempo
+	for el := s.lru.Back(); el != nil; el = s.lru.Back() {
+		entry := el.Value.(*limiterEntry)
+		if s.lru.Len() < s.max && now.Sub(entry.lastSeen) <= i.ttl {
+			break
+		}
+		s.lru.Remove(el)
+		delete(s.entries, entry.key)
 	}
 
-	i.mu.Unlock()
-	return limiter
+	entry := &limiterEntry{key: key, limiter: rate.NewLimiter(i.rate, i.burst), lastSeen: now}
+	s.entries[key] = s.lru.PushFront(entry)
+	return entry.limiter
+}
+
+// Len retorna quantas chaves estão em memória
+func (i *IPRateLimiter) Len() int {
+	n := 0
+	for _, s := range i.shards {
+		s.mu.Lock()
+		n += s.lru.Len()
+		s.mu.Unlock()
+	}
+	return n
 }
 
-// Middleware implementa o middleware de rate limiting
+// Middleware implementa o middleware de rate limiting. As respostas
+// informam o estado do balde nos headers RateLimit-Limit,
+// RateLimit-Remaining e RateLimit-Reset (segundos até o balde encher), e as
+// rejeições trazem Retry-After (segundos até a próxima requisição ser
+// aceita).
 func (i *IPRateLimiter) Middleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Obter IP real (considerando proxies)
-		ip := getIP(r)
-		limiter := i.GetLimiter(ip)
+		key := i.key(r)
+		limiter := i.GetLimiter(key)
+		now := i.now()
 
-		if !limiter.Allow() {
+		// Reserva um token; se for preciso esperar por ele, a requisição é
+		// rejeitada e a reserva devolvida
+		reservation := limiter.ReserveN(now, 1)
+		delay := reservation.DelayFrom(now)
+		allowed := reservation.OK() && delay == 0
+		if !allowed {
+			reservation.CancelAt(now)
+		}
+
+		if i.rate != rate.Inf {
+			i.writeHeaders(w, limiter, now)
+		}
+
+		if !allowed {
+			if i.dryRun {
+				log.Printf("rate limit (dry-run): limiter=%s key=%s path=%s", i.name, key, r.URL.Path)
+				next.ServeHTTP(w, r)
+				return
+			}
+			if reservation.OK() {
+				w.Header().Set("Retry-After", strconv.Itoa(ceilSeconds(delay)))
+			}
 			http.Error(w, "Too many requests", http.StatusTooManyRequests)
 			return
 		}
@@ -66,21 +292,88 @@ func (i *IPRateLimiter) Middleware(next http.Handler) http.Handler {
 	})
 }
 
-// getIP extrai o IP real da requisição
-func getIP(r *http.Request) string {
-	// Tentar X-Forwarded-For primeiro
-	ip := r.Header.Get("X-Forwarded-For")
-	if ip != "" {
-		parts := strings.Split(ip, ",")
-		return strings.TrimSpace(parts[0])
+// writeHeaders escreve os headers RateLimit-* a partir do estado do balde
+func (i *IPRateLimiter) writeHeaders(w http.ResponseWriter, limiter *rate.Limiter, now time.Time) {
+	tokens := math.Max(0, limiter.TokensAt(now))
+	reset := 0
+	if i.rate > 0 {
+		missing := float64(i.burst) - tokens
+		reset = ceilSeconds(time.Duration(missing / float64(i.rate) * float64(time.Second)))
+	}
+
+	h := w.Header()
+	h.Set("RateLimit-Limit", strconv.Itoa(i.burst))
+	h.Set("RateLimit-Remaining", strconv.Itoa(int(tokens)))
+	h.Set("RateLimit-Reset", strconv.Itoa(reset))
+}
+
+// ceilSeconds arredonda a duração para cima, em segundos
+func ceilSeconds(d time.Duration) int {
+	if d <= 0 {
+		return 0
 	}
+	return int(math.Ceil(d.Seconds()))
+}
+
+// RateLimitPolicy é o limite declarado para uma rota. Rotas com a mesma
+// política (mesmo Name) compartilham os baldes.
+type RateLimitPolicy struct {
+	Name  string
+	Rate  rate.Limit
+	Burst int
+}
+
+// PerMinute permite n requisições por minuto, todas de uma vez se preciso
+func PerMinute(name string, n int) RateLimitPolicy {
+	return RateLimitPolicy{Name: name, Rate: rate.Every(time.Minute / time.Duration(n)), Burst: n}
+}
+
+// PerSecond permite n requisições por segundo
+func PerSecond(name string, n int) RateLimitPolicy {
+	return RateLimitPolicy{Name: name, Rate: rate.Limit(n), Burst: n}
+}
+
+// Políticas das rotas do servidor
+var (
+	defaultRateLimit   = PerSecond("default", 10)
+	loginRateLimit     = PerMinute("login", 5)
+	protectedRateLimit = PerSecond("protected", 100)
+)
+
+// Modos de rate limiting (RATE_LIMIT_MODE)
+const (
+	rateLimitEnforce = "enforce"
+	rateLimitDryRun  = "dry-run"
+	rateLimitOff     = "off"
+)
 
-	// Tentar X-Real-IP
-	ip = r.Header.Get("X-Real-IP")
-	if ip != "" {
-		return ip
+// limiterFor retorna o limiter da política, criando-o na primeira vez.
+// Os limiters ficam no Server, e não nas rotas, para que sobrevivam a novas
+// chamadas de Routes.
+func (s *Server) limiterFor(p RateLimitPolicy) *IPRateLimiter {
+	s.limitersMu.Lock()
+	defer s.limitersMu.Unlock()
+
+	if l, ok := s.limiters[p.Name]; ok {
+		return l
 	}
+	l := NewRateLimiter(RateLimiterConfig{
+		Name:   p.Name,
+		Rate:   p.Rate,
+		Burst:  p.Burst,
+		Key:    s.rateKey,
+		DryRun: s.rateLimitMode == rateLimitDryRun,
+	})
+	s.limiters[p.Name] = l
+	return l
+}
 
-	// Usar RemoteAddr como fallback
-	return strings.Split(r.RemoteAddr, ":")[0]
-} 
\ No newline at end of file
+// RateLimit aplica a política à rota
+func (s *Server) RateLimit(p RateLimitPolicy) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if s.rateLimitMode == rateLimitOff {
+			return next
+		}
+		return s.limiterFor(p).Middleware(next)
+	}
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+func TestRateLimiterEviction(t *testing.T) {
+	l := NewRateLimiter(RateLimiterConfig{Rate: 1, Burst: 1, MaxKeys: 4, Shards: 1, IdleTTL: time.Minute})
+	now := time.Now()
+	l.now = func() time.Time { return now }
+
+	first := l.GetLimiter("a")
+	for _, key := range []string{"b", "c", "d"} {
+		l.GetLimiter(key)
+	}
+	// "a" foi usada por último e sobrevive; "b" é a mais antiga
+	l.GetLimiter("a")
+	l.GetLimiter("e")
+	if l.Len() != 4 {
+		t.Fatalf("esperado 4 chaves, obtido %d", l.Len())
+	}
+	if l.GetLimiter("a") != first {
+		t.Error("chave usada recentemente não deveria ser descartada")
+	}
+
+	// Todas ficam ociosas; a próxima chave nova limpa as antigas
+	now = now.Add(2 * time.Minute)
+	l.GetLimiter("f")
+	if l.Len() != 1 {
+		t.Errorf("esperado apenas a chave nova, obtido %d", l.Len())
+	}
+}
+
+func TestRateLimiterConcurrentSameKey(t *testing.T) {
+	l := NewRateLimiter(RateLimiterConfig{Rate: rate.Every(time.Hour), Burst: 5})
+
+	// Sem a corrida entre busca e criação, o burst vale para a chave como
+	// um todo
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	allowed := 0
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if l.GetLimiter("ip:203.0.113.7").Allow() {
+				mu.Lock()
+				allowed++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if allowed != 5 {
+		t.Errorf("esperado 5 requisições permitidas, obtido %d", allowed)
+	}
+}
+
+func TestRateLimiterKeys(t *testing.T) {
+	s := newTestServer(t)
+	byIP := KeyByIP(nil)
+
+	req := func(remote string, headers map[string]string) *http.Request {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.RemoteAddr = remote
+		for k, v := range headers {
+			r.Header.Set(k, v)
+		}
+		return r
+	}
+
+	prefix := KeyByIPPrefix(nil, 64)
+	if a, b := prefix(req("[2001:db8::1]:1", nil)), prefix(req("[2001:db8::ffff:2]:1", nil)); a != b {
+		t.Errorf("mesmo /64 deveria ter a mesma chave: %s, %s", a, b)
+	}
+	if a, b := prefix(req("[2001:db8::1]:1", nil)), prefix(req("[2001:db8:0:1::1]:1", nil)); a == b {
+		t.Errorf("prefixos diferentes deveriam ter chaves diferentes: %s", a)
+	}
+	if got := prefix(req("203.0.113.7:1", nil)); got != "ip:203.0.113.7" {
+		t.Errorf("IPv4: esperado ip:203.0.113.7, obtido %s", got)
+	}
+
+	access := login(t, s).AccessToken
+	created := createAPIKey(t, s, access, PermProfileRead)
+	byKey := s.KeyByAPIKey(byIP)
+	withKey := map[string]string{"Authorization": "ApiKey " + created.Key}
+	if a, b := byKey(req("1.1.1.1:1", withKey)), byKey(req("2.2.2.2:1", withKey)); a != b || a != "apikey:"+created.ID {
+		t.Errorf("mesma API key deveria ter a chave apikey:%s: %s, %s", created.ID, a, b)
+	}
+	// Chaves inventadas não escapam do limite do IP
+	for _, key := range []string{apiKeyPrefix + "inventada-1", apiKeyPrefix + "inventada-2", "qualquer"} {
+		if got := byKey(req("1.1.1.1:1", map[string]string{"Authorization": "ApiKey " + key})); got != "ip:1.1.1.1" {
+			t.Errorf("API key %q: esperado ip:1.1.1.1, obtido %s", key, got)
+		}
+	}
+
+	byUser := s.KeyByUser(byIP)
+	ana, _ := s.store.GetByUsername(context.Background(), "ana")
+	if got := byUser(req("1.1.1.1:1", map[string]string{"Authorization": "Bearer " + access})); got != "user:"+ana.ID {
+		t.Errorf("esperado user:%s, obtido %s", ana.ID, got)
+	}
+	if got := byUser(req("1.1.1.1:1", map[string]string{"Authorization": "Bearer forjado"})); got != "ip:1.1.1.1" {
+		t.Errorf("token inválido: esperado ip:1.1.1.1, obtido %s", got)
+	}
+
+	// Antes do segundo fator, o limite continua sendo o do IP
+	pending, err := s.signToken(Claims{UserID: ana.ID, Role: ana.Role}, mfaPendingTokenAudience, mfaPendingTTL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := byUser(req("1.1.1.1:1", map[string]string{"Authorization": "Bearer " + pending})); got != "ip:1.1.1.1" {
+		t.Errorf("token mfa_pending: esperado ip:1.1.1.1, obtido %s", got)
+	}
+}
+
+func TestRateLimiterBoundedMemory(t *testing.T) {
+	if testing.Short() {
+		t.Skip("insere um milhão de chaves")
+	}
+	l := NewRateLimiter(RateLimiterConfig{Rate: 1, Burst: 1, MaxKeys: 10_000})
+	for i := 0; i < 1_000_000; i++ {
+		l.GetLimiter(strconv.Itoa(i))
+	}
+	if n := l.Len(); n > 10_000 {
+		t.Errorf("esperado no máximo 10000 chaves, obtido %d", n)
+	}
+}
+
+func TestRateLimitHeaders(t *testing.T) {
+	l := NewRateLimiter(RateLimiterConfig{Rate: rate.Every(10 * time.Second), Burst: 2})
+	now := time.Now()
+	l.now = func() time.Time { return now }
+	h := l.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	do := func() *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+		return rec
+	}
+
+	tests := []struct {
+		code                    int
+		remaining, reset, retry string
+	}{
+		{http.StatusOK, "1", "10", ""},
+		{http.StatusOK, "0", "20", ""},
+		{http.StatusTooManyRequests, "0", "20", "10"},
+	}
+	for i, tt := range tests {
+		rec := do()
+		got := rec.Header()
+		if rec.Code != tt.code || got.Get("RateLimit-Limit") != "2" ||
+			got.Get("RateLimit-Remaining") != tt.remaining ||
+			got.Get("RateLimit-Reset") != tt.reset ||
+			got.Get("Retry-After") != tt.retry {
+			t.Errorf("requisição %d: esperado %d %+v, obtido %d %v", i+1, tt.code, tt, rec.Code, got)
+		}
+	}
+
+	// Depois de Retry-After, a próxima requisição passa
+	now = now.Add(10 * time.Second)
+	if rec := do(); rec.Code != http.StatusOK {
+		t.Errorf("após Retry-After: esperado 200, obtido %d", rec.Code)
+	}
+}
+
+func TestRateLimitPolicies(t *testing.T) {
+	s := newTestServer(t)
+	s.rateLimitMode = rateLimitEnforce
+
+	// /login aceita 5 requisições por minuto. Cada tentativa usa outro
+	// username, para não esbarrar no bloqueio de conta.
+	for i := 1; i <= 6; i++ {
+		body := fmt.Sprintf(`{"username":"user%d","password":"errada"}`, i)
+		rec := serve(t, s, "POST", "/login", body, "")
+		want := http.StatusUnauthorized
+		if i == 6 {
+			want = http.StatusTooManyRequests
+		}
+		if rec.Code != want {
+			t.Fatalf("login %d: esperado %d, obtido %d", i, want, rec.Code)
+		}
+		if i == 1 && rec.Header().Get("RateLimit-Limit") != "5" {
+			t.Errorf("RateLimit-Limit: esperado 5, obtido %q", rec.Header().Get("RateLimit-Limit"))
+		}
+	}
+
+	// As outras rotas têm baldes próprios
+	rec := serve(t, s, "GET", "/.well-known/jwks.json", "", "")
+	if rec.Code != http.StatusOK || rec.Header().Get("RateLimit-Limit") != "10" {
+		t.Errorf("JWKS: esperado 200 com limite 10, obtido %d %q", rec.Code, rec.Header().Get("RateLimit-Limit"))
+	}
+}
+
+func TestRateLimitDryRun(t *testing.T) {
+	s := newTestServer(t)
+	s.rateLimitMode = rateLimitDryRun
+
+	for i := 0; i < 7; i++ {
+		body := fmt.Sprintf(`{"username":"user%d","password":"errada"}`, i)
+		rec := serve(t, s, "POST", "/login", body, "")
+		if rec.Code != http.StatusUnauthorized {
+			t.Fatalf("dry-run não deveria rejeitar: obtido %d", rec.Code)
+		}
+	}
+}
+
+// BenchmarkRateLimiterDistinctKeys usa uma chave nova por iteração. Com
+// -benchtime=5000000x, o heap reportado continua na ordem de MaxKeys
+// entradas, e não cresce com o número de chaves.
+func BenchmarkRateLimiterDistinctKeys(b *testing.B) {
+	l := NewRateLimiter(RateLimiterConfig{Rate: 1, Burst: 1, MaxKeys: 10_000})
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		l.GetLimiter(strconv.Itoa(i))
+	}
+	b.StopTimer()
+
+	runtime.GC()
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	b.ReportMetric(float64(l.Len()), "keys")
+	b.ReportMetric(float64(m.HeapAlloc)/(1<<20), "heap-MB")
+}
+
+// BenchmarkRateLimiterParallel mede a disputa pelos locks com muitos
+// clientes simultâneos
+func BenchmarkRateLimiterParallel(b *testing.B) {
+	l := NewRateLimiter(RateLimiterConfig{Rate: rate.Inf, Burst: 1})
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			l.GetLimiter(strconv.Itoa(i % 50_000)).Allow()
+			i++
+		}
+	})
+}
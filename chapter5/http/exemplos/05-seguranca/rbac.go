@@ -0,0 +1,234 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+
+	"github.com/cauelz/full-cycle-golang-expert/pkg/auth"
+)
+
+// adminRole é a role criada por bootstrapAdmin. As permissões dela só
+// valem para usuários com MFA ativo.
+const adminRole = "admin"
+
+// Permissões usadas pelas rotas do servidor
+const (
+	PermProfileRead = "profile:read"
+	PermUsersRead   = "users:read"
+	PermUsersWrite  = "users:write"
+)
+
+// Policy mapeia cada role para o conjunto de permissões concedidas.
+// A permissão "*" concede todas.
+type Policy struct {
+	roles map[string]map[string]bool
+}
+
+// policyConfig é o formato do arquivo de configuração:
+//
+//	{"roles": {"admin": ["*"], "user": ["profile:read"]}}
+type policyConfig struct {
+	Roles map[string][]string `json:"roles"`
+}
+
+// NewPolicy cria a política a partir do mapeamento role → permissões
+func NewPolicy(roles map[string][]string) *Policy {
+	p := &Policy{roles: make(map[string]map[string]bool, len(roles))}
+	for role, perms := range roles {
+		set := make(map[string]bool, len(perms))
+		for _, perm := range perms {
+			set[perm] = true
+		}
+		p.roles[role] = set
+	}
+	return p
+}
+
+// DefaultPolicy é usada quando nenhum arquivo de configuração é informado
+func DefaultPolicy() *Policy {
+	return NewPolicy(map[string][]string{
+		adminRole: {"*"},
+		"user":    {PermProfileRead},
+	})
+}
+
+// LoadPolicy lê a política de um arquivo JSON
+func LoadPolicy(path string) (*Policy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var cfg policyConfig
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("política inválida: %w", err)
+	}
+	if len(cfg.Roles) == 0 {
+		return nil, fmt.Errorf("política sem roles")
+	}
+	return NewPolicy(cfg.Roles), nil
+}
+
+// HasRole informa se a role existe na política
+func (p *Policy) HasRole(role string) bool {
+	_, ok := p.roles[role]
+	return ok
+}
+
+// Roles retorna as roles conhecidas em ordem alfabética
+func (p *Policy) Roles() []string {
+	roles := make([]string, 0, len(p.roles))
+	for role := range p.roles {
+		roles = append(roles, role)
+	}
+	sort.Strings(roles)
+	return roles
+}
+
+// Allows informa se a role concede a permissão
+func (p *Policy) Allows(role, perm string) bool {
+	perms := p.roles[role]
+	return perms["*"] || perms[perm]
+}
+
+// Denial é o corpo das respostas 403
+type Denial struct {
+	Error    string   `json:"error"`
+	Reason   string   `json:"reason"`
+	Role     string   `json:"role"`
+	Required []string `json:"required"`
+}
+
+// Motivos de negação
+const (
+	denyRole       = "role_not_allowed"
+	denyPermission = "missing_permission"
+	denyScope      = "missing_scope"
+	// denyMFARequired indica um admin que ainda não ativou o MFA
+	denyMFARequired = "mfa_required"
+)
+
+func respondForbidden(w http.ResponseWriter, d Denial) {
+	d.Error = "forbidden"
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusForbidden)
+	json.NewEncoder(w).Encode(d)
+}
+
+// RequireRole permite a requisição apenas para uma das roles informadas.
+// Deve ser aplicado depois de authMiddleware.
+func (s *Server) RequireRole(roles ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			p, ok := auth.PrincipalFrom(r.Context())
+			if !ok {
+				http.Error(w, "Authentication required", http.StatusUnauthorized)
+				return
+			}
+			for _, role := range roles {
+				if p.Role == role {
+					next.ServeHTTP(w, r)
+					return
+				}
+			}
+			respondForbidden(w, Denial{Reason: denyRole, Role: p.Role, Required: roles})
+		})
+	}
+}
+
+// RequirePermission exige que a role do usuário conceda todas as
+// permissões informadas e, com API key, também os escopos da chave. Um
+// admin sem MFA ativo é recusado até concluir /mfa/enroll e /mfa/confirm,
+// que continuam acessíveis só com a senha. Deve ser aplicado depois de
+// authMiddleware.
+func (s *Server) RequirePermission(perms ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			p, ok := auth.PrincipalFrom(r.Context())
+			if !ok {
+				http.Error(w, "Authentication required", http.StatusUnauthorized)
+				return
+			}
+			var missing []string
+			for _, perm := range perms {
+				if !s.policy.Allows(p.Role, perm) {
+					missing = append(missing, perm)
+				}
+			}
+			if len(missing) > 0 {
+				respondForbidden(w, Denial{Reason: denyPermission, Role: p.Role, Required: missing})
+				return
+			}
+			for _, perm := range perms {
+				if !p.HasScope(perm) {
+					missing = append(missing, perm)
+				}
+			}
+			if len(missing) > 0 {
+				respondForbidden(w, Denial{Reason: denyScope, Role: p.Role, Required: missing})
+				return
+			}
+			if p.Role == adminRole {
+				// O MFA é lido a cada requisição, como a role das API keys
+				user, err := s.store.Get(r.Context(), p.Subject)
+				if err != nil {
+					http.Error(w, "Error loading user", http.StatusInternalServerError)
+					return
+				}
+				if !user.MFAEnabled {
+					respondForbidden(w, Denial{Reason: denyMFARequired, Role: p.Role, Required: perms})
+					return
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// handleListUsers lista os usuários cadastrados (admin)
+func (s *Server) handleListUsers(w http.ResponseWriter, r *http.Request) {
+	users, err := s.store.List(r.Context())
+	if err != nil {
+		http.Error(w, "Error listing users", http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(users)
+}
+
+// handleSetRole promove ou rebaixa um usuário (admin). A nova role vale
+// para os próximos tokens: o access token atual mantém a role antiga até
+// expirar ou ser renovado.
+func (s *Server) handleSetRole(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Role string `json:"role"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if !s.policy.HasRole(req.Role) {
+		http.Error(w, fmt.Sprintf("Unknown role; valid roles: %v", s.policy.Roles()), http.StatusBadRequest)
+		return
+	}
+
+	id := r.PathValue("id")
+	// Impede que um admin remova o próprio acesso por engano
+	if p, ok := auth.PrincipalFrom(r.Context()); ok && p.Subject == id {
+		http.Error(w, "Cannot change your own role", http.StatusConflict)
+		return
+	}
+
+	user, err := s.store.SetRole(r.Context(), id, req.Role)
+	if errors.Is(err, ErrUserNotFound) {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Error updating user", http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(user)
+}
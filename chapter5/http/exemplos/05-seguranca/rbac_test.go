@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPolicy(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rbac.json")
+	os.WriteFile(path, []byte(`{"roles": {
+		"admin": ["*"],
+		"support": ["users:read", "profile:read"],
+		"user": ["profile:read"]
+	}}`), 0o600)
+
+	p, err := LoadPolicy(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		role, perm string
+		want       bool
+	}{
+		{"admin", PermUsersWrite, true},
+		{"support", PermUsersRead, true},
+		{"support", PermUsersWrite, false},
+		{"user", PermProfileRead, true},
+		{"user", PermUsersRead, false},
+		{"desconhecida", PermProfileRead, false},
+	}
+	for _, tt := range tests {
+		if got := p.Allows(tt.role, tt.perm); got != tt.want {
+			t.Errorf("Allows(%s, %s): esperado %v, obtido %v", tt.role, tt.perm, tt.want, got)
+		}
+	}
+}
+
+// loginAdmin cria o admin root, ativa o MFA dele e retorna o access token
+func loginAdmin(t *testing.T, s *Server) string {
+	t.Helper()
+	if err := s.bootstrapAdmin("root", "senha-do-admin"); err != nil {
+		t.Fatal(err)
+	}
+	rec := serve(t, s, "POST", "/login", `{"username":"root","password":"senha-do-admin"}`, "")
+	var admin tokenResponse
+	json.NewDecoder(rec.Body).Decode(&admin)
+	enrollMFA(t, s, admin.AccessToken)
+	return admin.AccessToken
+}
+
+func TestAdminRoutes(t *testing.T) {
+	s := newTestServer(t)
+	if err := s.bootstrapAdmin("root", "senha-do-admin"); err != nil {
+		t.Fatal(err)
+	}
+	ana, _ := s.store.GetByUsername(context.Background(), "ana")
+	root, _ := s.store.GetByUsername(context.Background(), "root")
+
+	// Usuário comum recebe 403 com o motivo
+	userTokens := login(t, s)
+	rec := serve(t, s, "PUT", "/admin/users/"+ana.ID+"/role", `{"role":"admin"}`, userTokens.AccessToken)
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("usuário comum: esperado 403, obtido %d", rec.Code)
+	}
+	var denial Denial
+	json.NewDecoder(rec.Body).Decode(&denial)
+	if denial.Reason != denyPermission || denial.Role != "user" || denial.Required[0] != PermUsersWrite {
+		t.Errorf("negação inesperada: %+v", denial)
+	}
+
+	// Sem MFA, o admin só consegue ativá-lo
+	rec = serve(t, s, "POST", "/login", `{"username":"root","password":"senha-do-admin"}`, "")
+	var adminTokens tokenResponse
+	json.NewDecoder(rec.Body).Decode(&adminTokens)
+	for _, route := range []struct{ method, path, body string }{
+		{"GET", "/admin/users", ""},
+		{"PUT", "/admin/users/" + ana.ID + "/role", `{"role":"admin"}`},
+		{"DELETE", "/admin/users/" + ana.ID + "/lockout", ""},
+	} {
+		rec := serve(t, s, route.method, route.path, route.body, adminTokens.AccessToken)
+		denial = Denial{}
+		json.NewDecoder(rec.Body).Decode(&denial)
+		if rec.Code != http.StatusForbidden || denial.Reason != denyMFARequired {
+			t.Errorf("%s %s sem MFA: esperado 403 %s, obtido %d %+v", route.method, route.path, denyMFARequired, rec.Code, denial)
+		}
+	}
+	if user, _ := s.store.GetByUsername(context.Background(), "ana"); user.Role != "user" {
+		t.Fatalf("admin sem MFA alterou a role de ana: %s", user.Role)
+	}
+	enrollMFA(t, s, adminTokens.AccessToken)
+
+	// Admin promove ana
+
+	rec = serve(t, s, "PUT", "/admin/users/"+ana.ID+"/role", `{"role":"superuser"}`, adminTokens.AccessToken)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("role desconhecida: esperado 400, obtido %d", rec.Code)
+	}
+	rec = serve(t, s, "PUT", "/admin/users/"+root.ID+"/role", `{"role":"user"}`, adminTokens.AccessToken)
+	if rec.Code != http.StatusConflict {
+		t.Errorf("alterar a própria role: esperado 409, obtido %d", rec.Code)
+	}
+	rec = serve(t, s, "PUT", "/admin/users/"+ana.ID+"/role", `{"role":"admin"}`, adminTokens.AccessToken)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("promover: esperado 200, obtido %d", rec.Code)
+	}
+
+	// A nova role vale a partir do próximo token
+	code, promoted := refresh(t, s, userTokens.RefreshToken)
+	if code != http.StatusOK {
+		t.Fatalf("refresh: esperado 200, obtido %d", code)
+	}
+	// O novo admin também precisa ativar o MFA
+	if rec := serve(t, s, "GET", "/admin/users", "", promoted.AccessToken); rec.Code != http.StatusForbidden {
+		t.Errorf("após promoção, sem MFA: esperado 403, obtido %d", rec.Code)
+	}
+	enrollMFA(t, s, promoted.AccessToken)
+	if rec := serve(t, s, "GET", "/admin/users", "", promoted.AccessToken); rec.Code != http.StatusOK {
+		t.Errorf("após promoção e MFA: esperado 200, obtido %d", rec.Code)
+	}
+}
+
+func TestRequireRole(t *testing.T) {
+	s := newTestServer(t)
+	tokens := login(t, s)
+	h := s.authMiddleware(s.RequireRole("admin", "support")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})))
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Authorization", "Bearer "+tokens.AccessToken)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	var denial Denial
+	json.NewDecoder(rec.Body).Decode(&denial)
+	if rec.Code != http.StatusForbidden || denial.Reason != denyRole || len(denial.Required) != 2 {
+		t.Errorf("esperado 403 role_not_allowed, obtido %d %+v", rec.Code, denial)
+	}
+}
@@ -0,0 +1,262 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ErrSessionNotFound indica uma sessão inexistente ou já encerrada
+var ErrSessionNotFound = errors.New("sessão não encontrada")
+
+// Session é o estado de uma sessão no servidor. O navegador recebe apenas
+// um ID opaco; o store guarda o hash dele em ID.
+type Session struct {
+	ID string
+	// UserID é vazio em sessões anônimas, criadas só para guardar flashes
+	UserID string
+	// Flashes são mensagens exibidas uma única vez, na próxima página
+	Flashes   []string
+	CreatedAt time.Time
+	LastSeen  time.Time
+}
+
+// SessionStore guarda as sessões
+type SessionStore interface {
+	// Save cria ou atualiza a sessão
+	Save(ctx context.Context, session Session) error
+	// Get busca a sessão pelo hash do ID
+	Get(ctx context.Context, id string) (Session, error)
+	// Delete encerra a sessão
+	Delete(ctx context.Context, id string) error
+	// DeleteExpired remove as sessões sem uso desde idleBefore ou criadas
+	// antes de createdBefore
+	DeleteExpired(ctx context.Context, idleBefore, createdBefore time.Time) error
+}
+
+// MemorySessionStore é uma implementação de SessionStore em memória
+type MemorySessionStore struct {
+	mu       sync.Mutex
+	sessions map[string]Session
+}
+
+// NewMemorySessionStore cria um SessionStore em memória vazio
+func NewMemorySessionStore() *MemorySessionStore {
+	return &MemorySessionStore{sessions: make(map[string]Session)}
+}
+
+func (s *MemorySessionStore) Save(ctx context.Context, session Session) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// Cópia dos flashes, para que o chamador não altere o store
+	session.Flashes = append([]string(nil), session.Flashes...)
+	s.sessions[session.ID] = session
+	return nil
+}
+
+func (s *MemorySessionStore) Get(ctx context.Context, id string) (Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	session, ok := s.sessions[id]
+	if !ok {
+		return Session{}, ErrSessionNotFound
+	}
+	session.Flashes = append([]string(nil), session.Flashes...)
+	return session, nil
+}
+
+func (s *MemorySessionStore) Delete(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.sessions, id)
+	return nil
+}
+
+func (s *MemorySessionStore) DeleteExpired(ctx context.Context, idleBefore, createdBefore time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, session := range s.sessions {
+		if session.LastSeen.Before(idleBefore) || session.CreatedAt.Before(createdBefore) {
+			delete(s.sessions, id)
+		}
+	}
+	return nil
+}
+
+// SessionConfig configura o cookie e a validade das sessões
+type SessionConfig struct {
+	// CookieName com o prefixo __Host- obriga o navegador a exigir Secure,
+	// Path=/ e nenhum Domain, então subdomínios não conseguem sobrescrevê-lo
+	CookieName string
+	// IdleTimeout encerra a sessão sem requisições por esse tempo
+	IdleTimeout time.Duration
+	// AbsoluteTimeout encerra a sessão após esse tempo, mesmo em uso
+	AbsoluteTimeout time.Duration
+	SameSite        http.SameSite
+}
+
+// DefaultSessionConfig retorna a configuração padrão: 30 minutos de
+// inatividade e 12 horas no total
+func DefaultSessionConfig() SessionConfig {
+	return SessionConfig{
+		CookieName:      "__Host-session",
+		IdleTimeout:     30 * time.Minute,
+		AbsoluteTimeout: 12 * time.Hour,
+		// Lax mantém a sessão ao chegar por um link de outro site; os
+		// POSTs continuam protegidos pelo csrfMiddleware
+		SameSite: http.SameSiteLaxMode,
+	}
+}
+
+// sessionTouchInterval evita gravar LastSeen a cada requisição
+const sessionTouchInterval = time.Minute
+
+// SessionManager cria, carrega e encerra sessões identificadas por cookie
+type SessionManager struct {
+	store SessionStore
+	cfg   SessionConfig
+	now   func() time.Time
+}
+
+// NewSessionManager cria o gerenciador sobre o store informado
+func NewSessionManager(store SessionStore, cfg SessionConfig) *SessionManager {
+	return &SessionManager{store: store, cfg: cfg, now: time.Now}
+}
+
+// hashSessionID calcula a chave da sessão no store. Quem lê o banco não
+// consegue usar as sessões; o ID tem 256 bits, então SHA-256 basta.
+func hashSessionID(id string) string {
+	sum := sha256.Sum256([]byte(id))
+	return hex.EncodeToString(sum[:])
+}
+
+// expired informa se a sessão passou de algum dos limites de tempo
+func (m *SessionManager) expired(session Session, now time.Time) bool {
+	return now.Sub(session.LastSeen) > m.cfg.IdleTimeout ||
+		now.Sub(session.CreatedAt) > m.cfg.AbsoluteTimeout
+}
+
+// Get carrega a sessão do cookie. Sessões expiradas são removidas e
+// tratadas como inexistentes.
+func (m *SessionManager) Get(r *http.Request) (Session, bool, error) {
+	cookie, err := r.Cookie(m.cfg.CookieName)
+	if err != nil || cookie.Value == "" {
+		return Session{}, false, nil
+	}
+	session, err := m.store.Get(r.Context(), hashSessionID(cookie.Value))
+	if errors.Is(err, ErrSessionNotFound) {
+		return Session{}, false, nil
+	}
+	if err != nil {
+		return Session{}, false, err
+	}
+
+	now := m.now()
+	if m.expired(session, now) {
+		return Session{}, false, m.store.Delete(r.Context(), session.ID)
+	}
+	if now.Sub(session.LastSeen) > sessionTouchInterval {
+		session.LastSeen = now
+		if err := m.store.Save(r.Context(), session); err != nil {
+			return Session{}, false, err
+		}
+	}
+	return session, true, nil
+}
+
+// create grava uma sessão nova e envia o cookie
+func (m *SessionManager) create(w http.ResponseWriter, r *http.Request, userID string, flashes []string) error {
+	id, err := randomToken(32)
+	if err != nil {
+		return err
+	}
+	now := m.now()
+	err = m.store.Save(r.Context(), Session{
+		ID:        hashSessionID(id),
+		UserID:    userID,
+		Flashes:   flashes,
+		CreatedAt: now,
+		LastSeen:  now,
+	})
+	if err != nil {
+		return err
+	}
+	m.setCookie(w, id, int(m.cfg.AbsoluteTimeout.Seconds()))
+	return nil
+}
+
+// setCookie envia o cookie da sessão. MaxAge negativo remove o cookie.
+func (m *SessionManager) setCookie(w http.ResponseWriter, value string, maxAge int) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     m.cfg.CookieName,
+		Value:    value,
+		Path:     "/",
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: m.cfg.SameSite,
+	})
+}
+
+// Login inicia uma sessão autenticada. A sessão anterior é descartada e
+// um ID novo é emitido, o que impede a fixação de sessão: um ID plantado
+// pelo atacante antes do login não vale depois dele. Os flashes pendentes
+// passam para a sessão nova, junto com os informados.
+func (m *SessionManager) Login(w http.ResponseWriter, r *http.Request, userID string, flashes ...string) error {
+	old, ok, err := m.Get(r)
+	if err != nil {
+		return err
+	}
+	if ok {
+		if err := m.store.Delete(r.Context(), old.ID); err != nil {
+			return err
+		}
+	}
+
+	// As sessões só expiram quando lidas; a limpeza a cada login impede
+	// que as abandonadas se acumulem
+	now := m.now()
+	if err := m.store.DeleteExpired(r.Context(), now.Add(-m.cfg.IdleTimeout), now.Add(-m.cfg.AbsoluteTimeout)); err != nil {
+		return err
+	}
+	return m.create(w, r, userID, append(old.Flashes, flashes...))
+}
+
+// Logout encerra a sessão e remove o cookie
+func (m *SessionManager) Logout(w http.ResponseWriter, r *http.Request) error {
+	m.setCookie(w, "", -1)
+	session, ok, err := m.Get(r)
+	if err != nil || !ok {
+		return err
+	}
+	return m.store.Delete(r.Context(), session.ID)
+}
+
+// AddFlash guarda uma mensagem para a próxima página. Sem sessão, cria uma
+// anônima.
+func (m *SessionManager) AddFlash(w http.ResponseWriter, r *http.Request, message string) error {
+	session, ok, err := m.Get(r)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return m.create(w, r, "", []string{message})
+	}
+	session.Flashes = append(session.Flashes, message)
+	return m.store.Save(r.Context(), session)
+}
+
+// Flashes retorna e remove as mensagens pendentes
+func (m *SessionManager) Flashes(r *http.Request) ([]string, error) {
+	session, ok, err := m.Get(r)
+	if err != nil || !ok || len(session.Flashes) == 0 {
+		return nil, err
+	}
+	flashes := session.Flashes
+	session.Flashes = nil
+	return flashes, m.store.Save(r.Context(), session)
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// SQLiteSessionStore implementa SessionStore sobre SQLite. As sessões
+// sobrevivem a reinícios e podem ser compartilhadas entre processos que
+// usam o mesmo arquivo.
+type SQLiteSessionStore struct {
+	db *sql.DB
+}
+
+// NewSQLiteSessionStore cria o store sobre um banco aberto por openSQLite
+func NewSQLiteSessionStore(db *sql.DB) *SQLiteSessionStore {
+	return &SQLiteSessionStore{db: db}
+}
+
+func (s *SQLiteSessionStore) Save(ctx context.Context, session Session) error {
+	flashes, err := json.Marshal(session.Flashes)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.ExecContext(ctx,
+		`INSERT INTO sessions (id, user_id, flashes, created_at, last_seen) VALUES (?, ?, ?, ?, ?)
+		 ON CONFLICT (id) DO UPDATE SET
+		   user_id = excluded.user_id, flashes = excluded.flashes, last_seen = excluded.last_seen`,
+		session.ID, session.UserID, string(flashes), session.CreatedAt.UnixNano(), session.LastSeen.UnixNano())
+	return err
+}
+
+func (s *SQLiteSessionStore) Get(ctx context.Context, id string) (Session, error) {
+	var session Session
+	var flashes string
+	var created, lastSeen int64
+	err := s.db.QueryRowContext(ctx,
+		`SELECT id, user_id, flashes, created_at, last_seen FROM sessions WHERE id = ?`, id).
+		Scan(&session.ID, &session.UserID, &flashes, &created, &lastSeen)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Session{}, ErrSessionNotFound
+	}
+	if err != nil {
+		return Session{}, err
+	}
+	if err := json.Unmarshal([]byte(flashes), &session.Flashes); err != nil {
+		return Session{}, err
+	}
+	session.CreatedAt = time.Unix(0, created)
+	session.LastSeen = time.Unix(0, lastSeen)
+	return session, nil
+}
+
+func (s *SQLiteSessionStore) Delete(ctx context.Context, id string) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM sessions WHERE id = ?`, id)
+	return err
+}
+
+func (s *SQLiteSessionStore) DeleteExpired(ctx context.Context, idleBefore, createdBefore time.Time) error {
+	_, err := s.db.ExecContext(ctx,
+		`DELETE FROM sessions WHERE last_seen < ? OR created_at < ?`,
+		idleBefore.UnixNano(), createdBefore.UnixNano())
+	return err
+}
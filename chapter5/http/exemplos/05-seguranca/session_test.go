@@ -0,0 +1,260 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+// sessionStores retorna uma instância nova de cada implementação
+func sessionStores(t *testing.T) map[string]SessionStore {
+	t.Helper()
+	db, err := openSQLite(context.Background(), filepath.Join(t.TempDir(), "sessions.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return map[string]SessionStore{
+		"memory": NewMemorySessionStore(),
+		"sqlite": NewSQLiteSessionStore(db),
+	}
+}
+
+func TestSessionStore(t *testing.T) {
+	ctx := context.Background()
+	now := time.Unix(1_700_000_000, 123)
+	for name, store := range sessionStores(t) {
+		t.Run(name, func(t *testing.T) {
+			session := Session{ID: "s1", UserID: "u1", Flashes: []string{"olá"}, CreatedAt: now, LastSeen: now}
+			if err := store.Save(ctx, session); err != nil {
+				t.Fatal(err)
+			}
+			got, err := store.Get(ctx, "s1")
+			if err != nil || got.UserID != "u1" || len(got.Flashes) != 1 || got.Flashes[0] != "olá" ||
+				!got.CreatedAt.Equal(now) || !got.LastSeen.Equal(now) {
+				t.Errorf("Get: obtido %+v (%v)", got, err)
+			}
+
+			// Save atualiza a sessão existente
+			session.Flashes = nil
+			session.LastSeen = now.Add(time.Minute)
+			store.Save(ctx, session)
+			if got, _ := store.Get(ctx, "s1"); len(got.Flashes) != 0 || !got.LastSeen.Equal(session.LastSeen) {
+				t.Errorf("Save: obtido %+v", got)
+			}
+
+			store.Save(ctx, Session{ID: "ociosa", CreatedAt: now, LastSeen: now.Add(-time.Hour)})
+			store.Save(ctx, Session{ID: "antiga", CreatedAt: now.Add(-24 * time.Hour), LastSeen: now})
+			if err := store.DeleteExpired(ctx, now.Add(-30*time.Minute), now.Add(-12*time.Hour)); err != nil {
+				t.Fatal(err)
+			}
+			for _, id := range []string{"ociosa", "antiga"} {
+				if _, err := store.Get(ctx, id); !errors.Is(err, ErrSessionNotFound) {
+					t.Errorf("DeleteExpired: %s deveria ter sido removida (%v)", id, err)
+				}
+			}
+
+			if err := store.Delete(ctx, "s1"); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := store.Get(ctx, "s1"); !errors.Is(err, ErrSessionNotFound) {
+				t.Errorf("Delete: esperado ErrSessionNotFound, obtido %v", err)
+			}
+		})
+	}
+}
+
+func TestSessionTimeouts(t *testing.T) {
+	m := NewSessionManager(NewMemorySessionStore(), DefaultSessionConfig())
+	now := time.Now()
+	m.now = func() time.Time { return now }
+
+	rec := httptest.NewRecorder()
+	if err := m.Login(rec, httptest.NewRequest("POST", "/", nil), "u1"); err != nil {
+		t.Fatal(err)
+	}
+	cookie := rec.Result().Cookies()[0]
+	if !cookie.HttpOnly || !cookie.Secure || cookie.SameSite != http.SameSiteLaxMode || cookie.Path != "/" {
+		t.Errorf("atributos do cookie inesperados: %+v", cookie)
+	}
+	get := func() bool {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.AddCookie(cookie)
+		_, ok, err := m.Get(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ok
+	}
+
+	// Cada acesso renova o prazo de inatividade...
+	for i := 0; i < 4; i++ {
+		now = now.Add(25 * time.Minute)
+		if !get() {
+			t.Fatalf("sessão em uso não deveria expirar (acesso %d)", i)
+		}
+	}
+	// ...mas não o prazo absoluto
+	for i := 0; i < 25; i++ {
+		now = now.Add(25 * time.Minute)
+		get()
+	}
+	if get() {
+		t.Error("sessão deveria expirar após o prazo absoluto")
+	}
+
+	// Sem acessos, expira pela inatividade
+	rec = httptest.NewRecorder()
+	m.Login(rec, httptest.NewRequest("POST", "/", nil), "u1")
+	cookie = rec.Result().Cookies()[0]
+	now = now.Add(31 * time.Minute)
+	if get() {
+		t.Error("sessão deveria expirar após 30 minutos sem uso")
+	}
+}
+
+// browser guarda os cookies entre requisições, como um navegador
+type browser struct {
+	t       *testing.T
+	s       *Server
+	cookies map[string]*http.Cookie
+}
+
+func newBrowser(t *testing.T, s *Server) *browser {
+	return &browser{t: t, s: s, cookies: make(map[string]*http.Cookie)}
+}
+
+func (b *browser) do(method, path string, form url.Values) *httptest.ResponseRecorder {
+	b.t.Helper()
+	req := httptest.NewRequest(method, path, strings.NewReader(form.Encode()))
+	if form != nil {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	for _, c := range b.cookies {
+		req.AddCookie(c)
+	}
+	rec := httptest.NewRecorder()
+	b.s.Routes().ServeHTTP(rec, req)
+	for _, c := range rec.Result().Cookies() {
+		if c.MaxAge < 0 {
+			delete(b.cookies, c.Name)
+		} else {
+			b.cookies[c.Name] = c
+		}
+	}
+	return rec
+}
+
+var csrfFieldRe = regexp.MustCompile(`name="csrf_token" value="([^"]+)"`)
+
+// csrfField extrai o token CSRF do formulário da página
+func csrfField(t *testing.T, rec *httptest.ResponseRecorder) string {
+	t.Helper()
+	m := csrfFieldRe.FindStringSubmatch(rec.Body.String())
+	if m == nil {
+		t.Fatalf("página sem token CSRF: %s", rec.Body)
+	}
+	return m[1]
+}
+
+func TestSessionLogin(t *testing.T) {
+	s := newTestServer(t)
+	b := newBrowser(t, s)
+	cookieName := DefaultSessionConfig().CookieName
+
+	if rec := b.do("GET", "/dashboard", nil); rec.Code != http.StatusSeeOther || rec.Header().Get("Location") != "/session/login" {
+		t.Fatalf("dashboard sem sessão: esperado redirect, obtido %d", rec.Code)
+	}
+
+	// Sem o token CSRF do formulário, o login é recusado
+	form := url.Values{"username": {"ana"}, "password": {"senha-secreta"}}
+	if rec := b.do("POST", "/session/login", form); rec.Code != http.StatusForbidden {
+		t.Errorf("login sem CSRF: esperado 403, obtido %d", rec.Code)
+	}
+
+	// Senha errada volta ao formulário com um flash, em uma sessão anônima
+	form.Set("csrf_token", csrfField(t, b.do("GET", "/session/login", nil)))
+	form.Set("password", "errada")
+	if rec := b.do("POST", "/session/login", form); rec.Code != http.StatusSeeOther {
+		t.Fatalf("senha errada: esperado 303, obtido %d", rec.Code)
+	}
+	anonymous := b.cookies[cookieName]
+	if anonymous == nil {
+		t.Fatal("flash deveria criar uma sessão anônima")
+	}
+	page := b.do("GET", "/session/login", nil)
+	if !strings.Contains(page.Body.String(), "Usuário, senha ou código inválidos.") {
+		t.Errorf("flash de erro ausente: %s", page.Body)
+	}
+	// O flash aparece uma única vez
+	page = b.do("GET", "/session/login", nil)
+	if strings.Contains(page.Body.String(), "inválidos") {
+		t.Error("flash deveria ser exibido uma única vez")
+	}
+
+	// O login emite um ID de sessão novo
+	form.Set("csrf_token", csrfField(t, page))
+	form.Set("password", "senha-secreta")
+	if rec := b.do("POST", "/session/login", form); rec.Code != http.StatusSeeOther || rec.Header().Get("Location") != "/dashboard" {
+		t.Fatalf("login: esperado redirect para /dashboard, obtido %d", rec.Code)
+	}
+	if b.cookies[cookieName].Value == anonymous.Value {
+		t.Fatal("o ID da sessão deveria mudar no login")
+	}
+	stale := newBrowser(t, s)
+	stale.cookies[cookieName] = anonymous
+	if rec := stale.do("GET", "/dashboard", nil); rec.Code != http.StatusSeeOther {
+		t.Errorf("ID anterior ao login: esperado redirect, obtido %d", rec.Code)
+	}
+
+	dashboard := b.do("GET", "/dashboard", nil)
+	if dashboard.Code != http.StatusOK || !strings.Contains(dashboard.Body.String(), "Olá, ana!") ||
+		!strings.Contains(dashboard.Body.String(), "Login realizado.") {
+		t.Fatalf("dashboard: obtido %d %s", dashboard.Code, dashboard.Body)
+	}
+
+	// Logout exige o token CSRF da sessão autenticada
+	if rec := b.do("POST", "/session/logout", url.Values{}); rec.Code != http.StatusForbidden {
+		t.Errorf("logout sem CSRF: esperado 403, obtido %d", rec.Code)
+	}
+	logout := url.Values{"csrf_token": {csrfField(t, dashboard)}}
+	if rec := b.do("POST", "/session/logout", logout); rec.Code != http.StatusSeeOther {
+		t.Fatalf("logout: esperado 303, obtido %d", rec.Code)
+	}
+	if !strings.Contains(b.do("GET", "/session/login", nil).Body.String(), "Você saiu da sua conta.") {
+		t.Error("flash de logout ausente")
+	}
+	if rec := b.do("GET", "/dashboard", nil); rec.Code != http.StatusSeeOther {
+		t.Errorf("dashboard após logout: esperado redirect, obtido %d", rec.Code)
+	}
+}
+
+func TestSessionLoginMFA(t *testing.T) {
+	s := newTestServer(t)
+	now := time.Now().Add(-time.Minute)
+	s.now = func() time.Time { return now }
+	secret, _ := enrollMFA(t, s, login(t, s).AccessToken)
+
+	b := newBrowser(t, s)
+	form := url.Values{"username": {"ana"}, "password": {"senha-secreta"}}
+	form.Set("csrf_token", csrfField(t, b.do("GET", "/session/login", nil)))
+	b.do("POST", "/session/login", form)
+	if rec := b.do("GET", "/dashboard", nil); rec.Code != http.StatusSeeOther {
+		t.Fatalf("login sem código: esperado redirect, obtido %d", rec.Code)
+	}
+
+	now = now.Add(30 * time.Second)
+	form.Set("csrf_token", csrfField(t, b.do("GET", "/session/login", nil)))
+	form.Set("code", totpCode(t, secret, now))
+	b.do("POST", "/session/login", form)
+	if rec := b.do("GET", "/dashboard", nil); rec.Code != http.StatusOK {
+		t.Errorf("login com código: esperado 200, obtido %d", rec.Code)
+	}
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"time"
+)
+
+// Tempo de vida padrão dos tokens. O access token é curto porque só pode
+// ser revogado pela denylist; o refresh token é rotacionado a cada uso.
+const (
+	defaultAccessTTL  = 15 * time.Minute
+	defaultRefreshTTL = 7 * 24 * time.Hour
+)
+
+var (
+	// ErrRefreshInvalid indica um refresh token desconhecido ou revogado
+	ErrRefreshInvalid = errors.New("refresh token inválido")
+	// ErrRefreshExpired indica um refresh token expirado
+	ErrRefreshExpired = errors.New("refresh token expirado")
+	// ErrRefreshReused indica a reutilização de um refresh token já
+	// rotacionado; toda a família é revogada
+	ErrRefreshReused = errors.New("refresh token reutilizado")
+)
+
+// RefreshToken é o registro de um refresh token no servidor. Apenas o hash
+// do token é guardado.
+type RefreshToken struct {
+	Hash      string
+	UserID    string
+	FamilyID  string
+	ExpiresAt time.Time
+	// Used indica que o token já foi trocado por um novo
+	Used bool
+	// Revoked indica que a família foi revogada (logout ou reuso)
+	Revoked bool
+}
+
+// TokenStore guarda os refresh tokens e a denylist de access tokens
+type TokenStore interface {
+	// SaveRefresh grava um novo refresh token
+	SaveRefresh(ctx context.Context, token RefreshToken) error
+	// GetRefresh retorna o token sem consumi-lo, inclusive se já usado ou
+	// revogado. Retorna ErrRefreshInvalid se ele não existir.
+	GetRefresh(ctx context.Context, hash string) (RefreshToken, error)
+	// UseRefresh marca o token como usado e o retorna. Um token já usado
+	// revoga a família e retorna ErrRefreshReused.
+	UseRefresh(ctx context.Context, hash string, now time.Time) (RefreshToken, error)
+	// RevokeFamily revoga todos os refresh tokens da família
+	RevokeFamily(ctx context.Context, familyID string) error
+	// RevokeAccess coloca o jti na denylist até o access token expirar
+	RevokeAccess(ctx context.Context, jti string, expiresAt time.Time) error
+	// IsAccessRevoked informa se o jti está na denylist
+	IsAccessRevoked(ctx context.Context, jti string) (bool, error)
+}
+
+// MemoryTokenStore é uma implementação de TokenStore em memória
+type MemoryTokenStore struct {
+	mu       sync.Mutex
+	refresh  map[string]RefreshToken
+	families map[string][]string
+	denylist map[string]time.Time
+}
+
+// NewMemoryTokenStore cria um TokenStore em memória vazio
+func NewMemoryTokenStore() *MemoryTokenStore {
+	return &MemoryTokenStore{
+		refresh:  make(map[string]RefreshToken),
+		families: make(map[string][]string),
+		denylist: make(map[string]time.Time),
+	}
+}
+
+func (s *MemoryTokenStore) SaveRefresh(ctx context.Context, token RefreshToken) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.purge(time.Now())
+	s.refresh[token.Hash] = token
+	s.families[token.FamilyID] = append(s.families[token.FamilyID], token.Hash)
+	return nil
+}
+
+// purge remove os tokens expirados ou revogados, que UseRefresh recusaria
+// de qualquer forma, e as famílias que ficaram vazias. Exige o lock.
+func (s *MemoryTokenStore) purge(now time.Time) {
+	for familyID, hashes := range s.families {
+		alive := hashes[:0]
+		for _, hash := range hashes {
+			token := s.refresh[hash]
+			if token.Revoked || !now.Before(token.ExpiresAt) {
+				delete(s.refresh, hash)
+				continue
+			}
+			alive = append(alive, hash)
+		}
+		if len(alive) == 0 {
+			delete(s.families, familyID)
+		} else {
+			s.families[familyID] = alive
+		}
+	}
+}
+
+func (s *MemoryTokenStore) GetRefresh(ctx context.Context, hash string) (RefreshToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	token, ok := s.refresh[hash]
+	if !ok {
+		return RefreshToken{}, ErrRefreshInvalid
+	}
+	return token, nil
+}
+
+func (s *MemoryTokenStore) UseRefresh(ctx context.Context, hash string, now time.Time) (RefreshToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	token, ok := s.refresh[hash]
+	switch {
+	case !ok || token.Revoked:
+		return RefreshToken{}, ErrRefreshInvalid
+	case token.Used:
+		// Alguém guardou um token antigo: a família inteira é comprometida
+		s.revokeFamily(token.FamilyID)
+		return RefreshToken{}, ErrRefreshReused
+	case !now.Before(token.ExpiresAt):
+		return RefreshToken{}, ErrRefreshExpired
+	}
+
+	token.Used = true
+	s.refresh[hash] = token
+	return token, nil
+}
+
+func (s *MemoryTokenStore) RevokeFamily(ctx context.Context, familyID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.revokeFamily(familyID)
+	return nil
+}
+
+// revokeFamily marca todos os tokens da família como revogados. Exige o lock.
+func (s *MemoryTokenStore) revokeFamily(familyID string) {
+	for _, hash := range s.families[familyID] {
+		token := s.refresh[hash]
+		token.Revoked = true
+		s.refresh[hash] = token
+	}
+}
+
+func (s *MemoryTokenStore) RevokeAccess(ctx context.Context, jti string, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Entradas de tokens já expirados não são mais necessárias
+	now := time.Now()
+	for id, exp := range s.denylist {
+		if now.After(exp) {
+			delete(s.denylist, id)
+		}
+	}
+	s.denylist[jti] = expiresAt
+	return nil
+}
+
+func (s *MemoryTokenStore) IsAccessRevoked(ctx context.Context, jti string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, revoked := s.denylist[jti]
+	return revoked, nil
+}
+
+// randomToken gera um identificador aleatório seguro para URLs
+func randomToken(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// hashRefreshToken calcula o hash guardado no store. Refresh tokens têm
+// 256 bits aleatórios, então SHA-256 sem salt é suficiente.
+func hashRefreshToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
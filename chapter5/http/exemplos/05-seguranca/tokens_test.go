@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestServer cria um servidor com hash de senha rápido, sem rate limit
+// e com o usuário ana/senha-secreta cadastrado
+func newTestServer(t *testing.T) *Server {
+	t.Helper()
+	s := NewServer()
+	passwords, err := NewPasswordManager(fastArgon2id())
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.passwords = passwords
+	s.rateLimitMode = rateLimitOff
+
+	rec := serve(t, s, "POST", "/users", `{"username":"ana","password":"senha-secreta"}`, "")
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("POST /users: esperado 201, obtido %d", rec.Code)
+	}
+	return s
+}
+
+// serve executa uma requisição contra as rotas do servidor
+func serve(t *testing.T, s *Server, method, path, body, bearer string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if bearer != "" {
+		req.Header.Set("Authorization", "Bearer "+bearer)
+	}
+	rec := httptest.NewRecorder()
+	s.Routes().ServeHTTP(rec, req)
+	return rec
+}
+
+// login autentica ana e retorna o par de tokens
+func login(t *testing.T, s *Server) tokenResponse {
+	t.Helper()
+	rec := serve(t, s, "POST", "/login", `{"username":"ana","password":"senha-secreta"}`, "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("POST /login: esperado 200, obtido %d", rec.Code)
+	}
+	var tokens tokenResponse
+	if err := json.NewDecoder(rec.Body).Decode(&tokens); err != nil {
+		t.Fatal(err)
+	}
+	return tokens
+}
+
+// refresh troca o refresh token e retorna o status e o novo par
+func refresh(t *testing.T, s *Server, token string) (int, tokenResponse) {
+	t.Helper()
+	rec := serve(t, s, "POST", "/token/refresh", `{"refresh_token":"`+token+`"}`, "")
+	var tokens tokenResponse
+	if rec.Code == http.StatusOK {
+		json.NewDecoder(rec.Body).Decode(&tokens)
+	}
+	return rec.Code, tokens
+}
+
+func TestRefreshRotation(t *testing.T) {
+	s := newTestServer(t)
+	first := login(t, s)
+
+	code, second := refresh(t, s, first.RefreshToken)
+	if code != http.StatusOK {
+		t.Fatalf("refresh: esperado 200, obtido %d", code)
+	}
+	if second.RefreshToken == first.RefreshToken || second.AccessToken == first.AccessToken {
+		t.Fatal("refresh deve emitir tokens novos")
+	}
+	if rec := serve(t, s, "GET", "/protected", "", second.AccessToken); rec.Code != http.StatusOK {
+		t.Errorf("novo access token: esperado 200, obtido %d", rec.Code)
+	}
+
+	// Replay do refresh token já rotacionado revoga a família inteira
+	if code, _ := refresh(t, s, first.RefreshToken); code != http.StatusUnauthorized {
+		t.Errorf("replay: esperado 401, obtido %d", code)
+	}
+	if code, _ := refresh(t, s, second.RefreshToken); code != http.StatusUnauthorized {
+		t.Errorf("token da família revogada: esperado 401, obtido %d", code)
+	}
+
+	// Outro login abre uma família nova, que não é afetada
+	if code, _ := refresh(t, s, login(t, s).RefreshToken); code != http.StatusOK {
+		t.Errorf("nova família: esperado 200, obtido %d", code)
+	}
+}
+
+func TestTokenExpiry(t *testing.T) {
+	s := newTestServer(t)
+
+	// Access token emitido há mais tempo que o accessTTL
+	s.now = func() time.Time { return time.Now().Add(-s.accessTTL - time.Minute) }
+	expired := login(t, s)
+	if rec := serve(t, s, "GET", "/protected", "", expired.AccessToken); rec.Code != http.StatusUnauthorized {
+		t.Errorf("access token expirado: esperado 401, obtido %d", rec.Code)
+	}
+
+	// Refresh token usado depois do refreshTTL
+	s.now = time.Now
+	tokens := login(t, s)
+	s.now = func() time.Time { return time.Now().Add(s.refreshTTL + time.Minute) }
+	if code, _ := refresh(t, s, tokens.RefreshToken); code != http.StatusUnauthorized {
+		t.Errorf("refresh token expirado: esperado 401, obtido %d", code)
+	}
+}
+
+func TestLogout(t *testing.T) {
+	s := newTestServer(t)
+	tokens := login(t, s)
+
+	rec := serve(t, s, "POST", "/logout", `{"refresh_token":"`+tokens.RefreshToken+`"}`, tokens.AccessToken)
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("logout: esperado 204, obtido %d", rec.Code)
+	}
+
+	// O jti está na denylist, mesmo com a assinatura ainda válida
+	if rec := serve(t, s, "GET", "/protected", "", tokens.AccessToken); rec.Code != http.StatusUnauthorized {
+		t.Errorf("access token após logout: esperado 401, obtido %d", rec.Code)
+	}
+	if code, _ := refresh(t, s, tokens.RefreshToken); code != http.StatusUnauthorized {
+		t.Errorf("refresh token após logout: esperado 401, obtido %d", code)
+	}
+	if rec := serve(t, s, "POST", "/logout", "", tokens.AccessToken); rec.Code != http.StatusUnauthorized {
+		t.Errorf("logout repetido: esperado 401, obtido %d", rec.Code)
+	}
+}
+
+func TestLogoutForeignRefreshToken(t *testing.T) {
+	s := newTestServer(t)
+	serve(t, s, "POST", "/users", `{"username":"bia","password":"outra-senha"}`, "")
+	rec := serve(t, s, "POST", "/login", `{"username":"bia","password":"outra-senha"}`, "")
+	var bia tokenResponse
+	json.NewDecoder(rec.Body).Decode(&bia)
+	ana := login(t, s)
+
+	// O logout de ana com o refresh token de bia não consome nem revoga o token
+	rec = serve(t, s, "POST", "/logout", `{"refresh_token":"`+bia.RefreshToken+`"}`, ana.AccessToken)
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("logout: esperado 204, obtido %d", rec.Code)
+	}
+	if code, _ := refresh(t, s, bia.RefreshToken); code != http.StatusOK {
+		t.Errorf("refresh token de outro usuário após logout: esperado 200, obtido %d", code)
+	}
+}
+
+func TestMemoryTokenStorePurge(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryTokenStore()
+	now := time.Now()
+
+	store.SaveRefresh(ctx, RefreshToken{Hash: "expirado", FamilyID: "f1", ExpiresAt: now.Add(-time.Minute)})
+	store.SaveRefresh(ctx, RefreshToken{Hash: "revogado", FamilyID: "f2", ExpiresAt: now.Add(time.Hour)})
+	store.RevokeFamily(ctx, "f2")
+	store.SaveRefresh(ctx, RefreshToken{Hash: "usado", FamilyID: "f3", ExpiresAt: now.Add(time.Hour)})
+	store.UseRefresh(ctx, "usado", now)
+	store.SaveRefresh(ctx, RefreshToken{Hash: "novo", FamilyID: "f3", ExpiresAt: now.Add(time.Hour)})
+
+	// O token usado continua guardado para detectar o reuso
+	for hash, want := range map[string]bool{"expirado": false, "revogado": false, "usado": true, "novo": true} {
+		if _, err := store.GetRefresh(ctx, hash); (err == nil) != want {
+			t.Errorf("%s: esperado presente=%v, obtido erro %v", hash, want, err)
+		}
+	}
+	if len(store.families) != 1 || len(store.families["f3"]) != 2 {
+		t.Errorf("famílias: esperado apenas f3 com 2 tokens, obtido %v", store.families)
+	}
+}
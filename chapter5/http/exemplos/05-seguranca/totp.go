@@ -0,0 +1,343 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Parâmetros TOTP (RFC 6238). São os padrões dos aplicativos
+// autenticadores, que ignoram outros valores no otpauth:// URI.
+const (
+	totpDigits = 6
+	totpPeriod = 30 * time.Second
+	// totpSkew é quantos passos antes e depois do atual são aceitos, para
+	// tolerar relógios fora de sincronia
+	totpSkew = 1
+	// totpIssuer identifica o serviço no aplicativo autenticador
+	totpIssuer = "seguranca"
+)
+
+// Segundo fator no login
+const (
+	// mfaPendingTTL é a validade do token entre a senha e o código TOTP
+	mfaPendingTTL = 5 * time.Minute
+	// recoveryCodeCount é quantos códigos de recuperação são gerados
+	recoveryCodeCount = 10
+)
+
+// totpModulus é 10^totpDigits: o HOTP fica com os últimos totpDigits dígitos
+var totpModulus = pow10(totpDigits)
+
+// pow10 calcula 10^n
+func pow10(n int) uint32 {
+	m := uint32(1)
+	for i := 0; i < n; i++ {
+		m *= 10
+	}
+	return m
+}
+
+// totpEncoding é o base32 sem padding usado pelos aplicativos
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// GenerateTOTPSecret gera um segredo de 160 bits, o tamanho recomendado
+// pela RFC 4226 para HMAC-SHA1
+func GenerateTOTPSecret() (string, error) {
+	key := make([]byte, 20)
+	if _, err := rand.Read(key); err != nil {
+		return "", err
+	}
+	return totpEncoding.EncodeToString(key), nil
+}
+
+// TOTPURI monta o otpauth:// URI que os aplicativos leem via QR code
+func TOTPURI(issuer, account, secret string) string {
+	q := url.Values{}
+	q.Set("secret", secret)
+	q.Set("issuer", issuer)
+	q.Set("algorithm", "SHA1")
+	q.Set("digits", fmt.Sprint(totpDigits))
+	q.Set("period", fmt.Sprint(int(totpPeriod.Seconds())))
+	u := url.URL{
+		Scheme:   "otpauth",
+		Host:     "totp",
+		Path:     "/" + issuer + ":" + account,
+		RawQuery: q.Encode(),
+	}
+	return u.String()
+}
+
+// hotp calcula o código HOTP (RFC 4226) do contador
+func hotp(key []byte, counter uint64) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], counter)
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	// Truncamento dinâmico: os 4 bits finais escolhem o trecho usado
+	offset := sum[len(sum)-1] & 0x0f
+	code := binary.BigEndian.Uint32(sum[offset:]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", totpDigits, code%totpModulus)
+}
+
+// VerifyTOTP verifica o código no instante now, aceitando totpSkew passos
+// de diferença. Retorna o passo que coincidiu, para impedir que o mesmo
+// código seja usado duas vezes.
+func VerifyTOTP(secret, code string, now time.Time) (int64, bool) {
+	key, err := totpEncoding.DecodeString(strings.ToUpper(strings.TrimRight(secret, "=")))
+	if err != nil || len(code) != totpDigits {
+		return 0, false
+	}
+	current := now.Unix() / int64(totpPeriod.Seconds())
+	for step := current - totpSkew; step <= current+totpSkew; step++ {
+		if step < 0 {
+			continue
+		}
+		if subtle.ConstantTimeCompare([]byte(hotp(key, uint64(step))), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+// generateRecoveryCodes gera n códigos no formato xxxxx-xxxxx
+func generateRecoveryCodes(n int) ([]string, error) {
+	codes := make([]string, n)
+	for i := range codes {
+		b := make([]byte, 5)
+		if _, err := rand.Read(b); err != nil {
+			return nil, err
+		}
+		code := hex.EncodeToString(b)
+		codes[i] = code[:5] + "-" + code[5:]
+	}
+	return codes, nil
+}
+
+// hashRecoveryCode calcula o hash guardado no repositório. O código é
+// normalizado antes, então hífen e maiúsculas não importam.
+func hashRecoveryCode(code string) string {
+	code = strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
+
+// mfaPendingResponse é a resposta do login quando falta o segundo fator
+type mfaPendingResponse struct {
+	MFARequired bool   `json:"mfa_required"`
+	MFAToken    string `json:"mfa_token"`
+	ExpiresIn   int    `json:"expires_in"`
+}
+
+// respondMFARequired emite o token mfa_pending. A audiência própria faz com
+// que ele só seja aceito em /login/mfa.
+func (s *Server) respondMFARequired(w http.ResponseWriter, user User) {
+	token, err := s.signToken(Claims{UserID: user.ID, Role: user.Role}, mfaPendingTokenAudience, mfaPendingTTL)
+	if err != nil {
+		http.Error(w, "Error generating token", http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(mfaPendingResponse{
+		MFARequired: true,
+		MFAToken:    token,
+		ExpiresIn:   int(mfaPendingTTL.Seconds()),
+	})
+}
+
+// handleLoginMFA conclui o login com o token mfa_pending e um código TOTP
+// ou de recuperação
+func (s *Server) handleLoginMFA(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		MFAToken     string `json:"mfa_token"`
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recovery_code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.MFAToken == "" {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	claims, err := s.validateToken(req.MFAToken, mfaPendingTokenAudience)
+	if err != nil {
+		http.Error(w, "Invalid MFA token", http.StatusUnauthorized)
+		return
+	}
+	revoked, err := s.tokens.IsAccessRevoked(r.Context(), claims.Id)
+	if err != nil {
+		http.Error(w, "Error validating token", http.StatusInternalServerError)
+		return
+	}
+	if revoked {
+		http.Error(w, "Invalid MFA token", http.StatusUnauthorized)
+		return
+	}
+
+	user, err := s.store.Get(r.Context(), claims.UserID)
+	if errors.Is(err, ErrUserNotFound) || (err == nil && !user.MFAEnabled) {
+		http.Error(w, "Invalid MFA token", http.StatusUnauthorized)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Error loading user", http.StatusInternalServerError)
+		return
+	}
+
+	// Códigos errados contam para o mesmo bloqueio da senha, senão os
+	// 10^6 códigos poderiam ser testados com um único token
+	if remaining, locked := s.lockout.Locked(user.Username); locked {
+		respondLocked(w, remaining)
+		return
+	}
+	valid, err := s.verifySecondFactor(r, user, req.Code, req.RecoveryCode)
+	if err != nil {
+		http.Error(w, "Error verifying code", http.StatusInternalServerError)
+		return
+	}
+	if !valid {
+		s.lockout.RecordFailure(user.Username)
+		http.Error(w, "Invalid code", http.StatusUnauthorized)
+		return
+	}
+	s.lockout.RecordSuccess(user.Username)
+
+	// O token mfa_pending vale para um único login
+	if err := s.tokens.RevokeAccess(r.Context(), claims.Id, time.Unix(claims.ExpiresAt, 0)); err != nil {
+		http.Error(w, "Error revoking token", http.StatusInternalServerError)
+		return
+	}
+
+	tokens, err := s.issueTokens(r.Context(), user, "")
+	if err != nil {
+		http.Error(w, "Error generating token", http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(tokens)
+}
+
+// verifySecondFactor verifica o código TOTP ou, se informado, o código de
+// recuperação, consumindo-o
+func (s *Server) verifySecondFactor(r *http.Request, user User, code, recoveryCode string) (bool, error) {
+	if recoveryCode != "" {
+		ok, err := s.store.UseRecoveryCode(r.Context(), user.ID, hashRecoveryCode(recoveryCode))
+		if ok {
+			log.Printf("Código de recuperação usado por %s", user.ID)
+		}
+		return ok, err
+	}
+	step, ok := VerifyTOTP(user.TOTPSecret, code, s.now())
+	if !ok {
+		return false, nil
+	}
+	return s.store.UseTOTPStep(r.Context(), user.ID, step)
+}
+
+// currentUser carrega o usuário autenticado por JWT; API keys são recusadas
+func (s *Server) currentUser(w http.ResponseWriter, r *http.Request) (User, bool) {
+	p, ok := requireSession(w, r)
+	if !ok {
+		return User{}, false
+	}
+	user, err := s.store.Get(r.Context(), p.Subject)
+	if err != nil {
+		http.Error(w, "Error loading user", http.StatusInternalServerError)
+		return User{}, false
+	}
+	return user, true
+}
+
+// handleMFAEnroll gera um segredo TOTP para o usuário autenticado. O MFA
+// só é ativado após /mfa/confirm com um código válido.
+func (s *Server) handleMFAEnroll(w http.ResponseWriter, r *http.Request) {
+	user, ok := s.currentUser(w, r)
+	if !ok {
+		return
+	}
+	if user.MFAEnabled {
+		http.Error(w, "MFA already enabled", http.StatusConflict)
+		return
+	}
+
+	secret, err := GenerateTOTPSecret()
+	if err != nil {
+		http.Error(w, "Error generating secret", http.StatusInternalServerError)
+		return
+	}
+	if err := s.store.SetTOTPSecret(r.Context(), user.ID, secret); err != nil {
+		http.Error(w, "Error saving secret", http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]string{
+		"secret":      secret,
+		"otpauth_uri": TOTPURI(totpIssuer, user.Username, secret),
+	})
+}
+
+// handleMFAConfirm ativa o MFA com o primeiro código do aplicativo e
+// retorna os códigos de recuperação, exibidos apenas uma vez
+func (s *Server) handleMFAConfirm(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Code string `json:"code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	user, ok := s.currentUser(w, r)
+	if !ok {
+		return
+	}
+	if user.MFAEnabled {
+		http.Error(w, "MFA already enabled", http.StatusConflict)
+		return
+	}
+	if user.TOTPSecret == "" {
+		http.Error(w, "MFA enrollment not started", http.StatusConflict)
+		return
+	}
+
+	step, valid := VerifyTOTP(user.TOTPSecret, req.Code, s.now())
+	if valid {
+		var err error
+		if valid, err = s.store.UseTOTPStep(r.Context(), user.ID, step); err != nil {
+			http.Error(w, "Error verifying code", http.StatusInternalServerError)
+			return
+		}
+	}
+	if !valid {
+		http.Error(w, "Invalid code", http.StatusUnauthorized)
+		return
+	}
+
+	codes, err := generateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		http.Error(w, "Error generating recovery codes", http.StatusInternalServerError)
+		return
+	}
+	hashes := make([]string, len(codes))
+	for i, code := range codes {
+		hashes[i] = hashRecoveryCode(code)
+	}
+	if err := s.store.EnableMFA(r.Context(), user.ID, hashes); err != nil {
+		http.Error(w, "Error enabling MFA", http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string][]string{"recovery_codes": codes})
+}
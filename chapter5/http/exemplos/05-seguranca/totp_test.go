@@ -0,0 +1,211 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTOTPVectors(t *testing.T) {
+	// Vetores SHA-1 da RFC 6238, apêndice B, com os 6 últimos dígitos
+	secret := totpEncoding.EncodeToString([]byte("12345678901234567890"))
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	}
+	for _, tt := range tests {
+		if _, ok := VerifyTOTP(secret, tt.code, time.Unix(tt.unix, 0)); !ok {
+			t.Errorf("T=%d: código %s deveria ser válido", tt.unix, tt.code)
+		}
+	}
+}
+
+func TestVerifyTOTPSkew(t *testing.T) {
+	secret, err := GenerateTOTPSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, _ := totpEncoding.DecodeString(secret)
+	now := time.Unix(1_700_000_000, 0)
+	step := now.Unix() / 30
+	code := hotp(key, uint64(step))
+
+	// Um passo de diferença é aceito; dois não
+	for offset, want := range map[time.Duration]bool{
+		-60 * time.Second: false,
+		-30 * time.Second: true,
+		0:                 true,
+		30 * time.Second:  true,
+		60 * time.Second:  false,
+	} {
+		got, ok := VerifyTOTP(secret, code, now.Add(offset))
+		if ok != want || (ok && got != step) {
+			t.Errorf("deslocamento %s: esperado %v, obtido %v (passo %d)", offset, want, ok, got)
+		}
+	}
+	if _, ok := VerifyTOTP(secret, "12345", now); ok {
+		t.Error("código com tamanho errado não deveria ser aceito")
+	}
+}
+
+func TestTOTPURI(t *testing.T) {
+	u, err := url.Parse(TOTPURI("seguranca", "ana", "JBSWY3DPEHPK3PXP"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := u.Query()
+	if u.Scheme != "otpauth" || u.Host != "totp" || u.Path != "/seguranca:ana" ||
+		q.Get("secret") != "JBSWY3DPEHPK3PXP" || q.Get("issuer") != "seguranca" {
+		t.Errorf("URI inesperado: %s", u)
+	}
+}
+
+// enrollMFA ativa o MFA do dono do token e retorna o segredo e os códigos de
+// recuperação
+func enrollMFA(t *testing.T, s *Server, access string) (string, []string) {
+	t.Helper()
+	rec := serve(t, s, "POST", "/mfa/enroll", "", access)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("enroll: esperado 200, obtido %d", rec.Code)
+	}
+	var enroll struct {
+		Secret string `json:"secret"`
+	}
+	json.NewDecoder(rec.Body).Decode(&enroll)
+
+	rec = serve(t, s, "POST", "/mfa/confirm", `{"code":"`+totpCode(t, enroll.Secret, s.now())+`"}`, access)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("confirm: esperado 200, obtido %d", rec.Code)
+	}
+	var confirm struct {
+		RecoveryCodes []string `json:"recovery_codes"`
+	}
+	json.NewDecoder(rec.Body).Decode(&confirm)
+	return enroll.Secret, confirm.RecoveryCodes
+}
+
+// totpCode calcula o código TOTP do instante informado
+func totpCode(t *testing.T, secret string, now time.Time) string {
+	t.Helper()
+	key, err := totpEncoding.DecodeString(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return hotp(key, uint64(now.Unix()/30))
+}
+
+// loginPassword faz o primeiro passo do login de ana com MFA ativo
+func loginPassword(t *testing.T, s *Server) string {
+	t.Helper()
+	rec := serve(t, s, "POST", "/login", `{"username":"ana","password":"senha-secreta"}`, "")
+	var pending mfaPendingResponse
+	json.NewDecoder(rec.Body).Decode(&pending)
+	if rec.Code != http.StatusOK || !pending.MFARequired || pending.MFAToken == "" {
+		t.Fatalf("login: esperado mfa_required, obtido %d %+v", rec.Code, pending)
+	}
+	return pending.MFAToken
+}
+
+func TestMFALogin(t *testing.T) {
+	s := newTestServer(t)
+	// O relógio começa no passado e só avança até o presente, já que a
+	// biblioteca JWT recusa tokens emitidos no futuro
+	now := time.Now().Add(-3 * time.Minute)
+	s.now = func() time.Time { return now }
+
+	secret, recovery := enrollMFA(t, s, login(t, s).AccessToken)
+	if len(recovery) != recoveryCodeCount {
+		t.Fatalf("esperados %d códigos de recuperação, obtidos %d", recoveryCodeCount, len(recovery))
+	}
+	if rec := serve(t, s, "POST", "/mfa/enroll", "", ""); rec.Code != http.StatusUnauthorized {
+		t.Errorf("enroll sem token: esperado 401, obtido %d", rec.Code)
+	}
+
+	// O token mfa_pending não vale como access token
+	pending := loginPassword(t, s)
+	if rec := serve(t, s, "GET", "/protected", "", pending); rec.Code != http.StatusUnauthorized ||
+		!strings.Contains(rec.Body.String(), "MFA verification required") {
+		t.Errorf("mfa_pending em /protected: esperado 401, obtido %d %q", rec.Code, rec.Body)
+	}
+	// Nem um access token vale como mfa_pending
+	ana, _ := s.store.GetByUsername(context.Background(), "ana")
+	access, err := s.createToken(ana.ID, ana.Role)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := `{"mfa_token":"` + access + `","code":"` + totpCode(t, secret, now) + `"}`
+	if rec := serve(t, s, "POST", "/login/mfa", body, ""); rec.Code != http.StatusUnauthorized {
+		t.Errorf("access token em /login/mfa: esperado 401, obtido %d", rec.Code)
+	}
+
+	// O código usado na confirmação não pode ser reaproveitado
+	body = `{"mfa_token":"` + pending + `","code":"` + totpCode(t, secret, now) + `"}`
+	if rec := serve(t, s, "POST", "/login/mfa", body, ""); rec.Code != http.StatusUnauthorized {
+		t.Errorf("código reutilizado: esperado 401, obtido %d", rec.Code)
+	}
+
+	// Próximo passo, com o relógio do cliente 30s adiantado
+	now = now.Add(30 * time.Second)
+	body = `{"mfa_token":"` + pending + `","code":"` + totpCode(t, secret, now.Add(30*time.Second)) + `"}`
+	rec := serve(t, s, "POST", "/login/mfa", body, "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("login/mfa: esperado 200, obtido %d", rec.Code)
+	}
+	var tokens tokenResponse
+	json.NewDecoder(rec.Body).Decode(&tokens)
+	if rec := serve(t, s, "GET", "/protected", "", tokens.AccessToken); rec.Code != http.StatusOK {
+		t.Errorf("access token após MFA: esperado 200, obtido %d", rec.Code)
+	}
+
+	// O token mfa_pending vale para um único login
+	now = now.Add(90 * time.Second)
+	body = `{"mfa_token":"` + pending + `","code":"` + totpCode(t, secret, now) + `"}`
+	if rec := serve(t, s, "POST", "/login/mfa", body, ""); rec.Code != http.StatusUnauthorized {
+		t.Errorf("mfa_pending reutilizado: esperado 401, obtido %d", rec.Code)
+	}
+
+	// Código de recuperação funciona uma vez, com ou sem hífen
+	code := strings.ToUpper(strings.ReplaceAll(recovery[0], "-", ""))
+	body = `{"mfa_token":"` + loginPassword(t, s) + `","recovery_code":"` + code + `"}`
+	if rec := serve(t, s, "POST", "/login/mfa", body, ""); rec.Code != http.StatusOK {
+		t.Errorf("código de recuperação: esperado 200, obtido %d", rec.Code)
+	}
+	body = `{"mfa_token":"` + loginPassword(t, s) + `","recovery_code":"` + recovery[0] + `"}`
+	if rec := serve(t, s, "POST", "/login/mfa", body, ""); rec.Code != http.StatusUnauthorized {
+		t.Errorf("código de recuperação reutilizado: esperado 401, obtido %d", rec.Code)
+	}
+}
+
+func TestMFALockout(t *testing.T) {
+	s := newTestServer(t)
+	now := time.Now().Add(-time.Minute)
+	s.now = func() time.Time { return now }
+	secret, _ := enrollMFA(t, s, login(t, s).AccessToken)
+
+	// Códigos errados bloqueiam a conta como senhas erradas
+	pending := loginPassword(t, s)
+	for i := 0; i < DefaultLockoutConfig().MaxFailures; i++ {
+		body := `{"mfa_token":"` + pending + `","code":"000000"}`
+		serve(t, s, "POST", "/login/mfa", body, "")
+	}
+	now = now.Add(30 * time.Second)
+	body := `{"mfa_token":"` + pending + `","code":"` + totpCode(t, secret, now) + `"}`
+	if rec := serve(t, s, "POST", "/login/mfa", body, ""); rec.Code != http.StatusTooManyRequests {
+		t.Errorf("esperado 429 após códigos errados, obtido %d", rec.Code)
+	}
+
+	ana, _ := s.store.GetByUsername(context.Background(), "ana")
+	if !ana.MFAEnabled {
+		t.Error("MFA deveria continuar ativo")
+	}
+}
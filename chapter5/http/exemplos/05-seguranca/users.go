@@ -0,0 +1,186 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+)
+
+var (
+	// ErrUserNotFound indica que o usuário não existe
+	ErrUserNotFound = errors.New("usuário não encontrado")
+	// ErrUserExists indica que o username já está em uso
+	ErrUserExists = errors.New("username já existe")
+)
+
+// UserRepository armazena os usuários do servidor
+type UserRepository interface {
+	// CreateIfAbsent grava o usuário se o username estiver livre, ou
+	// retorna ErrUserExists. A verificação e a gravação são atômicas: dois
+	// cadastros simultâneos com o mesmo username nunca são aceitos.
+	CreateIfAbsent(ctx context.Context, user User) error
+	// Get retorna o usuário pelo ID
+	Get(ctx context.Context, id string) (User, error)
+	// GetByUsername retorna o usuário pelo username
+	GetByUsername(ctx context.Context, username string) (User, error)
+	// UpdatePasswordHash substitui o hash de senha do usuário
+	UpdatePasswordHash(ctx context.Context, id, hash string) error
+	// SetRole altera a role do usuário e retorna o registro atualizado
+	SetRole(ctx context.Context, id, role string) (User, error)
+	// List retorna todos os usuários ordenados pelo username
+	List(ctx context.Context) ([]User, error)
+
+	// SetTOTPSecret inicia uma inscrição TOTP: grava o segredo, desativa o
+	// MFA até a confirmação e descarta os códigos de recuperação anteriores
+	SetTOTPSecret(ctx context.Context, id, secret string) error
+	// EnableMFA ativa o MFA com os hashes dos códigos de recuperação
+	EnableMFA(ctx context.Context, id string, recoveryHashes []string) error
+	// UseTOTPStep registra o passo TOTP usado. Retorna false se o passo
+	// não for posterior ao último aceito, o que impede reusar um código.
+	UseTOTPStep(ctx context.Context, id string, step int64) (bool, error)
+	// UseRecoveryCode consome o código de recuperação. Retorna false se ele
+	// não existir ou já tiver sido usado.
+	UseRecoveryCode(ctx context.Context, id, hash string) (bool, error)
+}
+
+// MemoryUserRepository é uma implementação de UserRepository em memória,
+// com um índice por username
+type MemoryUserRepository struct {
+	mu         sync.RWMutex
+	users      map[string]User
+	byUsername map[string]string // username → ID
+	totpSteps  map[string]int64
+	recovery   map[string]map[string]bool // ID → hashes não usados
+}
+
+// NewMemoryUserRepository cria um repositório em memória vazio
+func NewMemoryUserRepository() *MemoryUserRepository {
+	return &MemoryUserRepository{
+		users:      make(map[string]User),
+		byUsername: make(map[string]string),
+		totpSteps:  make(map[string]int64),
+		recovery:   make(map[string]map[string]bool),
+	}
+}
+
+func (s *MemoryUserRepository) CreateIfAbsent(ctx context.Context, user User) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, exists := s.byUsername[user.Username]; exists {
+		return ErrUserExists
+	}
+	s.users[user.ID] = user
+	s.byUsername[user.Username] = user.ID
+	return nil
+}
+
+func (s *MemoryUserRepository) Get(ctx context.Context, id string) (User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	user, ok := s.users[id]
+	if !ok {
+		return User{}, ErrUserNotFound
+	}
+	return user, nil
+}
+
+func (s *MemoryUserRepository) GetByUsername(ctx context.Context, username string) (User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	id, ok := s.byUsername[username]
+	if !ok {
+		return User{}, ErrUserNotFound
+	}
+	return s.users[id], nil
+}
+
+func (s *MemoryUserRepository) UpdatePasswordHash(ctx context.Context, id, hash string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	user, ok := s.users[id]
+	if !ok {
+		return ErrUserNotFound
+	}
+	user.PasswordHash = hash
+	s.users[id] = user
+	return nil
+}
+
+func (s *MemoryUserRepository) SetRole(ctx context.Context, id, role string) (User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	user, ok := s.users[id]
+	if !ok {
+		return User{}, ErrUserNotFound
+	}
+	user.Role = role
+	s.users[id] = user
+	return user, nil
+}
+
+func (s *MemoryUserRepository) List(ctx context.Context) ([]User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	users := make([]User, 0, len(s.users))
+	for _, user := range s.users {
+		users = append(users, user)
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].Username < users[j].Username })
+	return users, nil
+}
+
+func (s *MemoryUserRepository) SetTOTPSecret(ctx context.Context, id, secret string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	user, ok := s.users[id]
+	if !ok {
+		return ErrUserNotFound
+	}
+	user.TOTPSecret = secret
+	user.MFAEnabled = false
+	s.users[id] = user
+	delete(s.totpSteps, id)
+	delete(s.recovery, id)
+	return nil
+}
+
+func (s *MemoryUserRepository) EnableMFA(ctx context.Context, id string, recoveryHashes []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	user, ok := s.users[id]
+	if !ok {
+		return ErrUserNotFound
+	}
+	user.MFAEnabled = true
+	s.users[id] = user
+	codes := make(map[string]bool, len(recoveryHashes))
+	for _, hash := range recoveryHashes {
+		codes[hash] = true
+	}
+	s.recovery[id] = codes
+	return nil
+}
+
+func (s *MemoryUserRepository) UseTOTPStep(ctx context.Context, id string, step int64) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.users[id]; !ok {
+		return false, ErrUserNotFound
+	}
+	if step <= s.totpSteps[id] {
+		return false, nil
+	}
+	s.totpSteps[id] = step
+	return true, nil
+}
+
+func (s *MemoryUserRepository) UseRecoveryCode(ctx context.Context, id, hash string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.recovery[id][hash] {
+		return false, nil
+	}
+	delete(s.recovery[id], hash)
+	return true, nil
+}
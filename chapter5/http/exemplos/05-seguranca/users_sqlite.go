@@ -0,0 +1,207 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+
+	"github.com/cauelz/full-cycle-golang-expert/pkg/migrate"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// As migrações do banco de usuários são embutidas no binário
+//
+//go:embed migrations
+var migrationsFS embed.FS
+
+// SQLiteUserRepository implementa UserRepository sobre SQLite. O índice
+// único em username garante a atomicidade de CreateIfAbsent.
+type SQLiteUserRepository struct {
+	db *sql.DB
+}
+
+// NewSQLiteUserRepository cria o repositório sobre um banco aberto por
+// openSQLite
+func NewSQLiteUserRepository(db *sql.DB) *SQLiteUserRepository {
+	return &SQLiteUserRepository{db: db}
+}
+
+// openSQLite abre o banco em path e aplica as migrações pendentes. Usuários
+// e sessões compartilham o mesmo banco.
+func openSQLite(ctx context.Context, path string) (*sql.DB, error) {
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		return nil, err
+	}
+	// O SQLite aceita um único escritor por vez; uma conexão evita
+	// "database is locked"
+	db.SetMaxOpenConns(1)
+
+	m, err := migrate.New(db, migrationsFS, "migrations", migrate.Config{})
+	if err == nil {
+		err = m.Up(ctx)
+	}
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// userColumns são as colunas lidas por scanUser, na mesma ordem
+const userColumns = "id, username, password_hash, role, totp_secret, mfa_enabled"
+
+// rowScanner é satisfeito por *sql.Row e *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanUser(row rowScanner) (User, error) {
+	var u User
+	err := row.Scan(&u.ID, &u.Username, &u.PasswordHash, &u.Role, &u.TOTPSecret, &u.MFAEnabled)
+	if errors.Is(err, sql.ErrNoRows) {
+		return User{}, ErrUserNotFound
+	}
+	return u, err
+}
+
+func (s *SQLiteUserRepository) CreateIfAbsent(ctx context.Context, user User) error {
+	res, err := s.db.ExecContext(ctx,
+		`INSERT INTO users (`+userColumns+`) VALUES (?, ?, ?, ?, ?, ?)
+		 ON CONFLICT (username) DO NOTHING`,
+		user.ID, user.Username, user.PasswordHash, user.Role, user.TOTPSecret, user.MFAEnabled)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrUserExists
+	}
+	return nil
+}
+
+func (s *SQLiteUserRepository) Get(ctx context.Context, id string) (User, error) {
+	return scanUser(s.db.QueryRowContext(ctx,
+		`SELECT `+userColumns+` FROM users WHERE id = ?`, id))
+}
+
+func (s *SQLiteUserRepository) GetByUsername(ctx context.Context, username string) (User, error) {
+	return scanUser(s.db.QueryRowContext(ctx,
+		`SELECT `+userColumns+` FROM users WHERE username = ?`, username))
+}
+
+// execOne executa um comando que deve afetar um usuário, retornando
+// ErrUserNotFound se nenhuma linha for afetada
+func execOne(ctx context.Context, db execer, query string, args ...interface{}) error {
+	res, err := db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+// execer é satisfeito por *sql.DB e *sql.Tx
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+func (s *SQLiteUserRepository) UpdatePasswordHash(ctx context.Context, id, hash string) error {
+	return execOne(ctx, s.db, `UPDATE users SET password_hash = ? WHERE id = ?`, hash, id)
+}
+
+func (s *SQLiteUserRepository) SetRole(ctx context.Context, id, role string) (User, error) {
+	return scanUser(s.db.QueryRowContext(ctx,
+		`UPDATE users SET role = ? WHERE id = ? RETURNING `+userColumns, role, id))
+}
+
+func (s *SQLiteUserRepository) List(ctx context.Context) ([]User, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT `+userColumns+` FROM users ORDER BY username`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []User{}
+	for rows.Next() {
+		u, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, u)
+	}
+	return users, rows.Err()
+}
+
+func (s *SQLiteUserRepository) SetTOTPSecret(ctx context.Context, id, secret string) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = execOne(ctx, tx,
+		`UPDATE users SET totp_secret = ?, mfa_enabled = FALSE, totp_last_step = 0 WHERE id = ?`, secret, id)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM recovery_codes WHERE user_id = ?`, id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *SQLiteUserRepository) EnableMFA(ctx context.Context, id string, recoveryHashes []string) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := execOne(ctx, tx, `UPDATE users SET mfa_enabled = TRUE WHERE id = ?`, id); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM recovery_codes WHERE user_id = ?`, id); err != nil {
+		return err
+	}
+	for _, hash := range recoveryHashes {
+		_, err := tx.ExecContext(ctx,
+			`INSERT INTO recovery_codes (user_id, code_hash) VALUES (?, ?)`, id, hash)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *SQLiteUserRepository) UseTOTPStep(ctx context.Context, id string, step int64) (bool, error) {
+	// A comparação e a gravação são um único UPDATE, então dois logins
+	// simultâneos com o mesmo código não são aceitos
+	err := execOne(ctx, s.db,
+		`UPDATE users SET totp_last_step = ? WHERE id = ? AND totp_last_step < ?`, step, id, step)
+	if errors.Is(err, ErrUserNotFound) {
+		if _, err := s.Get(ctx, id); err != nil {
+			return false, err
+		}
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (s *SQLiteUserRepository) UseRecoveryCode(ctx context.Context, id, hash string) (bool, error) {
+	err := execOne(ctx, s.db,
+		`DELETE FROM recovery_codes WHERE user_id = ? AND code_hash = ?`, id, hash)
+	if errors.Is(err, ErrUserNotFound) {
+		return false, nil
+	}
+	return err == nil, err
+}
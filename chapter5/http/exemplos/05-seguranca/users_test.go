@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+// userRepositories retorna uma instância nova de cada implementação
+func userRepositories(t *testing.T) map[string]UserRepository {
+	t.Helper()
+	db, err := openSQLite(context.Background(), filepath.Join(t.TempDir(), "users.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return map[string]UserRepository{
+		"memory": NewMemoryUserRepository(),
+		"sqlite": NewSQLiteUserRepository(db),
+	}
+}
+
+func TestUserRepository(t *testing.T) {
+	ctx := context.Background()
+	for name, repo := range userRepositories(t) {
+		t.Run(name, func(t *testing.T) {
+			ana := User{ID: "u1", Username: "ana", PasswordHash: "h1", Role: "user"}
+			if err := repo.CreateIfAbsent(ctx, ana); err != nil {
+				t.Fatal(err)
+			}
+			dup := User{ID: "u2", Username: "ana", PasswordHash: "h2", Role: "admin"}
+			if err := repo.CreateIfAbsent(ctx, dup); !errors.Is(err, ErrUserExists) {
+				t.Errorf("username repetido: esperado ErrUserExists, obtido %v", err)
+			}
+			repo.CreateIfAbsent(ctx, User{ID: "u3", Username: "bruno", PasswordHash: "h3", Role: "user"})
+
+			if got, err := repo.GetByUsername(ctx, "ana"); err != nil || got != ana {
+				t.Errorf("GetByUsername: esperado %+v, obtido %+v (%v)", ana, got, err)
+			}
+			if _, err := repo.Get(ctx, "u2"); !errors.Is(err, ErrUserNotFound) {
+				t.Errorf("Get: esperado ErrUserNotFound, obtido %v", err)
+			}
+
+			if err := repo.UpdatePasswordHash(ctx, "u1", "novo"); err != nil {
+				t.Fatal(err)
+			}
+			if err := repo.UpdatePasswordHash(ctx, "nenhum", "x"); !errors.Is(err, ErrUserNotFound) {
+				t.Errorf("UpdatePasswordHash: esperado ErrUserNotFound, obtido %v", err)
+			}
+			updated, err := repo.SetRole(ctx, "u1", "admin")
+			if err != nil || updated.Role != "admin" || updated.PasswordHash != "novo" {
+				t.Errorf("SetRole: obtido %+v (%v)", updated, err)
+			}
+			if _, err := repo.SetRole(ctx, "nenhum", "admin"); !errors.Is(err, ErrUserNotFound) {
+				t.Errorf("SetRole: esperado ErrUserNotFound, obtido %v", err)
+			}
+
+			users, err := repo.List(ctx)
+			if err != nil || len(users) != 2 || users[0].Username != "ana" || users[1].Username != "bruno" {
+				t.Errorf("List: obtido %+v (%v)", users, err)
+			}
+
+			if err := repo.SetTOTPSecret(ctx, "u1", "SEGREDO"); err != nil {
+				t.Fatal(err)
+			}
+			if ok, err := repo.UseTOTPStep(ctx, "u1", 10); !ok || err != nil {
+				t.Errorf("UseTOTPStep: primeiro uso deveria ser aceito (%v)", err)
+			}
+			for _, step := range []int64{10, 9} {
+				if ok, _ := repo.UseTOTPStep(ctx, "u1", step); ok {
+					t.Errorf("UseTOTPStep: passo %d não deveria ser aceito", step)
+				}
+			}
+			if _, err := repo.UseTOTPStep(ctx, "nenhum", 1); !errors.Is(err, ErrUserNotFound) {
+				t.Errorf("UseTOTPStep: esperado ErrUserNotFound, obtido %v", err)
+			}
+			if err := repo.EnableMFA(ctx, "u1", []string{"r1", "r2"}); err != nil {
+				t.Fatal(err)
+			}
+			if got, _ := repo.Get(ctx, "u1"); !got.MFAEnabled || got.TOTPSecret != "SEGREDO" {
+				t.Errorf("EnableMFA: obtido %+v", got)
+			}
+			if ok, err := repo.UseRecoveryCode(ctx, "u1", "r1"); !ok || err != nil {
+				t.Errorf("UseRecoveryCode: primeiro uso deveria ser aceito (%v)", err)
+			}
+			if ok, _ := repo.UseRecoveryCode(ctx, "u1", "r1"); ok {
+				t.Error("UseRecoveryCode: código já usado não deveria ser aceito")
+			}
+
+			// Nova inscrição desativa o MFA e descarta os códigos antigos
+			repo.SetTOTPSecret(ctx, "u1", "OUTRO")
+			if got, _ := repo.Get(ctx, "u1"); got.MFAEnabled {
+				t.Error("SetTOTPSecret deveria desativar o MFA")
+			}
+			if ok, _ := repo.UseRecoveryCode(ctx, "u1", "r2"); ok {
+				t.Error("SetTOTPSecret deveria descartar os códigos de recuperação")
+			}
+		})
+	}
+}
+
+func TestUserRepositoryConcurrentCreate(t *testing.T) {
+	ctx := context.Background()
+	for name, repo := range userRepositories(t) {
+		t.Run(name, func(t *testing.T) {
+			const attempts = 50
+			var wg sync.WaitGroup
+			results := make(chan error, attempts)
+			for i := 0; i < attempts; i++ {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					results <- repo.CreateIfAbsent(ctx, User{
+						ID:       fmt.Sprintf("u%d", i),
+						Username: "disputado",
+						Role:     "user",
+					})
+				}(i)
+			}
+			wg.Wait()
+			close(results)
+
+			created := 0
+			for err := range results {
+				switch {
+				case err == nil:
+					created++
+				case !errors.Is(err, ErrUserExists):
+					t.Errorf("erro inesperado: %v", err)
+				}
+			}
+			if created != 1 {
+				t.Errorf("esperado exatamente 1 cadastro, obtido %d", created)
+			}
+			if users, _ := repo.List(ctx); len(users) != 1 {
+				t.Errorf("esperado 1 usuário gravado, obtido %d", len(users))
+			}
+		})
+	}
+}
+
+func TestSQLiteUserRepositoryPersists(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "users.db")
+
+	// O mesmo caminho de NewServer com USERS_DB
+	repo, _, _, err := openStores(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo.CreateIfAbsent(ctx, User{ID: "u1", Username: "ana", PasswordHash: "h", Role: "user"})
+	repo.(*SQLiteUserRepository).db.Close()
+
+	// Reabrir não reaplica as migrações nem perde os usuários
+	repo, _, _, err = openStores(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer repo.(*SQLiteUserRepository).db.Close()
+	if _, err := repo.GetByUsername(ctx, "ana"); err != nil {
+		t.Errorf("usuário deveria persistir: %v", err)
+	}
+}
@@ -0,0 +1,70 @@
+// Package auth transporta a identidade autenticada de uma requisição pelo
+// context.Context.
+//
+// Middlewares de autenticação guardam o Principal com WithPrincipal e os
+// handlers o recuperam com PrincipalFrom, que informa se ele existe em vez
+// de causar panic quando o middleware não foi aplicado:
+//
+//	p, ok := auth.PrincipalFrom(r.Context())
+//	if !ok {
+//		http.Error(w, "Authentication required", http.StatusUnauthorized)
+//		return
+//	}
+//
+// A chave usada no contexto é de um tipo não exportado, então nenhum outro
+// pacote consegue ler ou sobrescrever o valor diretamente.
+package auth
+
+import (
+	"context"
+	"time"
+)
+
+// Principal é quem está executando a requisição
+type Principal struct {
+	// Subject identifica o usuário (ou o ator, em APIs sem autenticação)
+	Subject string
+	// Role é a role usada nas decisões de autorização
+	Role string
+	// TokenID é o identificador da credencial usada (jti do JWT), se houver
+	TokenID string
+	// ExpiresAt é quando a credencial expira; zero se não expirar
+	ExpiresAt time.Time
+	// Scopes restringem a credencial a essas permissões, dentro das da
+	// role. Nil quando a credencial não tem escopos (JWT ou sessão); "*"
+	// concede todas as permissões da role.
+	Scopes []string
+}
+
+// Restricted informa se a credencial é limitada por escopos
+func (p Principal) Restricted() bool {
+	return p.Scopes != nil
+}
+
+// HasScope informa se os escopos permitem a permissão. Credenciais sem
+// escopos não são restringidas.
+func (p Principal) HasScope(perm string) bool {
+	if !p.Restricted() {
+		return true
+	}
+	for _, scope := range p.Scopes {
+		if scope == "*" || scope == perm {
+			return true
+		}
+	}
+	return false
+}
+
+// principalKey é a chave do Principal no contexto
+type principalKey struct{}
+
+// WithPrincipal retorna uma cópia de ctx com o Principal
+func WithPrincipal(ctx context.Context, p Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// PrincipalFrom retorna o Principal guardado por WithPrincipal
+func PrincipalFrom(ctx context.Context) (Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(Principal)
+	return p, ok
+}
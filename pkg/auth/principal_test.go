@@ -0,0 +1,47 @@
+package auth
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestPrincipal(t *testing.T) {
+	ctx := context.Background()
+	if _, ok := PrincipalFrom(ctx); ok {
+		t.Fatal("contexto vazio não deveria ter Principal")
+	}
+
+	// Uma chave string igual à de código antigo não colide com a do pacote
+	ctx = context.WithValue(ctx, "claims", "valor de outro pacote")
+	if _, ok := PrincipalFrom(ctx); ok {
+		t.Fatal("chave string não deveria ser lida como Principal")
+	}
+
+	want := Principal{Subject: "user_1", Role: "admin", TokenID: "abc", Scopes: []string{"users:read"}}
+	ctx = WithPrincipal(ctx, want)
+	got, ok := PrincipalFrom(ctx)
+	if !ok || !reflect.DeepEqual(got, want) {
+		t.Errorf("esperado %+v, obtido %+v (ok=%v)", want, got, ok)
+	}
+}
+
+func TestPrincipalHasScope(t *testing.T) {
+	tests := []struct {
+		scopes []string
+		perm   string
+		want   bool
+	}{
+		{nil, "users:write", true},
+		{[]string{"users:read"}, "users:read", true},
+		{[]string{"users:read"}, "users:write", false},
+		{[]string{"*"}, "users:write", true},
+		{[]string{}, "users:read", false},
+	}
+	for _, tt := range tests {
+		p := Principal{Subject: "user_1", Scopes: tt.scopes}
+		if got := p.HasScope(tt.perm); got != tt.want {
+			t.Errorf("HasScope(%q) com escopos %v: esperado %v, obtido %v", tt.perm, tt.scopes, tt.want, got)
+		}
+	}
+}
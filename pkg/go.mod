@@ -0,0 +1,5 @@
+module github.com/cauelz/full-cycle-golang-expert/pkg
+
+go 1.22
+
+require github.com/mattn/go-sqlite3 v1.14.28
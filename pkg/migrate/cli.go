@@ -0,0 +1,83 @@
+package migrate
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"text/tabwriter"
+)
+
+// Usage descreve os subcomandos aceitos por Run
+const Usage = `uso: migrate <comando>
+
+comandos:
+  up         aplica todas as migrações pendentes
+  down       reverte a última migração aplicada
+  status     lista as migrações e se foram aplicadas
+  goto N     migra para cima ou para baixo até a versão N (0 reverte tudo)
+  unlock     remove um lock deixado por uma migração interrompida`
+
+// Run executa um subcomando de migração (up, down, status, goto N, unlock)
+// e escreve o resultado em w
+func Run(ctx context.Context, m *Migrator, args []string, w io.Writer) error {
+	if len(args) == 0 {
+		return fmt.Errorf("comando ausente\n%s", Usage)
+	}
+
+	switch args[0] {
+	case "up":
+		if err := m.Up(ctx); err != nil {
+			return err
+		}
+	case "down":
+		if err := m.Down(ctx); err != nil {
+			return err
+		}
+	case "goto":
+		if len(args) != 2 {
+			return fmt.Errorf("goto exige a versão\n%s", Usage)
+		}
+		version, err := strconv.Atoi(args[1])
+		if err != nil || version < 0 {
+			return fmt.Errorf("versão inválida: %q", args[1])
+		}
+		if err := m.Goto(ctx, version); err != nil {
+			return err
+		}
+	case "unlock":
+		if err := m.ForceUnlock(ctx); err != nil {
+			return err
+		}
+		fmt.Fprintln(w, "lock removido")
+		return nil
+	case "status":
+		return printStatus(ctx, m, w)
+	default:
+		return fmt.Errorf("comando desconhecido %q\n%s", args[0], Usage)
+	}
+
+	version, err := m.Version(ctx)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "versão atual: %d\n", version)
+	return nil
+}
+
+func printStatus(ctx context.Context, m *Migrator, w io.Writer) error {
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		return err
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "VERSÃO\tNOME\tAPLICADA EM")
+	for _, s := range statuses {
+		appliedAt := "pendente"
+		if s.Applied {
+			appliedAt = s.AppliedAt
+		}
+		fmt.Fprintf(tw, "%04d\t%s\t%s\n", s.Version, s.Name, appliedAt)
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,505 @@
+// Package migrate aplica migrações de schema versionadas em bancos
+// database/sql.
+//
+// As migrações são arquivos SQL numerados, normalmente embutidos no binário
+// com embed.FS:
+//
+//	0001_create_users.up.sql
+//	0001_create_users.down.sql
+//	0002_add_index.up.sql
+//	...
+//
+// As versões aplicadas ficam registradas na tabela schema_migrations e uma
+// tabela de lock impede que duas instâncias migrem o mesmo banco ao mesmo
+// tempo.
+//
+// Cada migração roda em uma transação junto com o registro da versão. No
+// SQLite e no PostgreSQL o DDL é transacional, então uma migração que falha
+// não deixa nada aplicado, e o script inteiro é enviado em um único Exec. O
+// MySQL faz commit implícito a cada DDL e, sem multiStatements=true no DSN,
+// recusa scripts com vários comandos: use Config.SplitStatements e escreva
+// uma alteração de schema por migração, porque uma falha no meio deixa os
+// comandos anteriores aplicados sem registrar a versão.
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrLocked indica que outra instância está migrando o banco
+	ErrLocked = errors.New("migrate: banco bloqueado por outra migração")
+	// ErrNoDown indica que a migração não possui arquivo .down.sql
+	ErrNoDown = errors.New("migrate: migração sem arquivo down")
+	// ErrUnknownVersion indica uma versão que não existe nos arquivos
+	ErrUnknownVersion = errors.New("migrate: versão desconhecida")
+)
+
+// Migration é uma versão do schema com seus scripts de ida e volta
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Status descreve uma migração e se ela já foi aplicada
+type Status struct {
+	Migration
+	Applied   bool
+	AppliedAt string
+}
+
+// Placeholder define o estilo de parâmetros do driver
+type Placeholder int
+
+const (
+	// Question usa "?" (SQLite, MySQL)
+	Question Placeholder = iota
+	// Dollar usa "$1", "$2"... (PostgreSQL)
+	Dollar
+)
+
+// Config ajusta o comportamento do Migrator
+type Config struct {
+	// Table é o nome da tabela de controle (padrão schema_migrations)
+	Table string
+	// Placeholder é o estilo de parâmetros do driver (padrão Question)
+	Placeholder Placeholder
+	// LockTimeout é quanto esperar pelo lock antes de retornar ErrLocked
+	// (padrão 10s)
+	LockTimeout time.Duration
+	// SplitStatements executa cada comando do script separadamente, para
+	// drivers que não aceitam vários comandos por Exec (MySQL). Os comandos
+	// são separados por ";" fora de strings e comentários, então corpos com
+	// ";" internos, como triggers com BEGIN ... END, não são suportados.
+	SplitStatements bool
+}
+
+// Migrator aplica as migrações carregadas em um banco
+type Migrator struct {
+	db         *sql.DB
+	migrations []Migration
+	cfg        Config
+	owner      string
+}
+
+var fileRe = regexp.MustCompile(`^(\d+)_(.+)\.(up|down)\.sql$`)
+
+// Load lê as migrações do diretório dir de fsys, ordenadas por versão
+func Load(fsys fs.FS, dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		m := fileRe.FindStringSubmatch(e.Name())
+		if m == nil {
+			continue
+		}
+		version, err := strconv.Atoi(m[1])
+		if err != nil {
+			return nil, fmt.Errorf("migrate: versão inválida em %s: %w", e.Name(), err)
+		}
+		content, err := fs.ReadFile(fsys, path.Join(dir, e.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		mig, ok := byVersion[version]
+		if !ok {
+			mig = &Migration{Version: version, Name: m[2]}
+			byVersion[version] = mig
+		} else if mig.Name != m[2] {
+			return nil, fmt.Errorf("migrate: versão %d duplicada (%s e %s)", version, mig.Name, m[2])
+		}
+		if m[3] == "up" {
+			mig.Up = string(content)
+		} else {
+			mig.Down = string(content)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, mig := range byVersion {
+		if mig.Up == "" {
+			return nil, fmt.Errorf("migrate: versão %d sem arquivo up", mig.Version)
+		}
+		migrations = append(migrations, *mig)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	return migrations, nil
+}
+
+// New cria um Migrator com as migrações do diretório dir de fsys
+func New(db *sql.DB, fsys fs.FS, dir string, cfg Config) (*Migrator, error) {
+	migrations, err := Load(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Table == "" {
+		cfg.Table = "schema_migrations"
+	}
+	if cfg.LockTimeout == 0 {
+		cfg.LockTimeout = 10 * time.Second
+	}
+	host, _ := os.Hostname()
+	return &Migrator{
+		db:         db,
+		migrations: migrations,
+		cfg:        cfg,
+		owner:      fmt.Sprintf("%s:%d", host, os.Getpid()),
+	}, nil
+}
+
+// Migrations retorna as migrações conhecidas, ordenadas por versão
+func (m *Migrator) Migrations() []Migration {
+	return m.migrations
+}
+
+// Rebind troca cada "?" fora de literais pelo estilo de placeholder p
+func (p Placeholder) Rebind(query string) string {
+	if p != Dollar {
+		return query
+	}
+	var b strings.Builder
+	n := 0
+	inString := false
+	for _, r := range query {
+		switch {
+		case r == '\'':
+			inString = !inString
+		case r == '?' && !inString:
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// rebind adapta os placeholders "?" ao estilo do driver
+func (m *Migrator) rebind(query string) string {
+	return m.cfg.Placeholder.Rebind(query)
+}
+
+// splitStatements separa o script nos ";" que ficam fora de strings,
+// identificadores entre aspas e comentários. Comandos vazios são descartados.
+func splitStatements(script string) []string {
+	var stmts []string
+	start := 0
+	for i := 0; i < len(script); i++ {
+		switch c := script[i]; {
+		case c == '\'' || c == '"' || c == '`':
+			// Avança até a aspa de fechamento; aspas duplicadas ('') são
+			// tratadas como duas strings seguidas, o que dá no mesmo
+			if j := strings.IndexByte(script[i+1:], c); j >= 0 {
+				i += j + 1
+			} else {
+				i = len(script)
+			}
+		case c == '-' && strings.HasPrefix(script[i:], "--"):
+			if j := strings.IndexByte(script[i:], '\n'); j >= 0 {
+				i += j
+			} else {
+				i = len(script)
+			}
+		case c == '/' && strings.HasPrefix(script[i:], "/*"):
+			if j := strings.Index(script[i+2:], "*/"); j >= 0 {
+				i += j + 3
+			} else {
+				i = len(script)
+			}
+		case c == ';':
+			stmts = append(stmts, script[start:i])
+			start = i + 1
+		}
+	}
+	stmts = append(stmts, script[min(start, len(script)):])
+
+	nonEmpty := stmts[:0]
+	for _, stmt := range stmts {
+		if strings.TrimSpace(stripComments(stmt)) != "" {
+			nonEmpty = append(nonEmpty, strings.TrimSpace(stmt))
+		}
+	}
+	return nonEmpty
+}
+
+// stripComments remove os comentários de linha, para reconhecer trechos que
+// só contêm comentários
+func stripComments(stmt string) string {
+	var b strings.Builder
+	for _, line := range strings.Split(stmt, "\n") {
+		if !strings.HasPrefix(strings.TrimSpace(line), "--") {
+			b.WriteString(line + "\n")
+		}
+	}
+	return b.String()
+}
+
+func (m *Migrator) lockTable() string {
+	return m.cfg.Table + "_lock"
+}
+
+// ensureTables cria as tabelas de controle se não existirem
+func (m *Migrator) ensureTables(ctx context.Context) error {
+	_, err := m.db.ExecContext(ctx, fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+		version BIGINT PRIMARY KEY,
+		name VARCHAR(255) NOT NULL,
+		applied_at TIMESTAMP NOT NULL
+	)`, m.cfg.Table))
+	if err != nil {
+		return err
+	}
+	_, err = m.db.ExecContext(ctx, fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+		id INTEGER PRIMARY KEY,
+		owner VARCHAR(255) NOT NULL,
+		locked_at TIMESTAMP NOT NULL
+	)`, m.lockTable()))
+	return err
+}
+
+// lock adquire o lock de migração. A chave primária da tabela de lock
+// garante que apenas uma instância consiga inserir a linha.
+func (m *Migrator) lock(ctx context.Context) error {
+	deadline := time.Now().Add(m.cfg.LockTimeout)
+	query := m.rebind(fmt.Sprintf("INSERT INTO %s (id, owner, locked_at) VALUES (1, ?, ?)", m.lockTable()))
+	for {
+		_, err := m.db.ExecContext(ctx, query, m.owner, time.Now().UTC())
+		if err == nil {
+			return nil
+		}
+		held, qerr := m.lockHeld(ctx)
+		if qerr != nil {
+			return qerr
+		}
+		if !held {
+			// O erro não foi de lock ocupado
+			return err
+		}
+		if time.Now().After(deadline) {
+			return ErrLocked
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+}
+
+func (m *Migrator) lockHeld(ctx context.Context) (bool, error) {
+	var n int
+	err := m.db.QueryRowContext(ctx, fmt.Sprintf("SELECT COUNT(*) FROM %s", m.lockTable())).Scan(&n)
+	return n > 0, err
+}
+
+func (m *Migrator) unlock(ctx context.Context) error {
+	_, err := m.db.ExecContext(ctx, m.rebind(fmt.Sprintf("DELETE FROM %s WHERE id = 1 AND owner = ?", m.lockTable())), m.owner)
+	return err
+}
+
+// ForceUnlock remove o lock mesmo que pertença a outra instância. Use apenas
+// quando uma migração foi interrompida e deixou o lock para trás.
+func (m *Migrator) ForceUnlock(ctx context.Context) error {
+	if err := m.ensureTables(ctx); err != nil {
+		return err
+	}
+	_, err := m.db.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s", m.lockTable()))
+	return err
+}
+
+// withLock executa fn com o lock de migração adquirido
+func (m *Migrator) withLock(ctx context.Context, fn func() error) error {
+	if err := m.ensureTables(ctx); err != nil {
+		return err
+	}
+	if err := m.lock(ctx); err != nil {
+		return err
+	}
+	// Libera o lock mesmo se o contexto da operação tiver sido cancelado
+	defer m.unlock(context.WithoutCancel(ctx))
+	return fn()
+}
+
+// applied retorna as versões aplicadas e a data de aplicação
+func (m *Migrator) applied(ctx context.Context) (map[int]string, error) {
+	rows, err := m.db.QueryContext(ctx, fmt.Sprintf("SELECT version, applied_at FROM %s", m.cfg.Table))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	versions := make(map[int]string)
+	for rows.Next() {
+		var version int
+		var appliedAt string
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, err
+		}
+		versions[version] = appliedAt
+	}
+	return versions, rows.Err()
+}
+
+// Version retorna a maior versão aplicada (0 se nenhuma)
+func (m *Migrator) Version(ctx context.Context) (int, error) {
+	if err := m.ensureTables(ctx); err != nil {
+		return 0, err
+	}
+	var version sql.NullInt64
+	err := m.db.QueryRowContext(ctx, fmt.Sprintf("SELECT MAX(version) FROM %s", m.cfg.Table)).Scan(&version)
+	return int(version.Int64), err
+}
+
+// Status lista todas as migrações e se foram aplicadas
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	if err := m.ensureTables(ctx); err != nil {
+		return nil, err
+	}
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+	statuses := make([]Status, len(m.migrations))
+	for i, mig := range m.migrations {
+		appliedAt, ok := applied[mig.Version]
+		statuses[i] = Status{Migration: mig, Applied: ok, AppliedAt: appliedAt}
+	}
+	return statuses, nil
+}
+
+// Up aplica todas as migrações pendentes
+func (m *Migrator) Up(ctx context.Context) error {
+	return m.withLock(ctx, func() error {
+		applied, err := m.applied(ctx)
+		if err != nil {
+			return err
+		}
+		for _, mig := range m.migrations {
+			if _, ok := applied[mig.Version]; ok {
+				continue
+			}
+			if err := m.apply(ctx, mig, true); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Down reverte a última migração aplicada
+func (m *Migrator) Down(ctx context.Context) error {
+	return m.withLock(ctx, func() error {
+		applied, err := m.applied(ctx)
+		if err != nil {
+			return err
+		}
+		for i := len(m.migrations) - 1; i >= 0; i-- {
+			if _, ok := applied[m.migrations[i].Version]; ok {
+				return m.apply(ctx, m.migrations[i], false)
+			}
+		}
+		return nil
+	})
+}
+
+// Goto migra para cima ou para baixo até a versão informada.
+// A versão 0 reverte todas as migrações.
+func (m *Migrator) Goto(ctx context.Context, version int) error {
+	if version != 0 && !m.known(version) {
+		return fmt.Errorf("%w: %d", ErrUnknownVersion, version)
+	}
+	return m.withLock(ctx, func() error {
+		applied, err := m.applied(ctx)
+		if err != nil {
+			return err
+		}
+		// Reverte primeiro as versões acima do alvo, da maior para a menor
+		for i := len(m.migrations) - 1; i >= 0; i-- {
+			mig := m.migrations[i]
+			if _, ok := applied[mig.Version]; ok && mig.Version > version {
+				if err := m.apply(ctx, mig, false); err != nil {
+					return err
+				}
+			}
+		}
+		for _, mig := range m.migrations {
+			if _, ok := applied[mig.Version]; !ok && mig.Version <= version {
+				if err := m.apply(ctx, mig, true); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
+
+func (m *Migrator) known(version int) bool {
+	for _, mig := range m.migrations {
+		if mig.Version == version {
+			return true
+		}
+	}
+	return false
+}
+
+// apply executa o script da migração e atualiza schema_migrations na mesma
+// transação. Veja a documentação do pacote sobre bancos sem DDL transacional.
+func (m *Migrator) apply(ctx context.Context, mig Migration, up bool) error {
+	script := mig.Up
+	if !up {
+		if mig.Down == "" {
+			return fmt.Errorf("%w: %d_%s", ErrNoDown, mig.Version, mig.Name)
+		}
+		script = mig.Down
+	}
+
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmts := []string{script}
+	if m.cfg.SplitStatements {
+		stmts = splitStatements(script)
+	}
+	for _, stmt := range stmts {
+		if _, err := tx.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("migrate: %d_%s: %w", mig.Version, mig.Name, err)
+		}
+	}
+	if up {
+		_, err = tx.ExecContext(ctx,
+			m.rebind(fmt.Sprintf("INSERT INTO %s (version, name, applied_at) VALUES (?, ?, ?)", m.cfg.Table)),
+			mig.Version, mig.Name, time.Now().UTC())
+	} else {
+		_, err = tx.ExecContext(ctx,
+			m.rebind(fmt.Sprintf("DELETE FROM %s WHERE version = ?", m.cfg.Table)), mig.Version)
+	}
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
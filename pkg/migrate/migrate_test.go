@@ -0,0 +1,269 @@
+package migrate
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+var testFS = fstest.MapFS{
+	"migrations/0001_create_users.up.sql":      {Data: []byte("CREATE TABLE users (id INTEGER PRIMARY KEY, name TEXT NOT NULL)")},
+	"migrations/0001_create_users.down.sql":    {Data: []byte("DROP TABLE users")},
+	"migrations/0002_add_email.up.sql":         {Data: []byte("ALTER TABLE users ADD COLUMN email TEXT")},
+	"migrations/0002_add_email.down.sql":       {Data: []byte("ALTER TABLE users DROP COLUMN email")},
+	"migrations/0003_create_products.up.sql":   {Data: []byte("CREATE TABLE products (id INTEGER PRIMARY KEY); CREATE INDEX idx_products ON products (id)")},
+	"migrations/0003_create_products.down.sql": {Data: []byte("DROP TABLE products")},
+	"migrations/README.md":                     {Data: []byte("ignorado")},
+}
+
+func openDB(t *testing.T) *sql.DB {
+	t.Helper()
+	dsn := "file:" + filepath.Join(t.TempDir(), "test.db") + "?_busy_timeout=5000"
+	db, err := sql.Open("sqlite3", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func newMigrator(t *testing.T, db *sql.DB, fsys fstest.MapFS) *Migrator {
+	t.Helper()
+	m, err := New(db, fsys, "migrations", Config{LockTimeout: 200 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("New: erro inesperado: %v", err)
+	}
+	return m
+}
+
+func tableExists(t *testing.T, db *sql.DB, name string) bool {
+	t.Helper()
+	var n int
+	err := db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?", name).Scan(&n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return n > 0
+}
+
+func assertVersion(t *testing.T, m *Migrator, want int) {
+	t.Helper()
+	got, err := m.Version(context.Background())
+	if err != nil {
+		t.Fatalf("Version: erro inesperado: %v", err)
+	}
+	if got != want {
+		t.Errorf("Version: esperado %d, obtido %d", want, got)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	migrations, err := Load(testFS, "migrations")
+	if err != nil {
+		t.Fatalf("Load: erro inesperado: %v", err)
+	}
+	if len(migrations) != 3 {
+		t.Fatalf("Load: esperado 3 migrações, obtido %d", len(migrations))
+	}
+	for i, mig := range migrations {
+		if mig.Version != i+1 {
+			t.Errorf("Load: esperado versão %d na posição %d, obtido %d", i+1, i, mig.Version)
+		}
+	}
+
+	_, err = Load(fstest.MapFS{"m/0001_a.down.sql": {Data: []byte("x")}}, "m")
+	if err == nil {
+		t.Error("Load: esperado erro para migração sem arquivo up")
+	}
+}
+
+func TestUpDownGoto(t *testing.T) {
+	ctx := context.Background()
+	db := openDB(t)
+	m := newMigrator(t, db, testFS)
+
+	assertVersion(t, m, 0)
+
+	if err := m.Up(ctx); err != nil {
+		t.Fatalf("Up: erro inesperado: %v", err)
+	}
+	assertVersion(t, m, 3)
+	if !tableExists(t, db, "products") {
+		t.Error("Up: tabela products não foi criada")
+	}
+
+	// Up é idempotente
+	if err := m.Up(ctx); err != nil {
+		t.Fatalf("Up repetido: erro inesperado: %v", err)
+	}
+
+	if err := m.Down(ctx); err != nil {
+		t.Fatalf("Down: erro inesperado: %v", err)
+	}
+	assertVersion(t, m, 2)
+	if tableExists(t, db, "products") {
+		t.Error("Down: tabela products deveria ter sido removida")
+	}
+
+	if err := m.Goto(ctx, 0); err != nil {
+		t.Fatalf("Goto(0): erro inesperado: %v", err)
+	}
+	assertVersion(t, m, 0)
+	if tableExists(t, db, "users") {
+		t.Error("Goto(0): tabela users deveria ter sido removida")
+	}
+
+	if err := m.Goto(ctx, 2); err != nil {
+		t.Fatalf("Goto(2): erro inesperado: %v", err)
+	}
+	assertVersion(t, m, 2)
+
+	if err := m.Goto(ctx, 42); !errors.Is(err, ErrUnknownVersion) {
+		t.Errorf("Goto(42): esperado ErrUnknownVersion, obtido %v", err)
+	}
+}
+
+func TestFailedMigrationRollsBack(t *testing.T) {
+	ctx := context.Background()
+	db := openDB(t)
+	fsys := fstest.MapFS{
+		"migrations/0001_ok.up.sql":     {Data: []byte("CREATE TABLE a (id INTEGER)")},
+		"migrations/0002_broken.up.sql": {Data: []byte("CREATE TABLE b (id INTEGER); SELECT * FROM inexistente")},
+	}
+	m := newMigrator(t, db, fsys)
+
+	if err := m.Up(ctx); err == nil {
+		t.Fatal("Up: esperado erro na migração 2")
+	}
+	assertVersion(t, m, 1)
+	if tableExists(t, db, "b") {
+		t.Error("Up: a migração com erro deveria ter sido revertida")
+	}
+
+	// O lock é liberado mesmo após a falha
+	if err := m.Goto(ctx, 1); err != nil {
+		t.Errorf("Goto após falha: erro inesperado: %v", err)
+	}
+}
+
+func TestSplitStatements(t *testing.T) {
+	tests := []struct {
+		script string
+		want   []string
+	}{
+		{"CREATE TABLE a (id INTEGER)", []string{"CREATE TABLE a (id INTEGER)"}},
+		{"CREATE TABLE a (id INTEGER);\n\nCREATE INDEX i ON a (id);\n", []string{"CREATE TABLE a (id INTEGER)", "CREATE INDEX i ON a (id)"}},
+		{"INSERT INTO a VALUES ('x;y'); INSERT INTO a VALUES (\"z;\")", []string{"INSERT INTO a VALUES ('x;y')", "INSERT INTO a VALUES (\"z;\")"}},
+		{"-- cria a; depois b\nCREATE TABLE a (id INT);\n/* ; */ CREATE TABLE b (id INT);\n-- fim", []string{"-- cria a; depois b\nCREATE TABLE a (id INT)", "/* ; */ CREATE TABLE b (id INT)"}},
+		{"CREATE TABLE `a;b` (id INT)", []string{"CREATE TABLE `a;b` (id INT)"}},
+		{" ; ;", nil},
+	}
+	for _, tt := range tests {
+		got := splitStatements(tt.script)
+		if strings.Join(got, "|") != strings.Join(tt.want, "|") || len(got) != len(tt.want) {
+			t.Errorf("splitStatements(%q): esperado %q, obtido %q", tt.script, tt.want, got)
+		}
+	}
+}
+
+func TestSplitStatementsMigration(t *testing.T) {
+	ctx := context.Background()
+	db := openDB(t)
+	fsys := fstest.MapFS{
+		"migrations/0001_ok.up.sql":     {Data: []byte("CREATE TABLE a (id INTEGER);\nCREATE TABLE b (id INTEGER);")},
+		"migrations/0002_broken.up.sql": {Data: []byte("CREATE TABLE c (id INTEGER);\nSELECT * FROM inexistente;")},
+	}
+	m, err := New(db, fsys, "migrations", Config{SplitStatements: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := m.Up(ctx); err == nil {
+		t.Fatal("Up: esperado erro na migração 2")
+	}
+	assertVersion(t, m, 1)
+	if !tableExists(t, db, "a") || !tableExists(t, db, "b") {
+		t.Error("Up: a migração 1 deveria ter criado a e b")
+	}
+	// O SQLite tem DDL transacional, então o primeiro comando também volta
+	if tableExists(t, db, "c") {
+		t.Error("Up: a migração com erro deveria ter sido revertida")
+	}
+}
+
+func TestPlaceholderRebind(t *testing.T) {
+	query := `SELECT * FROM users WHERE name = ? AND email LIKE '%?%' AND id > ?`
+	tests := []struct {
+		placeholder Placeholder
+		want        string
+	}{
+		{Question, query},
+		{Dollar, `SELECT * FROM users WHERE name = $1 AND email LIKE '%?%' AND id > $2`},
+	}
+	for _, tt := range tests {
+		if got := tt.placeholder.Rebind(query); got != tt.want {
+			t.Errorf("Rebind(%d): esperado %q, obtido %q", tt.placeholder, tt.want, got)
+		}
+	}
+}
+
+func TestLock(t *testing.T) {
+	ctx := context.Background()
+	db := openDB(t)
+	first := newMigrator(t, db, testFS)
+	second := newMigrator(t, db, testFS)
+	second.owner = "outra-instancia"
+
+	if err := first.ensureTables(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := first.lock(ctx); err != nil {
+		t.Fatalf("lock: erro inesperado: %v", err)
+	}
+
+	if err := second.Up(ctx); !errors.Is(err, ErrLocked) {
+		t.Fatalf("Up com lock ocupado: esperado ErrLocked, obtido %v", err)
+	}
+	assertVersion(t, second, 0)
+
+	if err := first.unlock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := second.Up(ctx); err != nil {
+		t.Fatalf("Up após unlock: erro inesperado: %v", err)
+	}
+	assertVersion(t, second, 3)
+}
+
+func TestRun(t *testing.T) {
+	ctx := context.Background()
+	m := newMigrator(t, openDB(t), testFS)
+
+	var out bytes.Buffer
+	if err := Run(ctx, m, []string{"goto", "1"}, &out); err != nil {
+		t.Fatalf("Run(goto 1): erro inesperado: %v", err)
+	}
+	if !strings.Contains(out.String(), "versão atual: 1") {
+		t.Errorf("Run(goto 1): saída inesperada %q", out.String())
+	}
+
+	out.Reset()
+	if err := Run(ctx, m, []string{"status"}, &out); err != nil {
+		t.Fatalf("Run(status): erro inesperado: %v", err)
+	}
+	if !strings.Contains(out.String(), "add_email") || !strings.Contains(out.String(), "pendente") {
+		t.Errorf("Run(status): saída inesperada %q", out.String())
+	}
+
+	if err := Run(ctx, m, []string{"sideways"}, &out); err == nil {
+		t.Error("Run: esperado erro para comando desconhecido")
+	}
+}
@@ -0,0 +1,280 @@
+// Package validate valida structs a partir da tag `validate`.
+//
+// As regras são separadas por vírgula e aplicadas na ordem declarada:
+//
+//	type User struct {
+//		Name  string `json:"name" validate:"required,min=3,max=50"`
+//		Email string `json:"email" validate:"required,email"`
+//		Role  string `json:"role" validate:"oneof=admin user"`
+//	}
+//
+// Regras suportadas:
+//
+//	required   o valor não pode ser zero
+//	min=N      tamanho mínimo (strings, slices, maps) ou valor mínimo (números)
+//	max=N      tamanho máximo (strings, slices, maps) ou valor máximo (números)
+//	email      endereço de email no formato usuario@dominio
+//	oneof=a b  um dos valores listados, separados por espaço
+//
+// Campos com valor zero e sem required são ignorados. Ponteiros nil também
+// são ignorados; ponteiros preenchidos têm o valor apontado validado sempre,
+// o que permite validar corpos de PATCH com campos opcionais. Structs
+// aninhadas são validadas recursivamente.
+//
+// O nome reportado para cada campo é o da tag json, quando existir.
+package validate
+
+import (
+	"fmt"
+	"net/mail"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// ValidationError descreve a falha de uma regra em um campo
+type ValidationError struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Param   string `json:"param,omitempty"`
+	Message string `json:"message"`
+}
+
+func (e ValidationError) Error() string {
+	return e.Field + ": " + e.Message
+}
+
+// ValidationErrors agrupa todas as falhas encontradas em uma struct
+type ValidationErrors []ValidationError
+
+func (e ValidationErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, fe := range e {
+		msgs[i] = fe.Error()
+	}
+	return "validation failed: " + strings.Join(msgs, "; ")
+}
+
+// rule é uma regra já interpretada da tag
+type rule struct {
+	name  string
+	param string
+}
+
+// field guarda as regras de um campo da struct
+type field struct {
+	index []int
+	name  string
+	rules []rule
+	// nested indica uma struct (ou ponteiro para struct) a validar recursivamente
+	nested bool
+}
+
+// cache evita interpretar as tags do mesmo tipo a cada chamada
+var cache sync.Map // map[reflect.Type][]field
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// Struct valida v, que deve ser uma struct ou ponteiro para struct, e
+// retorna ValidationErrors com todas as falhas, ou nil se v for válido.
+// Tags com regras desconhecidas causam panic, pois são erro de programação.
+func Struct(v interface{}) error {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Pointer {
+		if rv.IsNil() {
+			panic("validate: Struct chamado com ponteiro nil")
+		}
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		panic(fmt.Sprintf("validate: Struct espera uma struct, recebeu %s", rv.Kind()))
+	}
+
+	var errs ValidationErrors
+	validateStruct(rv, "", &errs)
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
+
+func validateStruct(rv reflect.Value, prefix string, errs *ValidationErrors) {
+	for _, f := range fieldsOf(rv.Type()) {
+		fv := rv.FieldByIndex(f.index)
+		name := prefix + f.name
+
+		present := !fv.IsZero()
+		if fv.Kind() == reflect.Pointer {
+			if fv.IsNil() {
+				present = false
+			} else {
+				fv = fv.Elem()
+				present = true
+			}
+		}
+
+		if !present {
+			for _, r := range f.rules {
+				if r.name == "required" {
+					*errs = append(*errs, ValidationError{Field: name, Rule: r.name, Message: "required"})
+				}
+			}
+			// Uma struct zerada ainda pode ter campos obrigatórios
+			if f.nested && fv.Kind() == reflect.Struct {
+				validateStruct(fv, name+".", errs)
+			}
+			continue
+		}
+
+		for _, r := range f.rules {
+			if msg, ok := check(r, fv); !ok {
+				*errs = append(*errs, ValidationError{Field: name, Rule: r.name, Param: r.param, Message: msg})
+			}
+		}
+		if f.nested {
+			validateStruct(fv, name+".", errs)
+		}
+	}
+}
+
+// fieldsOf interpreta (e guarda em cache) as regras dos campos de t
+func fieldsOf(t reflect.Type) []field {
+	if cached, ok := cache.Load(t); ok {
+		return cached.([]field)
+	}
+
+	var fields []field
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if !sf.IsExported() {
+			continue
+		}
+
+		f := field{index: sf.Index, name: fieldName(sf)}
+		if tag := sf.Tag.Get("validate"); tag != "" && tag != "-" {
+			for _, part := range strings.Split(tag, ",") {
+				name, param, _ := strings.Cut(strings.TrimSpace(part), "=")
+				if !knownRule(name) {
+					panic(fmt.Sprintf("validate: regra desconhecida %q no campo %s.%s", name, t.Name(), sf.Name))
+				}
+				f.rules = append(f.rules, rule{name: name, param: param})
+			}
+		}
+
+		ft := sf.Type
+		if ft.Kind() == reflect.Pointer {
+			ft = ft.Elem()
+		}
+		f.nested = ft.Kind() == reflect.Struct && ft != timeType && sf.Tag.Get("validate") != "-"
+
+		if len(f.rules) > 0 || f.nested {
+			fields = append(fields, f)
+		}
+	}
+
+	cache.Store(t, fields)
+	return fields
+}
+
+// fieldName usa o nome da tag json, se houver, para reportar o campo
+func fieldName(sf reflect.StructField) string {
+	if tag := sf.Tag.Get("json"); tag != "" && tag != "-" {
+		if name, _, _ := strings.Cut(tag, ","); name != "" {
+			return name
+		}
+	}
+	return sf.Name
+}
+
+func knownRule(name string) bool {
+	switch name {
+	case "required", "min", "max", "email", "oneof":
+		return true
+	}
+	return false
+}
+
+// check aplica uma regra ao valor e retorna a mensagem em caso de falha
+func check(r rule, v reflect.Value) (string, bool) {
+	switch r.name {
+	case "required":
+		// O valor já está presente; resta rejeitar strings só com espaços
+		if v.Kind() == reflect.String && strings.TrimSpace(v.String()) == "" {
+			return "required", false
+		}
+	case "min", "max":
+		return checkBound(r, v)
+	case "email":
+		if v.Kind() != reflect.String || !isEmail(v.String()) {
+			return "must be a valid email address", false
+		}
+	case "oneof":
+		options := strings.Fields(r.param)
+		s := fmt.Sprint(v.Interface())
+		for _, o := range options {
+			if s == o {
+				return "", true
+			}
+		}
+		return "must be one of: " + strings.Join(options, ", "), false
+	}
+	return "", true
+}
+
+// checkBound implementa min e max conforme o tipo do campo
+func checkBound(r rule, v reflect.Value) (string, bool) {
+	limit, err := strconv.ParseFloat(r.param, 64)
+	if err != nil {
+		panic(fmt.Sprintf("validate: parâmetro inválido em %s=%s", r.name, r.param))
+	}
+
+	var n float64
+	sized := true
+	switch v.Kind() {
+	case reflect.String:
+		n = float64(utf8.RuneCountInString(v.String()))
+	case reflect.Slice, reflect.Map, reflect.Array:
+		n = float64(v.Len())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, sized = float64(v.Int()), false
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, sized = float64(v.Uint()), false
+	case reflect.Float32, reflect.Float64:
+		n, sized = v.Float(), false
+	default:
+		panic(fmt.Sprintf("validate: regra %s não se aplica a %s", r.name, v.Kind()))
+	}
+
+	if r.name == "min" && n < limit {
+		if v.Kind() == reflect.String {
+			return "must be at least " + r.param + " characters", false
+		}
+		if sized {
+			return "must have at least " + r.param + " items", false
+		}
+		return "must be at least " + r.param, false
+	}
+	if r.name == "max" && n > limit {
+		if v.Kind() == reflect.String {
+			return "must be at most " + r.param + " characters", false
+		}
+		if sized {
+			return "must have at most " + r.param + " items", false
+		}
+		return "must be at most " + r.param, false
+	}
+	return "", true
+}
+
+// isEmail aceita apenas o endereço puro (sem nome de exibição) com domínio
+func isEmail(s string) bool {
+	addr, err := mail.ParseAddress(s)
+	if err != nil || addr.Address != s || addr.Name != "" {
+		return false
+	}
+	_, domain, _ := strings.Cut(s, "@")
+	return domain != "" && !strings.HasPrefix(domain, ".") && !strings.HasSuffix(domain, ".")
+}
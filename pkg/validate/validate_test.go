@@ -0,0 +1,102 @@
+package validate
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+type address struct {
+	City string `json:"city" validate:"required"`
+}
+
+type signup struct {
+	Username string   `json:"username" validate:"required,min=3,max=10"`
+	Email    string   `json:"email" validate:"required,email"`
+	Role     string   `json:"role" validate:"oneof=admin user"`
+	Age      int      `json:"age" validate:"min=18,max=130"`
+	Tags     []string `json:"tags" validate:"max=2"`
+	Nick     *string  `json:"nick" validate:"min=2"`
+	Address  address  `json:"address"`
+	internal string
+}
+
+func ptr(s string) *string { return &s }
+
+// failures resume os erros como "campo:regra" para facilitar a comparação
+func failures(t *testing.T, err error) []string {
+	t.Helper()
+	if err == nil {
+		return nil
+	}
+	var errs ValidationErrors
+	if !errors.As(err, &errs) {
+		t.Fatalf("esperado ValidationErrors, obtido %T", err)
+	}
+	var got []string
+	for _, fe := range errs {
+		got = append(got, fe.Field+":"+fe.Rule)
+	}
+	return got
+}
+
+func TestStruct(t *testing.T) {
+	valid := signup{Username: "ana", Email: "ana@exemplo.com", Address: address{City: "Recife"}}
+
+	tests := []struct {
+		name   string
+		modify func(*signup)
+		want   []string
+	}{
+		{"válido", func(s *signup) {}, nil},
+		{"todos os opcionais preenchidos", func(s *signup) {
+			s.Role, s.Age, s.Tags, s.Nick = "admin", 30, []string{"a"}, ptr("aa")
+		}, nil},
+		{"obrigatórios ausentes", func(s *signup) {
+			s.Username, s.Email, s.Address.City = "", "", ""
+		}, []string{"username:required", "email:required", "address.city:required"}},
+		{"obrigatório só com espaços", func(s *signup) { s.Username = "   " }, []string{"username:required"}},
+		{"tamanho da string", func(s *signup) { s.Username = "ab" }, []string{"username:min"}},
+		{"tamanho em runas", func(s *signup) { s.Username = "joãozinhoã" }, nil},
+		{"máximo", func(s *signup) { s.Username = "abcdefghijk" }, []string{"username:max"}},
+		{"email inválido", func(s *signup) { s.Email = "Ana <ana@exemplo.com>" }, []string{"email:email"}},
+		{"email sem domínio", func(s *signup) { s.Email = "ana@" }, []string{"email:email"}},
+		{"oneof", func(s *signup) { s.Role = "root" }, []string{"role:oneof"}},
+		{"número", func(s *signup) { s.Age = 17 }, []string{"age:min"}},
+		{"slice", func(s *signup) { s.Tags = []string{"a", "b", "c"} }, []string{"tags:max"}},
+		{"ponteiro preenchido é validado", func(s *signup) { s.Nick = ptr("") }, []string{"nick:min"}},
+		{"vários erros de uma vez", func(s *signup) {
+			s.Username, s.Email, s.Age = "ab", "x", 200
+		}, []string{"username:min", "email:email", "age:max"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := valid
+			tt.modify(&s)
+			got := failures(t, Struct(&s))
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("esperado %v, obtido %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestStructMessages(t *testing.T) {
+	err := Struct(signup{Username: "ab", Email: "ana@exemplo.com", Address: address{City: "Recife"}})
+	want := "validation failed: username: must be at least 3 characters"
+	if err == nil || err.Error() != want {
+		t.Errorf("esperado %q, obtido %v", want, err)
+	}
+}
+
+func TestStructUnknownRule(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("esperado panic para regra desconhecida")
+		}
+	}()
+	Struct(struct {
+		Name string `validate:"requird"`
+	}{})
+}